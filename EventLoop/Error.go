@@ -0,0 +1,81 @@
+/*
+ * @Description: 事件循环的错误处理:创建失败时记录错误而不是panic,运行中无法返回给调用方的错误
+ *  (如accept失败、注销事件失败)通过OnError上报,以及事件循环的关闭
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-24 10:20:35
+ * @LastEditTime: 2021-08-24 15:36:12
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	err "Reactloop/Utils/Error"
+	logger "Reactloop/Utils/Log"
+	"syscall"
+)
+
+/**
+ * @description:错误处理函数,在事件循环中调用;可以用errors.Is与Utils/Error中的哨兵错误或者syscall.Errno比较
+ * @param {*EventLoop} el
+ * @param {error} err
+ * @return {*}
+ */
+type ErrorHandler func(el *EventLoop, err error)
+
+/**
+ * @description:创建事件循环时发生的错误(如epoll创建失败),不为nil时事件循环不可用,Run直接返回
+ * @param {*}
+ * @return {*}
+ */
+func (el *EventLoop) Err() error {
+	return el.err
+}
+
+/**
+ * @description:设置错误处理函数,为nil时错误只输出到Logger
+ * @param {ErrorHandler} handler
+ * @return {*}
+ */
+func (el *EventLoop) OnError(handler ErrorHandler) {
+	el.errorHandler = handler
+}
+
+/**
+ * @description:上报一个无法返回给调用方的错误:以WARN级别输出到Logger,然后调用错误处理函数;需要在事件循环中调用
+ * @param {error} e
+ * @param {...logger.Field} fields 日志中附加的字段(如fd、对端地址)
+ * @return {*}
+ */
+func (el *EventLoop) ReportError(e error, fields ...logger.Field) {
+	el.logger.Log(logger.WARN, "EventLoop-error:"+e.Error(), fields...)
+	if el.errorHandler != nil {
+		handler := el.errorHandler
+		el.protect(nil, func() { handler(el, e) })
+	}
+}
+
+/**
+ * @description:关闭事件循环持有的fd(epoll、eventfd、timerfd、信号管道)并停止看门狗,
+ *  之后Post等操作返回匹配ErrClosed的错误;需要在Run返回后调用
+ * @param {*}
+ * @return {*}
+ */
+func (el *EventLoop) Close() error {
+	if el.Selector == nil {
+		return el.err
+	}
+	el.SetWatchdog(0, nil)
+	el.StopSignals()
+	el.SetHighResTimers(false)
+	q := el.posted
+	q.mu.Lock()
+	if q.fd >= 0 {
+		syscall.Close(q.fd)
+		q.fd = -1
+	}
+	q.err = &err.CLOSED_ERR{Op: "post"}
+	q.mu.Unlock()
+	return el.Selector.Close()
+}
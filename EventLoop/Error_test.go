@@ -0,0 +1,73 @@
+/*
+ * @Description: 错误上报与事件循环关闭测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-24 13:52:18
+ * @LastEditTime: 2021-08-24 15:20:44
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	err "Reactloop/Utils/Error"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCloseAndOnError(t *testing.T) {
+	el := New()
+	if el.Err() != nil {
+		t.Fatal(el.Err())
+	}
+	reported := []error{}
+	el.OnError(func(el *EventLoop, e error) { reported = append(reported, e) })
+	if e := el.SetHighResTimers(true); e != nil {
+		t.Fatal(e)
+	}
+	if e := el.Close(); e != nil {
+		t.Fatal(e)
+	}
+	if e := el.Post(func(el *EventLoop) {}); !errors.Is(e, err.ErrClosed) || !errors.Is(e, syscall.EBADF) {
+		t.Fatal("post after close", e)
+	}
+	if e := el.RegisterEvent(0, 1, nil, nil); !errors.Is(e, err.ErrClosed) {
+		t.Fatal("register after close", e)
+	}
+	// 在已经关闭的事件循环上运行时上报错误并退出
+	el.TikTok()
+	if len(reported) != 1 || !errors.Is(reported[0], err.ErrClosed) || !el.done {
+		t.Fatal(reported)
+	}
+	if e := el.Close(); !errors.Is(e, err.ErrClosed) {
+		t.Fatal("second close", e)
+	}
+}
+
+func TestSentinels(t *testing.T) {
+	cases := []struct {
+		e        error
+		sentinel error
+		errno    syscall.Errno
+	}{
+		{&err.CONN_TIMEOUT_ERR{Kind: "idle"}, err.ErrTimeout, syscall.ETIMEDOUT},
+		{&err.JOB_TIMEOUT_ERR{After: time.Second}, err.ErrTimeout, syscall.ETIMEDOUT},
+		{&err.FD_EXEC_LIMIT_ERROR{FD: 2048}, err.ErrFDLimit, syscall.EMFILE},
+		{&err.UNKNOW_NETWORK_ERR{Network: "udp"}, err.ErrUnknownNetwork, syscall.EAFNOSUPPORT},
+		{err.Syscall("accept", syscall.ENFILE), err.ErrFDLimit, syscall.ENFILE},
+		{err.Syscall("epoll_wait", syscall.EBADF), err.ErrClosed, syscall.EBADF},
+	}
+	for _, c := range cases {
+		if !errors.Is(c.e, c.sentinel) || !errors.Is(c.e, c.errno) {
+			t.Fatalf("%v should match %v and %v", c.e, c.sentinel, c.errno)
+		}
+		if errors.Is(c.e, err.ErrClosed) && c.sentinel != err.ErrClosed {
+			t.Fatalf("%v should not match ErrClosed", c.e)
+		}
+	}
+	if !errors.Is(&err.POOL_CLOSED_ERR{}, err.ErrClosed) {
+		t.Fatal("closed pool should match ErrClosed")
+	}
+}
@@ -12,8 +12,11 @@ package EventLoop
 import (
 	"Reactloop/EventManager"
 	enum "Reactloop/Utils/Enum"
-	"fmt"
-	"log"
+	err "Reactloop/Utils/Error"
+	logger "Reactloop/Utils/Log"
+	"container/heap"
+	"errors"
+	"syscall"
 	"time"
 )
 
@@ -23,26 +26,46 @@ import (
  * @return {*}
  */
 type EventLoop struct {
-	*EventManager.Selector               //指向一个Selector
-	system_events          []*Event      //系统事件
-	user_events            []*UserEvent  //用户定义事件
-	interval               time.Duration //定义事件循环的轮询周期
-	done                   bool          //事件是否完成的标志位,也是是否退出循环的标志位
-	triger_data_ptr        *interface{}  //指定触发器特定数据的指针(通过委托指针实现不同eventloop的功能)
+	*EventManager.Selector                  //指向一个Selector
+	system_events          []*Event         //系统事件
+	user_events            timerHeap        //用户定义事件,按下一次触发时间排成最小堆
+	interval               time.Duration    //定义事件循环的轮询周期
+	done                   bool             //事件是否完成的标志位,也是是否退出循环的标志位
+	triger_data_ptr        *interface{}     //指定触发器特定数据的指针(通过委托指针实现不同eventloop的功能)
+	signals                *signalState     //信号转发状态,没有注册信号处理函数时为nil
+	timerfd                int              //高精度定时器的timerfd,未开启时为-1
+	children               map[int]*Process //不支持pidfd时通过SIGCHLD回收的子进程
+	panicHandler           PanicHandler     //用户回调panic时的处理函数
+	source                 EventSource      //当前触发的事件的来源
+	posted                 *postQueue       //其他goroutine投递的任务
+	metrics                *loopMetrics     //指标,没有开启时为nil
+	watchdog               *watchdog        //卡顿检测,没有开启时为nil
+	stats                  LoopStats        //循环耗时与定时任务延迟统计
+	id                     int              //进程内唯一的ID,日志中的loop字段
+	logger                 logger.Logger    //日志输出,默认不输出
+	err                    error            //创建时发生的错误,不为nil时事件循环不可用
+	errorHandler           ErrorHandler     //运行中错误的处理函数
 }
 
 /**
- * @description: EventLoop构造函数
+ * @description: EventLoop构造函数;创建epoll失败时不会panic,通过Err()获取错误
  * @param  {*}
  * @return {*}
  */
 func New() *EventLoop {
-	return &EventLoop{
-		Selector:      EventManager.New(1024), //调用EventManager初始化一个事件管理器
+	selector, errs := EventManager.New(1024) //调用EventManager初始化一个事件管理器
+	el := &EventLoop{
+		Selector:      selector,
+		err:           errs,
 		system_events: []*Event{},
-		user_events:   []*UserEvent{},
+		user_events:   timerHeap{},
 		interval:      100 * time.Millisecond,
+		timerfd:       -1,
+		id:            nextLoopID(),
+		logger:        logger.Nop,
 	}
+	el.initPost()
+	return el
 }
 
 /**
@@ -60,18 +83,26 @@ func (el *EventLoop) Done() {
  * @return {*}
  */
 func (el *EventLoop) Run() {
+	if el.err != nil {
+		return
+	}
 	for _, system_event := range el.system_events {
 		if system_event.Serving != nil {
-			system_event.Serving(el, nil)
+			serving := system_event.Serving
+			el.protect(nil, func() { serving(el, nil) })
 		}
 	}
 	for _, user_event := range el.user_events {
 		user_event.setNextTrigerTime()
 	}
+	heap.Init(&el.user_events)
 	// 只要事件循环没有设置为结束就一直执行
 	for !el.done {
 		el.TikTok()
 	}
+	if el.watchdog != nil {
+		el.SetWatchdog(0, nil)
+	}
 }
 
 /**
@@ -84,6 +115,33 @@ func (el *EventLoop) SetTrigerDataPtr(data interface{}) {
 	el.triger_data_ptr = &data
 }
 
+/**
+ * @description: 在事件处理函数之外直接触发一次系统事件(如握手完成后延迟触发的Open),
+ *  只能传入TRIGGER_*类型的action
+ * @param {enum.Action} action
+ * @param {interface{}} data 作为触发指针传给回调
+ * @return {*}
+ */
+func (el *EventLoop) Trigger(action enum.Action, data interface{}) {
+	el.TriggerFrom(nil, action, data)
+}
+
+/**
+ * @description:同Trigger,同时指定事件的来源,回调panic时关闭src
+ * @param {EventSource} src
+ * @param {enum.Action} action
+ * @param {interface{}} data
+ * @return {*}
+ */
+func (el *EventLoop) TriggerFrom(src EventSource, action enum.Action, data interface{}) {
+	// 可能在回调中调用,触发完成后恢复外层事件的数据指针和来源
+	saved, savedSrc := el.triger_data_ptr, el.source
+	el.SetTrigerDataPtr(data)
+	el.source = src
+	el.processAction(action, -1)
+	el.triger_data_ptr, el.source = saved, savedSrc
+}
+
 /**
  * @description: 添加一个系统事件
  * @param  {*}
@@ -101,23 +159,79 @@ func (el *EventLoop) AddSystemEvent(event *Event) {
  * @param {*UserEvent} task
  */
 func (el *EventLoop) AddUserEvent(task *UserEvent) {
-	el.user_events = append(el.user_events, task)
+	task.removed = false
+	el.user_events.add(task)
 }
 
 /**
- * @description:遍历用户事件,找到最接近现在的触发事件
+ * @description: 添加一个只执行一次的定时任务,delay之后在事件循环中执行task
+ * @param {time.Duration} delay 延迟时间
+ * @param {TrigerProcess} task
+ * @return {*UserEvent} 返回的UserEvent可以通过RemoveUserEvent取消
+ */
+func (el *EventLoop) AddTimer(delay time.Duration, task TrigerProcess) *UserEvent {
+	timer := &UserEvent{
+		Task:     task,
+		Interval: delay,
+		Once:     true,
+	}
+	timer.setNextTrigerTime()
+	el.user_events.add(timer)
+	return timer
+}
+
+/**
+ * @description: 移除一个用户事件(周期任务或定时任务),移除后不会再被触发
+ * @param {*UserEvent} user_event
+ * @return {*}
+ */
+func (el *EventLoop) RemoveUserEvent(user_event *UserEvent) {
+	// 同一轮中已经到期、取出等待执行的任务不在堆中,也需要标记
+	user_event.removed = true
+	el.user_events.remove(user_event)
+}
+
+/**
+ * @description:找到下一次触发时间最早的事件(堆顶)
  * @param  {*}
  * @return {*}
  */
 func (el *EventLoop) FindNearestTask() *UserEvent {
-	for _, user_event := range el.user_events {
-		fmt.Println("nextTrigerTime:", user_event.NexttriggerTime)
-		fmt.Println("now:", time.Now())
-		if user_event.NexttriggerTime.After(time.Now()) {
-			return user_event
+	return el.user_events.peek()
+}
+
+/**
+ * @description:执行所有已经到期的用户事件,周期任务重新计算触发时间,一次性任务执行后移除
+ * @param  {*}
+ * @return {*}
+ */
+func (el *EventLoop) runExpiredTasks() {
+	now := time.Now()
+	// 先取出所有到期的任务,周期任务按新的触发时间放回堆中;任务执行过程中可能会增删用户事件
+	var expired []*UserEvent
+	var scheduled []time.Time
+	for top := el.user_events.peek(); top != nil && !top.NexttriggerTime.After(now); top = el.user_events.peek() {
+		heap.Pop(&el.user_events)
+		expired = append(expired, top)
+		scheduled = append(scheduled, top.NexttriggerTime)
+	}
+	for _, user_event := range expired {
+		if !user_event.Once {
+			user_event.setNextTrigerTime()
+			el.user_events.add(user_event)
+		}
+	}
+	for i, user_event := range expired {
+		// 前面执行的任务可能已经移除了该任务(如连接关闭时取消它的超时定时器)
+		if user_event.removed {
+			continue
 		}
+		el.timerFired(scheduled[i], time.Now())
+		task := user_event.Task
+		frame := el.enter(callbackTask)
+		el.protect(nil, func() { task(el, nil) })
+		el.leave(callbackTask, frame)
 	}
-	return nil
 }
 
 /**
@@ -129,39 +243,68 @@ func (el *EventLoop) FindNearestTask() *UserEvent {
 func (el *EventLoop) processAction(action enum.Action, fd int) {
 	switch action {
 	case enum.SHUTDOWN_RD:
-		if _, err := el.UnRegister(fd, enum.EVENT_READABLE); err != nil {
-			log.Printf("EventLoop-processAction:%s", "尝试执行任务失败")
+		if _, errs := el.UnRegister(fd, enum.EVENT_READABLE); errs != nil {
+			el.ReportError(errs, logger.Fd(fd))
 		}
 	case enum.SHUTDOWN_WR:
-		if _, err := el.UnRegister(fd, enum.EVENT_WRITABLE); err != nil {
-			log.Printf("EventLoop-processAction:%s", "尝试执行任务失败")
+		if _, errs := el.UnRegister(fd, enum.EVENT_WRITABLE); errs != nil {
+			el.ReportError(errs, logger.Fd(fd))
 		}
 	case enum.SHUTDOWN_RDWR:
-		if _, err := el.UnRegister(fd, enum.EVENT_WRITABLE|enum.EVENT_READABLE); err != nil {
-			log.Printf("EventLoop-processAction:%s", "尝试执行任务失败")
+		if _, errs := el.UnRegister(fd, enum.EVENT_WRITABLE|enum.EVENT_READABLE); errs != nil {
+			el.ReportError(errs, logger.Fd(fd))
 		}
 	case enum.TRIGGER_OPEN_EVENT:
-		for _, event := range el.system_events {
-			if event.Close != nil {
-				event.Open(el, el.triger_data_ptr)
-			}
-		}
+		frame := el.enter(callbackOpen)
+		el.dispatch(func(event *Event) TrigerProcess { return event.Open })
+		el.leave(callbackOpen, frame)
 	case enum.TRIGGER_DATA_EVENT:
-		for _, event := range el.system_events {
-			if event.Data != nil {
-				event.Data(el, el.triger_data_ptr)
-			}
-		}
+		frame := el.enter(callbackData)
+		el.dispatch(func(event *Event) TrigerProcess { return event.Data })
+		el.leave(callbackData, frame)
 	case enum.TRIGGER_CLOSE_EVENT:
-		for _, event := range el.system_events {
-			if event.Close != nil {
-				event.Close(el, el.triger_data_ptr)
-			}
-		}
+		frame := el.enter(callbackClose)
+		el.dispatch(func(event *Event) TrigerProcess { return event.Close })
+		el.leave(callbackClose, frame)
 	case enum.CONTINUE:
 	}
 	// 将数据与操作进行一次绑定后，需要清空数据,下一次到来的事件的触发指针可能不一样
 	el.triger_data_ptr = nil
+	el.source = nil
+}
+
+/**
+ * @description:事件来源可以实现该接口,为自己的事件指定单独的回调集合(如每个Listener一组回调),
+ *  Events返回nil时使用事件循环的系统事件
+ * @param {*}
+ * @return {*}
+ */
+type EventRouter interface {
+	Events() []*Event
+}
+
+/**
+ * @description:依次执行事件来源的回调集合(没有时为所有系统事件)中对应的回调;某个回调panic后关闭事件来源,剩下的回调不再执行
+ * @param {func(*Event) TrigerProcess} pick 选出要执行的回调
+ * @return {*}
+ */
+func (el *EventLoop) dispatch(pick func(event *Event) TrigerProcess) {
+	ptr, src := el.triger_data_ptr, el.Source()
+	events := el.system_events
+	if router, ok := src.(EventRouter); ok {
+		if own := router.Events(); own != nil {
+			events = own
+		}
+	}
+	for _, event := range events {
+		callback := pick(event)
+		if callback == nil {
+			continue
+		}
+		if el.protect(src, func() { callback(el, ptr) }) {
+			return
+		}
+	}
 }
 
 /**
@@ -178,16 +321,36 @@ func (el *EventLoop) TikTok() {
 			sleepTime = 0
 		}
 	}
-	selectorkeys, _, _ := el.Poll(int(sleepTime / time.Millisecond))
-	for _, selectorkey := range selectorkeys {
+	selectorkeys, masks, errs := el.Poll(el.pollTimeout(sleepTime, nearestTask != nil))
+	busy := time.Now()
+	if errs != nil && !errors.Is(errs, syscall.EINTR) {
+		el.ReportError(errs)
+		// Selector已经关闭时不能再继续循环
+		if errors.Is(errs, err.ErrClosed) {
+			el.Done()
+			return
+		}
+	}
+	el.metrics.poll(len(selectorkeys))
+	if el.watchdog != nil {
+		el.watchdog.bind()
+	}
+	for i, selectorkey := range selectorkeys {
+		// 同一轮中前面的回调可能已经注销了该fd
+		if selectorkey == nil || selectorkey.Data == nil {
+			continue
+		}
 		ed := selectorkey.Data.(EventData)
-		action := ed.e(el, ed)
+		ed.ready = masks[i]
+		action := enum.CONTINUE
+		// Watch等注册的回调中同样可能执行用户代码
+		frame := el.enter(callbackIO)
+		el.protect(nil, func() { action = ed.e(el, ed) })
+		el.leave(callbackIO, frame)
 		el.processAction(action, selectorkey.Fd)
 	}
-	if nearestTask != nil {
-		nearestTask.Task(el, nil)
-		nearestTask.setNextTrigerTime()
-	}
+	el.runExpiredTasks()
+	el.iterationDone(busy)
 }
 
 /**
@@ -245,6 +408,9 @@ type UserEvent struct {
 	NexttriggerTime time.Time     //下一次需要执行的具体时间
 	Task            TrigerProcess //执行事件的函数
 	Interval        time.Duration //运行的时间周期间隔
+	Once            bool          //是否只执行一次(定时任务),执行后从事件循环中移除
+	removed         bool          //是否已经被RemoveUserEvent移除,同一轮中已经到期的任务也不再执行
+	index           int           //在堆中的位置+1,0表示不在堆中;加入事件循环后不能再直接修改NexttriggerTime
 }
 
 /**
@@ -258,6 +424,7 @@ func (ue *UserEvent) setNextTrigerTime() {
 
 type EventProc func(el *EventLoop, data interface{}) enum.Action
 type EventData struct {
-	e    EventProc
-	data interface{}
+	e     EventProc
+	data  interface{}
+	ready uint32 //本轮就绪的epoll事件(EPOLLIN/EPOLLOUT/EPOLLHUP/EPOLLERR)
 }
@@ -0,0 +1,400 @@
+/*
+ * @Description: 基于inotify的文件监控:inotify的fd注册在事件循环中,按路径交付创建/修改/删除/移动事件,
+ *  支持递归监控目录(新建和移入的子目录自动加入监控)
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-16 09:52:30
+ * @LastEditTime: 2021-08-16 19:14:48
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	enum "Reactloop/Utils/Enum"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// FileOp 文件事件的类型
+type FileOp uint32
+
+const (
+	FILE_CREATE   FileOp = iota + 1 //创建(或者从监控范围之外移入)
+	FILE_MODIFY                     //内容被修改
+	FILE_DELETE                     //删除(或者移出监控范围);监控的路径本身被删除或者移走时也会收到,之后不再监控
+	FILE_MOVE                       //在监控范围内移动,OldPath为原路径
+	FILE_OVERFLOW                   //内核事件队列溢出,有事件丢失,需要重新扫描
+)
+
+const (
+	fileWatchMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_DELETE | syscall.IN_MOVED_FROM |
+		syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+	fileWatchBuf = 64 * 1024
+	// 等待与IN_MOVED_FROM配对的IN_MOVED_TO的时间;一次rename产生的两个事件在内核队列中相邻,
+	// 只会被read的缓冲区边界分到两批,下一次可读时就能读到
+	fileMoveWait = 10 * time.Millisecond
+)
+
+/**
+ * @description:一个文件事件
+ * @param {*}
+ * @return {*}
+ */
+type FileEvent struct {
+	Op      FileOp
+	Path    string
+	OldPath string //只有FILE_MOVE时有值
+	IsDir   bool
+}
+
+/**
+ * @description:文件事件回调,在事件循环中执行
+ * @param {*EventLoop} el
+ * @param {FileEvent} ev
+ * @return {*}
+ */
+type FileHandler func(el *EventLoop, ev FileEvent)
+
+// 一个inotify watch对应的路径
+type fileWatch struct {
+	path      string
+	recursive bool
+	root      bool //是否为Add添加的路径(递归监控时自动加入的子目录为false)
+}
+
+// 等待配对的IN_MOVED_FROM
+type pendingMove struct {
+	cookie uint32
+	path   string
+	isDir  bool
+	expire time.Time //到期仍未配对时按删除处理
+}
+
+/**
+ * @description:文件监控器
+ *  监控单个文件时,编辑器通常通过"写临时文件再rename"来保存,原文件被替换后会收到FILE_DELETE并停止监控,
+ *  热加载配置时建议监控所在目录再按路径过滤
+ * @param {*}
+ * @return {*}
+ */
+type FileWatcher struct {
+	el      *EventLoop
+	fd      int
+	w       *Watcher
+	handler FileHandler
+	wds     map[int32]*fileWatch
+	paths   map[string]int32
+	moves   []pendingMove //按到期时间排列
+	timer   *UserEvent    //处理到期的moves
+}
+
+/**
+ * @description:创建文件监控器并把inotify的fd注册到事件循环
+ * @param {FileHandler} handler
+ * @return {*}
+ */
+func (el *EventLoop) NewFileWatcher(handler FileHandler) (*FileWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_NONBLOCK | syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	fw := &FileWatcher{
+		el:      el,
+		fd:      fd,
+		handler: handler,
+		wds:     map[int32]*fileWatch{},
+		paths:   map[string]int32{},
+	}
+	if fw.w, err = el.Watch(fd, enum.EVENT_READABLE, fw.onReadable); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return fw, nil
+}
+
+/**
+ * @description:开始监控path(文件或者目录)
+ * @param {string} path
+ * @param {bool} recursive 为true时监控目录下的所有子目录
+ * @return {*}
+ */
+func (fw *FileWatcher) Add(path string, recursive bool) error {
+	path = filepath.Clean(path)
+	if err := fw.addWatch(path, recursive, true); err != nil {
+		return err
+	}
+	if !recursive {
+		return nil
+	}
+	return fw.addTree(path, false)
+}
+
+/**
+ * @description:为root下的所有子目录添加监控
+ * @param {string} root
+ * @param {bool} report 是否为扫描到的文件和目录交付FILE_CREATE(新建的目录在加入监控之前可能已经有了内容)
+ * @return {*}
+ */
+func (fw *FileWatcher) addTree(root string, report bool) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == root {
+			// 扫描过程中被删除的路径忽略
+			return nil
+		}
+		if report {
+			fw.handler(fw.el, FileEvent{Op: FILE_CREATE, Path: path, IsDir: info.IsDir()})
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if err := fw.addWatch(path, true, false); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+func (fw *FileWatcher) addWatch(path string, recursive, root bool) error {
+	wd, err := syscall.InotifyAddWatch(fw.fd, path, fileWatchMask)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: path, Err: err}
+	}
+	if old, ok := fw.wds[int32(wd)]; ok {
+		// 同一个inode已经被监控(如重复Add),保留更强的设置
+		recursive = recursive || old.recursive
+		root = root || old.root
+		delete(fw.paths, old.path)
+	}
+	fw.wds[int32(wd)] = &fileWatch{path: path, recursive: recursive, root: root}
+	fw.paths[path] = int32(wd)
+	return nil
+}
+
+/**
+ * @description:停止监控path,递归监控时同时停止监控其下的子目录
+ * @param {string} path
+ * @return {*}
+ */
+func (fw *FileWatcher) Remove(path string) error {
+	path = filepath.Clean(path)
+	wd, ok := fw.paths[path]
+	if !ok {
+		return &os.PathError{Op: "inotify_rm_watch", Path: path, Err: syscall.EINVAL}
+	}
+	fw.removeTree(path)
+	delete(fw.paths, path)
+	delete(fw.wds, wd)
+	_, err := syscall.InotifyRmWatch(fw.fd, uint32(wd))
+	return err
+}
+
+// 停止监控path之下的子目录(不包括path本身)并忘记它们
+func (fw *FileWatcher) removeTree(path string) {
+	prefix := path + string(filepath.Separator)
+	for p, wd := range fw.paths {
+		if strings.HasPrefix(p, prefix) {
+			syscall.InotifyRmWatch(fw.fd, uint32(wd))
+			delete(fw.paths, p)
+			delete(fw.wds, wd)
+		}
+	}
+}
+
+/**
+ * @description:关闭监控器,之后不会再有回调
+ * @param {*}
+ * @return {*}
+ */
+func (fw *FileWatcher) Close() {
+	if fw.w == nil {
+		return
+	}
+	fw.w.Stop()
+	syscall.Close(fw.fd)
+	fw.w = nil
+	if fw.timer != nil {
+		fw.el.RemoveUserEvent(fw.timer)
+		fw.timer = nil
+	}
+	fw.wds, fw.paths, fw.moves = map[int32]*fileWatch{}, map[string]int32{}, nil
+}
+
+/**
+ * @description:inotify可读:读出一批事件并交付
+ * @param {*EventLoop} el
+ * @param {*Watcher} w
+ * @param {uint32} _
+ * @return {*}
+ */
+func (fw *FileWatcher) onReadable(el *EventLoop, w *Watcher, _ uint32) {
+	buf := make([]byte, fileWatchBuf)
+	n, err := syscall.Read(fw.fd, buf)
+	if err != nil || n < syscall.SizeofInotifyEvent {
+		return
+	}
+	for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+		raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+		nameStart := offset + syscall.SizeofInotifyEvent
+		name := strings.TrimRight(string(buf[nameStart:nameStart+int(raw.Len)]), "\x00")
+		fw.handle(raw.Wd, raw.Mask, raw.Cookie, name)
+		offset = nameStart + int(raw.Len)
+		if fw.w == nil {
+			// 回调中关闭了监控器
+			return
+		}
+	}
+	fw.scheduleMoves()
+}
+
+/**
+ * @description:把一个inotify事件转换为FileEvent
+ * @param {int32} wd
+ * @param {uint32} mask
+ * @param {uint32} cookie
+ * @param {string} name
+ * @return {*}
+ */
+func (fw *FileWatcher) handle(wd int32, mask, cookie uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		fw.handler(fw.el, FileEvent{Op: FILE_OVERFLOW})
+		return
+	}
+	entry, ok := fw.wds[wd]
+	if !ok {
+		return
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		// watch已经被内核移除(路径被删除或者调用了rm_watch)
+		delete(fw.wds, wd)
+		if fw.paths[entry.path] == wd {
+			delete(fw.paths, entry.path)
+		}
+		return
+	}
+	isDir := mask&syscall.IN_ISDIR != 0
+	path := entry.path
+	if name != "" {
+		path = filepath.Join(entry.path, name)
+	}
+	switch {
+	case mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0:
+		// 子目录自身的删除/移动已经由父目录的事件报告过
+		if entry.root {
+			fw.handler(fw.el, FileEvent{Op: FILE_DELETE, Path: path, IsDir: isDir})
+			if mask&syscall.IN_MOVE_SELF != 0 {
+				fw.removeTree(path)
+				syscall.InotifyRmWatch(fw.fd, uint32(wd))
+			}
+		}
+	case mask&syscall.IN_CREATE != 0:
+		fw.handler(fw.el, FileEvent{Op: FILE_CREATE, Path: path, IsDir: isDir})
+		if isDir && entry.recursive {
+			fw.watchNewDir(path)
+		}
+	case mask&syscall.IN_MODIFY != 0:
+		fw.handler(fw.el, FileEvent{Op: FILE_MODIFY, Path: path, IsDir: isDir})
+	case mask&syscall.IN_DELETE != 0:
+		fw.handler(fw.el, FileEvent{Op: FILE_DELETE, Path: path, IsDir: isDir})
+	case mask&syscall.IN_MOVED_FROM != 0:
+		fw.moves = append(fw.moves, pendingMove{cookie: cookie, path: path, isDir: isDir, expire: time.Now().Add(fileMoveWait)})
+	case mask&syscall.IN_MOVED_TO != 0:
+		for i, m := range fw.moves {
+			if m.cookie != cookie {
+				continue
+			}
+			fw.moves = append(fw.moves[:i], fw.moves[i+1:]...)
+			fw.handler(fw.el, FileEvent{Op: FILE_MOVE, Path: path, OldPath: m.path, IsDir: isDir})
+			if isDir {
+				fw.renameTree(m.path, path, entry.recursive)
+			}
+			return
+		}
+		// 从监控范围之外移入
+		fw.handler(fw.el, FileEvent{Op: FILE_CREATE, Path: path, IsDir: isDir})
+		if isDir && entry.recursive {
+			fw.watchNewDir(path)
+		}
+	}
+}
+
+// 递归监控时新出现的子目录:加入监控并报告其中已有的内容
+func (fw *FileWatcher) watchNewDir(path string) {
+	if err := fw.addWatch(path, true, false); err != nil {
+		return
+	}
+	fw.addTree(path, true)
+}
+
+/**
+ * @description:目录在监控范围内移动后更新记录的路径
+ * @param {string} from
+ * @param {string} to
+ * @param {bool} recursive 目标目录是否处于递归监控中
+ * @return {*}
+ */
+func (fw *FileWatcher) renameTree(from, to string, recursive bool) {
+	prefix := from + string(filepath.Separator)
+	for p, wd := range fw.paths {
+		if p != from && !strings.HasPrefix(p, prefix) {
+			continue
+		}
+		newPath := to + p[len(from):]
+		delete(fw.paths, p)
+		fw.paths[newPath] = wd
+		fw.wds[wd].path = newPath
+	}
+	if _, ok := fw.paths[to]; !ok && recursive {
+		// 从非递归监控的目录移入递归监控的目录
+		fw.watchNewDir(to)
+	}
+}
+
+/**
+ * @description:还有没配对的IN_MOVED_FROM时启动定时器,配对的IN_MOVED_TO可能在下一批事件中
+ * @param {*}
+ * @return {*}
+ */
+func (fw *FileWatcher) scheduleMoves() {
+	if len(fw.moves) == 0 || fw.timer != nil {
+		return
+	}
+	fw.timer = fw.el.AddTimer(time.Until(fw.moves[0].expire), func(el *EventLoop, _ *interface{}) {
+		fw.timer = nil
+		fw.flushMoves(time.Now())
+		if fw.w != nil {
+			fw.scheduleMoves()
+		}
+	})
+}
+
+/**
+ * @description:到期仍然没有配对的IN_MOVED_FROM说明移出了监控范围,按删除处理
+ * @param {time.Time} now
+ * @return {*}
+ */
+func (fw *FileWatcher) flushMoves(now time.Time) {
+	i := 0
+	for i < len(fw.moves) && !fw.moves[i].expire.After(now) {
+		i++
+	}
+	expired := fw.moves[:i]
+	fw.moves = fw.moves[i:]
+	for _, m := range expired {
+		if fw.w == nil {
+			// 回调中关闭了监控器
+			return
+		}
+		if m.isDir {
+			if wd, ok := fw.paths[m.path]; ok && !fw.wds[wd].root {
+				fw.removeTree(m.path)
+				syscall.InotifyRmWatch(fw.fd, uint32(wd))
+			}
+		}
+		fw.handler(fw.el, FileEvent{Op: FILE_DELETE, Path: m.path, IsDir: m.isDir})
+	}
+}
@@ -0,0 +1,101 @@
+/*
+ * @Description: inotify文件监控测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-16 16:31:05
+ * @LastEditTime: 2021-08-16 19:10:52
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFileWatcherRecursive(t *testing.T) {
+	dir, outside := t.TempDir(), t.TempDir()
+	el := New()
+	events := []string{}
+	fw, err := el.NewFileWatcher(func(el *EventLoop, ev FileEvent) {
+		rel := func(p string) string { return strings.TrimPrefix(p, dir) }
+		s := fmt.Sprintf("%d %s", ev.Op, rel(ev.Path))
+		if ev.Op == FILE_MOVE {
+			s += " <- " + rel(ev.OldPath)
+		}
+		events = append(events, s)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fw.Close()
+	if err := fw.Add(dir, true); err != nil {
+		t.Fatal(err)
+	}
+	step := func(action func(), want ...string) {
+		t.Helper()
+		events = nil
+		action()
+		for i := 0; i < 20 && len(events) < len(want); i++ {
+			el.TikTok()
+		}
+		if strings.Join(events, ",") != strings.Join(want, ",") {
+			t.Fatalf("events %q, want %q", events, want)
+		}
+	}
+	conf := filepath.Join(dir, "app.conf")
+	step(func() { ioutil.WriteFile(conf, nil, 0644) }, fmt.Sprintf("%d /app.conf", FILE_CREATE))
+	step(func() { ioutil.WriteFile(conf, []byte("x"), 0644) }, fmt.Sprintf("%d /app.conf", FILE_MODIFY))
+	sub := filepath.Join(dir, "sub")
+	step(func() { os.Mkdir(sub, 0755) }, fmt.Sprintf("%d /sub", FILE_CREATE))
+	step(func() { ioutil.WriteFile(filepath.Join(sub, "a"), nil, 0644) }, fmt.Sprintf("%d /sub/a", FILE_CREATE))
+	step(func() { os.Rename(sub, filepath.Join(dir, "moved")) }, fmt.Sprintf("%d /moved <- /sub", FILE_MOVE))
+	step(func() { os.Remove(filepath.Join(dir, "moved", "a")) }, fmt.Sprintf("%d /moved/a", FILE_DELETE))
+	step(func() { os.Rename(conf, filepath.Join(outside, "app.conf")) }, fmt.Sprintf("%d /app.conf", FILE_DELETE))
+	if err := fw.Remove(dir); err != nil || len(fw.paths) != 0 {
+		t.Fatal("remove", err, fw.paths)
+	}
+}
+
+func TestFileWatcherMoveAcrossBatches(t *testing.T) {
+	dir := t.TempDir()
+	el := New()
+	events := []string{}
+	fw, err := el.NewFileWatcher(func(el *EventLoop, ev FileEvent) {
+		events = append(events, fmt.Sprintf("%d %s %s", ev.Op, filepath.Base(ev.Path), filepath.Base(ev.OldPath)))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fw.Close()
+	if err := fw.Add(dir, false); err != nil {
+		t.Fatal(err)
+	}
+	wd := fw.paths[dir]
+	// 模拟rename的两个事件被read的缓冲区边界分到两批
+	fw.handle(wd, syscall.IN_MOVED_FROM, 7, "old")
+	fw.scheduleMoves()
+	fw.handle(wd, syscall.IN_MOVED_TO, 7, "new")
+	fw.scheduleMoves()
+	// 没有配对的移出在等待之后按删除处理
+	fw.handle(wd, syscall.IN_MOVED_FROM, 8, "gone")
+	fw.scheduleMoves()
+	deadline := time.Now().Add(time.Second)
+	for len(events) < 2 && time.Now().Before(deadline) {
+		el.TikTok()
+	}
+	want := []string{fmt.Sprintf("%d new old", FILE_MOVE), fmt.Sprintf("%d gone .", FILE_DELETE)}
+	if strings.Join(events, ",") != strings.Join(want, ",") {
+		t.Fatalf("events %q, want %q", events, want)
+	}
+	if len(fw.moves) != 0 || fw.timer != nil {
+		t.Fatal("pending moves left", fw.moves)
+	}
+}
@@ -0,0 +1,53 @@
+/*
+ * @Description: 事件循环的日志:每个事件循环有一个进程内唯一的ID,输出的日志都带有loop字段
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-23 10:35:02
+ * @LastEditTime: 2021-08-23 14:58:44
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	logger "Reactloop/Utils/Log"
+	"sync/atomic"
+)
+
+// 上一个创建的事件循环的ID
+var lastLoopID int64
+
+/**
+ * @description:事件循环的ID,从1开始递增
+ * @param {*}
+ * @return {*}
+ */
+func (el *EventLoop) ID() int {
+	return el.id
+}
+
+/**
+ * @description:设置日志输出,需要在Run之前调用;默认不输出日志
+ * @param {logger.Logger} l 为nil时不输出日志
+ * @return {*}
+ */
+func (el *EventLoop) SetLogger(l logger.Logger) {
+	if l == nil {
+		l = logger.Nop
+	}
+	el.logger = logger.With(l, logger.Loop(el.id))
+	el.Selector.SetLogger(el.logger)
+}
+
+/**
+ * @description:事件循环的日志输出,带有loop字段;Socket等模块通过它输出与连接相关的日志
+ * @param {*}
+ * @return {*}
+ */
+func (el *EventLoop) Logger() logger.Logger {
+	return el.logger
+}
+
+func nextLoopID() int {
+	return int(atomic.AddInt64(&lastLoopID, 1))
+}
@@ -0,0 +1,64 @@
+/*
+ * @Description: 事件循环日志测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-23 13:41:07
+ * @LastEditTime: 2021-08-23 14:15:36
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	enum "Reactloop/Utils/Enum"
+	logger "Reactloop/Utils/Log"
+	"testing"
+)
+
+type entry struct {
+	level  logger.Level
+	msg    string
+	fields map[string]interface{}
+}
+
+type recorder struct {
+	entries []entry
+}
+
+func (r *recorder) Enabled(logger.Level) bool { return true }
+
+func (r *recorder) Log(level logger.Level, msg string, fields ...logger.Field) {
+	e := entry{level: level, msg: msg, fields: map[string]interface{}{}}
+	for _, f := range fields {
+		e.fields[f.Key] = f.Value
+	}
+	r.entries = append(r.entries, e)
+}
+
+type loggedConn struct {
+	fakeConn
+}
+
+func (c *loggedConn) LogFields() []logger.Field {
+	return []logger.Field{logger.Fd(9), logger.Remote("10.0.0.1:4000")}
+}
+
+func TestPanicLogged(t *testing.T) {
+	el := New()
+	other := New()
+	if other.ID() != el.ID()+1 {
+		t.Fatal("loop ids should be sequential", el.ID(), other.ID())
+	}
+	rec := &recorder{}
+	el.SetLogger(rec)
+	el.AddSystemEvent(&Event{Data: func(el *EventLoop, p *interface{}) { panic("boom") }})
+	el.Trigger(enum.TRIGGER_DATA_EVENT, &loggedConn{})
+	if len(rec.entries) != 1 {
+		t.Fatal(rec.entries)
+	}
+	e := rec.entries[0]
+	if e.level != logger.ERROR || e.fields["panic"] != "boom" || e.fields["loop"] != el.ID() ||
+		e.fields["fd"] != 9 || e.fields["remote"] != "10.0.0.1:4000" || e.fields["stack"] == nil {
+		t.Fatalf("%+v", e)
+	}
+}
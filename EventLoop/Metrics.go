@@ -0,0 +1,106 @@
+/*
+ * @Description: 事件循环的指标:epoll唤醒次数、每次唤醒的事件数、各类回调的耗时以及定时任务的延迟,
+ *  没有开启指标时loopMetrics为nil,所有方法都是空操作
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-21 11:02:47
+ * @LastEditTime: 2021-08-21 15:10:26
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	"Reactloop/Metrics"
+	"time"
+)
+
+// 回调耗时指标中callback标签的取值
+const (
+	callbackOpen  = iota //Open回调
+	callbackData         //Data回调
+	callbackClose        //Close回调
+	callbackIO           //fd就绪后的处理函数(读写/accept/Watch等)
+	callbackTask         //用户事件和定时任务
+	callbackKinds
+)
+
+var callbackNames = [callbackKinds]string{"open", "data", "close", "io", "task"}
+
+type loopMetrics struct {
+	wakeups   *Metrics.Counter
+	events    *Metrics.Histogram
+	timerLag  *Metrics.Histogram
+	iteration *Metrics.Histogram
+	callbacks [callbackKinds]*Metrics.Histogram
+}
+
+/**
+ * @description:开启事件循环的指标采集,指标带有loop="name"标签
+ * @param {*Metrics.Registry} reg 为nil时使用Metrics.Default
+ * @param {string} name
+ * @return {*}
+ */
+func (el *EventLoop) EnableMetrics(reg *Metrics.Registry, name string) {
+	if reg == nil {
+		reg = Metrics.Default
+	}
+	labels := Metrics.Labels{"loop": name}
+	m := &loopMetrics{
+		wakeups: reg.Counter("reactloop_loop_wakeups_total",
+			"Number of times epoll_wait returned.", labels),
+		events: reg.Histogram("reactloop_loop_events_per_poll",
+			"Number of ready events returned by one epoll_wait.", Metrics.CountBuckets, labels),
+		timerLag: reg.Histogram("reactloop_loop_timer_lag_seconds",
+			"Delay between a timer's scheduled time and when it actually ran.", Metrics.LatencyBuckets, labels),
+		iteration: reg.Histogram("reactloop_loop_iteration_seconds",
+			"Time spent handling ready events and due timers in one loop iteration.", Metrics.LatencyBuckets, labels),
+	}
+	for kind, kindName := range callbackNames {
+		m.callbacks[kind] = reg.Histogram("reactloop_loop_callback_duration_seconds",
+			"Time spent in callbacks on the loop.", Metrics.LatencyBuckets,
+			Metrics.Labels{"loop": name, "callback": kindName})
+	}
+	el.metrics = m
+}
+
+// 记录一次epoll返回
+func (m *loopMetrics) poll(n int) {
+	if m == nil {
+		return
+	}
+	m.wakeups.Inc()
+	m.events.Observe(float64(n))
+}
+
+// 回调开始的时间,没有开启指标时不取时间
+func (m *loopMetrics) start() time.Time {
+	if m == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// 记录一次回调的耗时
+func (m *loopMetrics) observe(kind int, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.callbacks[kind].ObserveDuration(time.Since(start))
+}
+
+// 记录一轮循环的耗时
+func (m *loopMetrics) iterated(d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.iteration.ObserveDuration(d)
+}
+
+// 记录定时任务实际执行时间与预定时间的差
+func (m *loopMetrics) lag(scheduled, now time.Time) {
+	if m == nil {
+		return
+	}
+	m.timerLag.ObserveDuration(now.Sub(scheduled))
+}
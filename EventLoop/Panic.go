@@ -0,0 +1,113 @@
+/*
+ * @Description: 用户回调的panic隔离:每个回调都在recover保护下执行,panic时交给PanicHandler处理,
+ *  只关闭触发该回调的连接,事件循环和其他连接不受影响
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-17 10:15:40
+ * @LastEditTime: 2021-08-17 17:26:53
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	err "Reactloop/Utils/Error"
+	logger "Reactloop/Utils/Log"
+	"runtime/debug"
+)
+
+/**
+ * @description:事件的来源(如Socket.Conn),回调panic后通过CloseWithError关闭它
+ * @param {*}
+ * @return {*}
+ */
+type EventSource interface {
+	CloseWithError(reason error)
+}
+
+/**
+ * @description:回调panic时的处理函数,返回后事件循环关闭src(关闭原因为CALLBACK_PANIC_ERR)
+ * @param {*EventLoop} el
+ * @param {interface{}} value recover得到的值
+ * @param {[]byte} stack panic时的调用栈
+ * @param {EventSource} src 触发回调的连接,定时任务等没有来源的回调为nil
+ * @return {*}
+ */
+type PanicHandler func(el *EventLoop, value interface{}, stack []byte, src EventSource)
+
+/**
+ * @description:设置panic处理函数,为nil时使用默认处理(以ERROR级别把panic的值和调用栈输出到Logger)
+ * @param {PanicHandler} handler
+ * @return {*}
+ */
+func (el *EventLoop) SetPanicHandler(handler PanicHandler) {
+	el.panicHandler = handler
+}
+
+/**
+ * @description:设置当前事件的来源,processAction结束后清空;由返回TRIGGER_*的事件处理函数调用
+ * @param {EventSource} src
+ * @return {*}
+ */
+func (el *EventLoop) SetEventSource(src EventSource) {
+	el.source = src
+}
+
+/**
+ * @description:当前事件的来源:没有显式设置时,触发指针中的数据本身实现了EventSource则使用它;
+ *  可以在Open回调中通过它拿到连接(Open的触发数据只是连接信息)
+ * @param {*}
+ * @return {*}
+ */
+func (el *EventLoop) Source() EventSource {
+	if el.source != nil {
+		return el.source
+	}
+	if el.triger_data_ptr != nil {
+		if src, ok := (*el.triger_data_ptr).(EventSource); ok {
+			return src
+		}
+	}
+	return nil
+}
+
+/**
+ * @description:在recover保护下执行回调
+ * @param {EventSource} src
+ * @param {func()} fn
+ * @return {*} 回调是否发生了panic
+ */
+func (el *EventLoop) protect(src EventSource, fn func()) (panicked bool) {
+	defer func() {
+		if value := recover(); value != nil {
+			panicked = true
+			el.handlePanic(value, src)
+		}
+	}()
+	fn()
+	return false
+}
+
+func (el *EventLoop) handlePanic(value interface{}, src EventSource) {
+	stack := debug.Stack()
+	if el.panicHandler != nil {
+		// panic处理函数自身panic时只记录,不能再让它影响事件循环
+		func() {
+			defer func() {
+				if v := recover(); v != nil {
+					el.logger.Log(logger.ERROR, "EventLoop-handlePanic:panic处理函数发生panic", logger.F("panic", v))
+				}
+			}()
+			el.panicHandler(el, value, stack, src)
+		}()
+	} else {
+		fields := []logger.Field{logger.F("panic", value), logger.F("stack", string(stack))}
+		if f, ok := src.(logger.Fielder); ok {
+			fields = append(fields, f.LogFields()...)
+		}
+		el.logger.Log(logger.ERROR, "EventLoop-handlePanic:回调发生panic", fields...)
+	}
+	if src != nil {
+		src.CloseWithError(&err.CALLBACK_PANIC_ERR{Value: value})
+	}
+}
@@ -0,0 +1,76 @@
+/*
+ * @Description: 回调panic隔离测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-17 15:48:02
+ * @LastEditTime: 2021-08-17 17:20:15
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	enum "Reactloop/Utils/Enum"
+	err "Reactloop/Utils/Error"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeConn struct {
+	reason error
+}
+
+func (c *fakeConn) CloseWithError(reason error) {
+	c.reason = reason
+}
+
+func TestPanicIsolation(t *testing.T) {
+	el := New()
+	var (
+		gotValue interface{}
+		gotSrc   EventSource
+		gotStack string
+		after    int
+	)
+	el.SetPanicHandler(func(el *EventLoop, value interface{}, stack []byte, src EventSource) {
+		gotValue, gotSrc, gotStack = value, src, string(stack)
+	})
+	el.AddSystemEvent(&Event{Data: func(el *EventLoop, p *interface{}) {
+		panic("boom")
+	}})
+	el.AddSystemEvent(&Event{Data: func(el *EventLoop, p *interface{}) {
+		after++
+	}})
+	conn := &fakeConn{}
+	el.Trigger(enum.TRIGGER_DATA_EVENT, conn)
+	if gotValue != "boom" || gotSrc != conn || !strings.Contains(gotStack, "TestPanicIsolation") {
+		t.Fatalf("value %v src %v", gotValue, gotSrc)
+	}
+	if e, ok := conn.reason.(*err.CALLBACK_PANIC_ERR); !ok || e.Value != "boom" {
+		t.Fatal("offending conn should be closed", conn.reason)
+	}
+	if after != 0 {
+		t.Fatal("remaining callbacks should be skipped for the closed conn")
+	}
+
+	// Open的触发数据不是连接本身,通过TriggerFrom指定来源
+	other := &fakeConn{}
+	el.AddSystemEvent(&Event{Open: func(el *EventLoop, p *interface{}) {
+		panic("open")
+	}})
+	el.TriggerFrom(other, enum.TRIGGER_OPEN_EVENT, []string{"tcp4", "127.0.0.1", "1"})
+	if other.reason == nil || gotSrc != other {
+		t.Fatal("open panic should close its source")
+	}
+
+	ran := false
+	el.AddTimer(0, func(el *EventLoop, _ *interface{}) { panic("task") })
+	el.AddTimer(time.Millisecond, func(el *EventLoop, _ *interface{}) { ran = true })
+	for i := 0; i < 10 && !ran; i++ {
+		el.TikTok()
+	}
+	if !ran || gotValue != "task" || gotSrc != nil {
+		t.Fatal("loop should survive a panicking task", gotValue)
+	}
+}
@@ -0,0 +1,218 @@
+/*
+ * @Description: 阻塞任务的工作池:回调中把会阻塞的操作(如数据库查询)交给固定数量的goroutine执行,
+ *  结果通过Post回到事件循环中交付,不阻塞其他连接;队列长度有上限,每个任务可以设置超时
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-18 10:26:03
+ * @LastEditTime: 2021-08-18 17:52:41
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	err "Reactloop/Utils/Error"
+	"context"
+	"time"
+)
+
+/**
+ * @description:工作池设置
+ *  Workers:工作goroutine的数量,0时为1
+ *  QueueSize:等待执行的任务数上限,超过时Submit返回POOL_FULL_ERR;0时等于Workers
+ *  Timeout:任务默认的超时时间,0表示不限制
+ * @param {*}
+ * @return {*}
+ */
+type PoolConfig struct {
+	Workers   int
+	QueueSize int
+	Timeout   time.Duration
+}
+
+/**
+ * @description:在工作goroutine中执行的阻塞任务,超时或者工作池关闭时ctx被取消
+ * @param {context.Context} ctx
+ * @return {*}
+ */
+type Job func(ctx context.Context) (interface{}, error)
+
+/**
+ * @description:任务结果回调,在事件循环中执行;超时时err为JOB_TIMEOUT_ERR,任务之后返回的结果被丢弃
+ * @param {*EventLoop} el
+ * @param {interface{}} result
+ * @param {error} err
+ * @return {*}
+ */
+type JobDone func(el *EventLoop, result interface{}, err error)
+
+// 一个提交的任务
+type poolJob struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	job      Job
+	done     JobDone
+	timer    *UserEvent
+	finished bool //是否已经交付了结果,只在事件循环中读写
+}
+
+// Pool 绑定在事件循环上的工作池,Submit和Close需要在事件循环所在的goroutine中调用
+type Pool struct {
+	el      *EventLoop
+	cfg     PoolConfig
+	jobs    chan *poolJob
+	closed  bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	pending int //已经提交、还没有交付结果的任务数
+}
+
+/**
+ * @description:创建工作池并启动工作goroutine
+ * @param {PoolConfig} cfg
+ * @return {*}
+ */
+func (el *EventLoop) NewPool(cfg PoolConfig) *Pool {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = cfg.Workers
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{el: el, cfg: cfg, jobs: make(chan *poolJob, cfg.QueueSize), ctx: ctx, cancel: cancel}
+	for i := 0; i < cfg.Workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+/**
+ * @description:提交任务,使用默认超时
+ * @param {Job} job
+ * @param {JobDone} done
+ * @return {*} 队列已满时为POOL_FULL_ERR,工作池已关闭时为POOL_CLOSED_ERR,此时done不会被调用
+ */
+func (p *Pool) Submit(job Job, done JobDone) error {
+	return p.SubmitTimeout(p.cfg.Timeout, job, done)
+}
+
+/**
+ * @description:提交任务并指定超时
+ * @param {time.Duration} timeout 0表示不限制
+ * @param {Job} job
+ * @param {JobDone} done
+ * @return {*}
+ */
+func (p *Pool) SubmitTimeout(timeout time.Duration, job Job, done JobDone) error {
+	if p.closed {
+		return &err.POOL_CLOSED_ERR{}
+	}
+	j := &poolJob{job: job, done: done}
+	if timeout > 0 {
+		j.ctx, j.cancel = context.WithTimeout(p.ctx, timeout)
+	} else {
+		j.ctx, j.cancel = context.WithCancel(p.ctx)
+	}
+	select {
+	case p.jobs <- j:
+	default:
+		j.cancel()
+		return &err.POOL_FULL_ERR{Size: p.cfg.QueueSize}
+	}
+	p.pending++
+	if timeout > 0 {
+		// 任务可能忽略ctx一直不返回,超时由事件循环的定时器保证
+		j.timer = p.el.AddTimer(timeout, func(el *EventLoop, _ *interface{}) {
+			j.timer = nil
+			p.finish(j, nil, &err.JOB_TIMEOUT_ERR{After: timeout})
+		})
+	}
+	return nil
+}
+
+/**
+ * @description:排队中和执行中的任务数
+ * @param {*}
+ * @return {*}
+ */
+func (p *Pool) Pending() int {
+	return p.pending
+}
+
+/**
+ * @description:关闭工作池:不再接受新任务,已经排队的任务仍会执行并交付结果
+ * @param {*}
+ * @return {*}
+ */
+func (p *Pool) Close() {
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.jobs)
+}
+
+/**
+ * @description:关闭工作池并取消所有任务的ctx,还没有交付结果的任务收到context.Canceled
+ * @param {*}
+ * @return {*}
+ */
+func (p *Pool) Shutdown() {
+	p.Close()
+	p.cancel()
+}
+
+// 工作goroutine
+func (p *Pool) work() {
+	for j := range p.jobs {
+		var (
+			result interface{}
+			errs   error
+		)
+		if errs = j.ctx.Err(); errs == nil {
+			result, errs = p.run(j)
+		}
+		j.cancel()
+		job := j
+		if p.el.Post(func(el *EventLoop) { p.finish(job, result, errs) }) != nil {
+			return
+		}
+	}
+}
+
+// 执行任务,任务panic时作为错误交付
+func (p *Pool) run(j *poolJob) (result interface{}, errs error) {
+	defer func() {
+		if value := recover(); value != nil {
+			result, errs = nil, &err.CALLBACK_PANIC_ERR{Value: value}
+		}
+	}()
+	return j.job(j.ctx)
+}
+
+/**
+ * @description:在事件循环中交付结果,每个任务只交付一次(超时与任务返回先到者生效)
+ * @param {*poolJob} j
+ * @param {interface{}} result
+ * @param {error} errs
+ * @return {*}
+ */
+func (p *Pool) finish(j *poolJob, result interface{}, errs error) {
+	if j.finished {
+		return
+	}
+	j.finished = true
+	p.pending--
+	if j.timer != nil {
+		p.el.RemoveUserEvent(j.timer)
+		j.timer = nil
+	}
+	j.cancel()
+	if errs == context.DeadlineExceeded {
+		errs = &err.JOB_TIMEOUT_ERR{}
+	}
+	if j.done != nil {
+		p.el.protect(nil, func() { j.done(p.el, result, errs) })
+	}
+}
@@ -0,0 +1,87 @@
+/*
+ * @Description: 工作池测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-18 16:02:40
+ * @LastEditTime: 2021-08-18 17:48:13
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	err "Reactloop/Utils/Error"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	el := New()
+	pool := el.NewPool(PoolConfig{Workers: 1, QueueSize: 1})
+	defer pool.Shutdown()
+	release := make(chan struct{})
+	results := []interface{}{}
+	done := func(el *EventLoop, result interface{}, errs error) {
+		if errs != nil {
+			results = append(results, errs)
+			return
+		}
+		results = append(results, result)
+	}
+	// 第一个任务占住唯一的worker,第二个排队,第三个超出队列长度
+	if e := pool.Submit(func(ctx context.Context) (interface{}, error) {
+		<-release
+		return "first", nil
+	}, done); e != nil {
+		t.Fatal(e)
+	}
+	for i := 0; i < 100 && len(pool.jobs) > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if e := pool.SubmitTimeout(20*time.Millisecond, func(ctx context.Context) (interface{}, error) {
+		return "never", nil
+	}, done); e != nil {
+		t.Fatal(e)
+	}
+	if _, ok := pool.Submit(func(ctx context.Context) (interface{}, error) { return nil, nil }, done).(*err.POOL_FULL_ERR); !ok {
+		t.Fatal("expected POOL_FULL_ERR")
+	}
+	// 排队中的任务超时,在事件循环中收到超时错误
+	for i := 0; i < 100 && len(results) == 0; i++ {
+		el.TikTok()
+	}
+	if len(results) != 1 {
+		t.Fatalf("results %v", results)
+	}
+	if _, ok := results[0].(*err.JOB_TIMEOUT_ERR); !ok {
+		t.Fatalf("expected timeout, got %v", results[0])
+	}
+	close(release)
+	for i := 0; i < 100 && pool.Pending() > 0; i++ {
+		el.TikTok()
+	}
+	if len(results) != 2 || results[1] != "first" {
+		t.Fatalf("results %v", results)
+	}
+	pool.Close()
+	if _, ok := pool.Submit(nil, done).(*err.POOL_CLOSED_ERR); !ok {
+		t.Fatal("expected POOL_CLOSED_ERR")
+	}
+}
+
+func TestPostFromGoroutine(t *testing.T) {
+	el := New()
+	got := 0
+	go func() {
+		for i := 0; i < 10; i++ {
+			el.Post(func(el *EventLoop) { got++ })
+		}
+	}()
+	for i := 0; i < 100 && got < 10; i++ {
+		el.TikTok()
+	}
+	if got != 10 {
+		t.Fatalf("got %d", got)
+	}
+}
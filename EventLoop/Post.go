@@ -0,0 +1,93 @@
+/*
+ * @Description: 从其他goroutine向事件循环投递任务:任务放入加锁的队列,再通过注册在Selector中的eventfd唤醒事件循环
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-18 09:47:26
+ * @LastEditTime: 2021-08-18 14:33:10
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	enum "Reactloop/Utils/Enum"
+	err "Reactloop/Utils/Error"
+	"sync"
+	"syscall"
+)
+
+const (
+	efdNonblock = syscall.O_NONBLOCK
+	efdCloexec  = syscall.O_CLOEXEC
+)
+
+// 跨goroutine投递的任务队列
+type postQueue struct {
+	fd    int   //eventfd,创建失败或者关闭后为-1
+	err   error //fd为-1的原因
+	mu    sync.Mutex
+	tasks []func(el *EventLoop)
+}
+
+/**
+ * @description:创建eventfd并注册到Selector
+ * @param {*}
+ * @return {*}
+ */
+func (el *EventLoop) initPost() {
+	el.posted = &postQueue{fd: -1}
+	fd, _, errno := syscall.Syscall(syscall.SYS_EVENTFD2, 0, efdNonblock|efdCloexec, 0)
+	if errno != 0 {
+		el.posted.err = err.Syscall("eventfd", errno)
+		return
+	}
+	if errs := el.RegisterEvent(int(fd), enum.EVENT_READABLE, el.runPosted, nil); errs != nil {
+		syscall.Close(int(fd))
+		el.posted.err = errs
+		return
+	}
+	el.posted.fd = int(fd)
+}
+
+/**
+ * @description:在事件循环中执行fn,可以在任意goroutine中调用;fn按投递的顺序执行
+ * @param {func(el *EventLoop)} fn
+ * @return {*}
+ */
+func (el *EventLoop) Post(fn func(el *EventLoop)) error {
+	q := el.posted
+	// 持有锁写eventfd,避免Close同时关闭fd
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.fd < 0 {
+		return q.err
+	}
+	q.tasks = append(q.tasks, fn)
+	// eventfd的计数加1,事件循环读出计数后重置;计数溢出时(EAGAIN)已经处于可读状态,可以忽略
+	one := [8]byte{1}
+	if _, errs := syscall.Write(q.fd, one[:]); errs != nil && errs != syscall.EAGAIN {
+		return err.Syscall("eventfd write", errs)
+	}
+	return nil
+}
+
+/**
+ * @description:eventfd可读:取出所有投递的任务并执行
+ * @param {*EventLoop} el
+ * @param {interface{}} _
+ * @return {*}
+ */
+func (el *EventLoop) runPosted(_ *EventLoop, _ interface{}) enum.Action {
+	q := el.posted
+	buf := [8]byte{}
+	syscall.Read(q.fd, buf[:])
+	q.mu.Lock()
+	tasks := q.tasks
+	q.tasks = nil
+	q.mu.Unlock()
+	for _, task := range tasks {
+		fn := task
+		el.protect(nil, func() { fn(el) })
+	}
+	return enum.CONTINUE
+}
@@ -0,0 +1,389 @@
+/*
+ * @Description: 在事件循环中管理子进程:stdin/stdout/stderr使用注册在Selector中的非阻塞管道,
+ *  输出分块通过回调交付,退出状态通过pidfd(不支持时使用SIGCHLD)获取
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-15 10:12:45
+ * @LastEditTime: 2021-08-15 18:36:02
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	enum "Reactloop/Utils/Enum"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+const (
+	sysPidfdOpen   = 434 //pidfd_open,Linux 5.3开始支持,各架构的调用号相同
+	processReadBuf = 64 * 1024
+)
+
+/**
+ * @description:启动子进程的参数
+ *  Args与exec.Cmd一样包含argv[0],为空时使用Path;Env为nil时继承当前进程的环境变量
+ *  Stdin为false时子进程的标准输入为/dev/null;OnStdout/OnStderr为nil时对应的输出丢弃到/dev/null
+ *  OnExit在进程退出并且stdout/stderr都读到EOF之后调用,之后不会再有输出回调
+ * @param {*}
+ * @return {*}
+ */
+type ProcessSpec struct {
+	Path     string
+	Args     []string
+	Env      []string
+	Dir      string
+	Stdin    bool
+	OnStdout func(p *Process, chunk []byte)
+	OnStderr func(p *Process, chunk []byte)
+	OnExit   func(p *Process, status syscall.WaitStatus)
+}
+
+// Process 事件循环中运行的一个子进程,所有方法都需要在事件循环所在的goroutine中调用
+type Process struct {
+	el         *EventLoop
+	spec       ProcessSpec
+	pid        int
+	stdin      *Watcher
+	inBuf      []byte //等待写入stdin的数据
+	closeStdin bool   //inBuf写完后关闭stdin
+	stdout     *Watcher
+	stderr     *Watcher
+	pidfd      *Watcher
+	exited     bool
+	status     syscall.WaitStatus
+	finished   bool   //是否已经调用过OnExit
+	readBuf    []byte //stdout/stderr共用的读缓冲,按需分配一次
+}
+
+/**
+ * @description:启动子进程
+ * @param {ProcessSpec} spec
+ * @return {*}
+ */
+func (el *EventLoop) StartProcess(spec ProcessSpec) (*Process, error) {
+	path := spec.Path
+	if !strings.Contains(path, "/") {
+		found, err := exec.LookPath(path)
+		if err != nil {
+			return nil, err
+		}
+		path = found
+	}
+	args := spec.Args
+	if len(args) == 0 {
+		args = []string{spec.Path}
+	}
+	env := spec.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	var (
+		files   = make([]*os.File, 3) //子进程的0,1,2
+		parents = make([]int, 3)      //父进程持有的管道端,-1表示没有
+	)
+	closeAll := func() {
+		for _, f := range files {
+			if f != nil {
+				f.Close()
+			}
+		}
+	}
+	closeParents := func() {
+		for _, fd := range parents {
+			if fd >= 0 {
+				syscall.Close(fd)
+			}
+		}
+	}
+	piped := []bool{spec.Stdin, spec.OnStdout != nil, spec.OnStderr != nil}
+	for i, pipe := range piped {
+		parents[i] = -1
+		if !pipe {
+			flag := os.O_WRONLY
+			if i == 0 {
+				flag = os.O_RDONLY
+			}
+			f, err := os.OpenFile(os.DevNull, flag, 0)
+			if err != nil {
+				closeAll()
+				closeParents()
+				return nil, err
+			}
+			files[i] = f
+			continue
+		}
+		p := make([]int, 2)
+		if err := syscall.Pipe2(p, syscall.O_CLOEXEC); err != nil {
+			closeAll()
+			closeParents()
+			return nil, err
+		}
+		// stdin:子进程读、父进程写;stdout/stderr:子进程写、父进程读
+		child, parent := p[1], p[0]
+		if i == 0 {
+			child, parent = p[0], p[1]
+		}
+		files[i] = os.NewFile(uintptr(child), "")
+		parents[i] = parent
+	}
+	proc, err := os.StartProcess(path, args, &os.ProcAttr{Dir: spec.Dir, Env: env, Files: files})
+	closeAll()
+	if err != nil {
+		closeParents()
+		return nil, err
+	}
+	p := &Process{el: el, spec: spec, pid: proc.Pid}
+	proc.Release()
+	if err := p.watch(parents); err != nil {
+		closeParents()
+		syscall.Kill(p.pid, syscall.SIGKILL)
+		syscall.Wait4(p.pid, nil, 0, nil)
+		return nil, err
+	}
+	return p, nil
+}
+
+/**
+ * @description:把管道和进程退出注册到事件循环
+ * @param {[]int} fds 父进程持有的stdin/stdout/stderr管道端
+ * @return {*}
+ */
+func (p *Process) watch(fds []int) error {
+	var err error
+	if fds[0] >= 0 {
+		if p.stdin, err = p.el.Watch(fds[0], enum.EVENT_NONE, p.onStdin); err != nil {
+			return err
+		}
+	}
+	if fds[1] >= 0 {
+		if p.stdout, err = p.el.Watch(fds[1], enum.EVENT_READABLE, p.onOutput); err != nil {
+			p.stopAll()
+			return err
+		}
+	}
+	if fds[2] >= 0 {
+		if p.stderr, err = p.el.Watch(fds[2], enum.EVENT_READABLE, p.onOutput); err != nil {
+			p.stopAll()
+			return err
+		}
+	}
+	if err = p.watchExit(); err != nil {
+		p.stopAll()
+	}
+	return err
+}
+
+func (p *Process) stopAll() {
+	for _, w := range []*Watcher{p.stdin, p.stdout, p.stderr, p.pidfd} {
+		if w != nil {
+			w.Stop()
+		}
+	}
+}
+
+/**
+ * @description:优先使用pidfd监听进程退出,内核不支持时退回到SIGCHLD
+ * @param {*}
+ * @return {*}
+ */
+func (p *Process) watchExit() error {
+	fd, _, errno := syscall.Syscall(sysPidfdOpen, uintptr(p.pid), 0, 0)
+	if errno == 0 {
+		w, err := p.el.Watch(int(fd), enum.EVENT_READABLE, func(el *EventLoop, w *Watcher, _ uint32) {
+			p.reap()
+		})
+		if err == nil {
+			p.pidfd = w
+			return nil
+		}
+		syscall.Close(int(fd))
+	}
+	el := p.el
+	if el.children == nil {
+		if err := el.OnSignal(el.reapChildren, syscall.SIGCHLD); err != nil {
+			return err
+		}
+		el.children = map[int]*Process{}
+	}
+	el.children[p.pid] = p
+	// 子进程可能在开始处理SIGCHLD之前就已经退出
+	el.AddTimer(0, func(el *EventLoop, _ *interface{}) {
+		el.reapChildren(el, syscall.SIGCHLD)
+	})
+	return nil
+}
+
+// 收到SIGCHLD:多个子进程的退出可能合并为一个信号,需要逐个检查
+func (el *EventLoop) reapChildren(_ *EventLoop, _ os.Signal) {
+	for _, p := range el.children {
+		p.reap()
+	}
+}
+
+/**
+ * @description:回收已经退出的子进程
+ * @param {*}
+ * @return {*}
+ */
+func (p *Process) reap() {
+	if p.exited {
+		return
+	}
+	var status syscall.WaitStatus
+	pid, err := syscall.Wait4(p.pid, &status, syscall.WNOHANG, nil)
+	if err != nil || pid != p.pid {
+		return
+	}
+	p.exited, p.status = true, status
+	if p.pidfd != nil {
+		p.pidfd.Stop()
+		syscall.Close(p.pidfd.Fd())
+		p.pidfd = nil
+	}
+	delete(p.el.children, p.pid)
+	p.checkFinished()
+}
+
+/**
+ * @description:stdout/stderr可读:读入进程共用的缓冲,只把读到的字节拷贝出来交付,读到EOF时关闭管道
+ * @param {*EventLoop} el
+ * @param {*Watcher} w
+ * @param {uint32} _
+ * @return {*}
+ */
+func (p *Process) onOutput(el *EventLoop, w *Watcher, _ uint32) {
+	if p.readBuf == nil {
+		p.readBuf = make([]byte, processReadBuf)
+	}
+	n, err := syscall.Read(w.Fd(), p.readBuf)
+	if err == syscall.EAGAIN || err == syscall.EINTR {
+		return
+	}
+	if n > 0 {
+		chunk := make([]byte, n)
+		copy(chunk, p.readBuf[:n])
+		if w == p.stdout {
+			p.spec.OnStdout(p, chunk)
+		} else {
+			p.spec.OnStderr(p, chunk)
+		}
+		return
+	}
+	w.Stop()
+	syscall.Close(w.Fd())
+	if w == p.stdout {
+		p.stdout = nil
+	} else {
+		p.stderr = nil
+	}
+	p.checkFinished()
+}
+
+// 进程退出且输出都读完后调用OnExit
+func (p *Process) checkFinished() {
+	if p.finished || !p.exited || p.stdout != nil || p.stderr != nil {
+		return
+	}
+	p.finished = true
+	p.closeStdinNow()
+	if p.spec.OnExit != nil {
+		p.spec.OnExit(p, p.status)
+	}
+}
+
+/**
+ * @description:子进程的pid
+ * @param {*}
+ * @return {*}
+ */
+func (p *Process) Pid() int {
+	return p.pid
+}
+
+/**
+ * @description:进程是否已经退出以及退出状态
+ * @param {*}
+ * @return {*}
+ */
+func (p *Process) Exited() (bool, syscall.WaitStatus) {
+	return p.exited, p.status
+}
+
+/**
+ * @description:向子进程发送信号
+ * @param {syscall.Signal} sig
+ * @return {*}
+ */
+func (p *Process) Signal(sig syscall.Signal) error {
+	if p.exited {
+		return syscall.ESRCH
+	}
+	return syscall.Kill(p.pid, sig)
+}
+
+/**
+ * @description:向子进程的stdin写数据,数据先进入缓冲区,管道可写时写出;需要ProcessSpec.Stdin为true
+ * @param {[]byte} data
+ * @return {*}
+ */
+func (p *Process) Write(data []byte) error {
+	if p.stdin == nil || p.closeStdin {
+		return syscall.EPIPE
+	}
+	p.inBuf = append(p.inBuf, data...)
+	return p.stdin.Modify(enum.EVENT_WRITABLE)
+}
+
+/**
+ * @description:缓冲区中的数据写完后关闭stdin,子进程会读到EOF
+ * @param {*}
+ * @return {*}
+ */
+func (p *Process) CloseStdin() {
+	if p.stdin == nil {
+		return
+	}
+	p.closeStdin = true
+	if len(p.inBuf) == 0 {
+		p.closeStdinNow()
+	}
+}
+
+func (p *Process) closeStdinNow() {
+	if p.stdin == nil {
+		return
+	}
+	p.stdin.Stop()
+	syscall.Close(p.stdin.Fd())
+	p.stdin, p.inBuf = nil, nil
+}
+
+/**
+ * @description:stdin可写:写出缓冲区,写完后停止关注写事件;子进程关闭了stdin时丢弃剩余数据
+ * @param {*EventLoop} el
+ * @param {*Watcher} w
+ * @param {uint32} _
+ * @return {*}
+ */
+func (p *Process) onStdin(el *EventLoop, w *Watcher, _ uint32) {
+	n, err := syscall.Write(w.Fd(), p.inBuf)
+	if err == syscall.EAGAIN || err == syscall.EINTR {
+		return
+	}
+	if err != nil {
+		p.closeStdinNow()
+		return
+	}
+	p.inBuf = p.inBuf[n:]
+	if len(p.inBuf) > 0 {
+		return
+	}
+	w.Modify(enum.EVENT_NONE)
+	if p.closeStdin {
+		p.closeStdinNow()
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ * @Description: 子进程管理测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-15 16:40:11
+ * @LastEditTime: 2021-08-15 18:30:27
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestProcess(t *testing.T) {
+	el := New()
+	stdout, stderr := []byte{}, []byte{}
+	exitCode := -1
+	p, err := el.StartProcess(ProcessSpec{
+		Path:  "sh",
+		Args:  []string{"sh", "-c", "read x; echo out:$x; echo err >&2; exit 3"},
+		Stdin: true,
+		OnStdout: func(p *Process, chunk []byte) {
+			stdout = append(stdout, chunk...)
+		},
+		OnStderr: func(p *Process, chunk []byte) {
+			stderr = append(stderr, chunk...)
+		},
+		OnExit: func(p *Process, status syscall.WaitStatus) {
+			exitCode = status.ExitStatus()
+			el.Done()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Write([]byte("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+	p.CloseStdin()
+	for i := 0; i < 100 && !el.done; i++ {
+		el.TikTok()
+	}
+	if string(stdout) != "out:hello\n" || string(stderr) != "err\n" || exitCode != 3 {
+		t.Fatalf("stdout %q stderr %q exit %d", stdout, stderr, exitCode)
+	}
+	if exited, _ := p.Exited(); !exited || p.Signal(syscall.SIGTERM) != syscall.ESRCH {
+		t.Fatal("process should be reaped")
+	}
+}
+
+func TestProcessOutputChunks(t *testing.T) {
+	el := New()
+	chunks := [][]byte{}
+	_, err := el.StartProcess(ProcessSpec{
+		Path: "sh",
+		Args: []string{"sh", "-c", "echo first; sleep 0.1; echo second"},
+		OnStdout: func(p *Process, chunk []byte) {
+			if cap(chunk) != len(chunk) {
+				t.Errorf("chunk cap %d len %d", cap(chunk), len(chunk))
+			}
+			chunks = append(chunks, chunk)
+		},
+		OnExit: func(p *Process, status syscall.WaitStatus) {
+			el.Done()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100 && !el.done; i++ {
+		el.TikTok()
+	}
+	joined := ""
+	for _, chunk := range chunks {
+		joined += string(chunk)
+	}
+	if len(chunks) < 2 || joined != "first\nsecond\n" {
+		t.Fatalf("chunks %q", chunks)
+	}
+}
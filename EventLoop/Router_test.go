@@ -0,0 +1,48 @@
+/*
+ * @Description: 按事件来源分发回调集合测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-20 10:12:31
+ * @LastEditTime: 2021-08-20 11:05:47
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	enum "Reactloop/Utils/Enum"
+	"testing"
+)
+
+type routedConn struct {
+	fakeConn
+	events []*Event
+}
+
+func (c *routedConn) Events() []*Event {
+	return c.events
+}
+
+func TestEventRouter(t *testing.T) {
+	el := New()
+	trace := []string{}
+	el.AddSystemEvent(&Event{Data: func(el *EventLoop, p *interface{}) { trace = append(trace, "global") }})
+	admin := &routedConn{events: []*Event{
+		{Data: func(el *EventLoop, p *interface{}) { trace = append(trace, "admin1") }},
+		{Data: func(el *EventLoop, p *interface{}) { trace = append(trace, "admin2") }},
+	}}
+	plain := &routedConn{}
+
+	el.Trigger(enum.TRIGGER_DATA_EVENT, admin)
+	el.Trigger(enum.TRIGGER_DATA_EVENT, plain)
+	el.Trigger(enum.TRIGGER_DATA_EVENT, &fakeConn{})
+	want := []string{"admin1", "admin2", "global", "global"}
+	if len(trace) != len(want) {
+		t.Fatal(trace)
+	}
+	for i := range want {
+		if trace[i] != want[i] {
+			t.Fatal(trace)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+/*
+ * @Description: 在事件循环中处理信号:信号通过一个注册在Selector中的管道(self-pipe)转发到事件循环,
+ *  处理函数在事件循环所在的goroutine中执行,不需要和事件循环竞争done等状态
+ *  没有使用signalfd:Go运行时会在任意线程上接收信号,signalfd只能收到在所有线程中都被屏蔽的信号,
+ *  而Go程序无法可靠地在运行时创建的全部线程上屏蔽信号
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-12 09:41:15
+ * @LastEditTime: 2021-08-12 16:20:37
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	enum "Reactloop/Utils/Enum"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+/**
+ * @description:信号处理函数,在事件循环中执行
+ * @param {*EventLoop} el
+ * @param {os.Signal} sig
+ * @return {*}
+ */
+type SignalHandler func(el *EventLoop, sig os.Signal)
+
+// 事件循环的信号转发状态
+type signalState struct {
+	r, w     int //管道的读端(注册在Selector中)和写端
+	ch       chan os.Signal
+	handlers map[syscall.Signal][]SignalHandler
+}
+
+/**
+ * @description:收到sigs中任意一个信号时在事件循环中执行handler,同一个信号可以注册多个处理函数,按注册顺序执行;
+ *  注册后这些信号不再执行默认动作(如SIGTERM不再直接结束进程)
+ * @param {SignalHandler} handler
+ * @param {...os.Signal} sigs
+ * @return {*}
+ */
+func (el *EventLoop) OnSignal(handler SignalHandler, sigs ...os.Signal) error {
+	if el.signals == nil {
+		if err := el.startSignals(); err != nil {
+			return err
+		}
+	}
+	for _, sig := range sigs {
+		s, ok := sig.(syscall.Signal)
+		if !ok {
+			continue
+		}
+		el.signals.handlers[s] = append(el.signals.handlers[s], handler)
+	}
+	signal.Notify(el.signals.ch, sigs...)
+	return nil
+}
+
+/**
+ * @description:创建管道并注册到Selector,启动转发信号的goroutine
+ * @param {*}
+ * @return {*}
+ */
+func (el *EventLoop) startSignals() error {
+	p := make([]int, 2)
+	if err := syscall.Pipe2(p, syscall.O_NONBLOCK|syscall.O_CLOEXEC); err != nil {
+		return err
+	}
+	s := &signalState{
+		r:        p[0],
+		w:        p[1],
+		ch:       make(chan os.Signal, 16),
+		handlers: map[syscall.Signal][]SignalHandler{},
+	}
+	if err := el.RegisterEvent(s.r, enum.EVENT_READABLE, el.readSignals, nil); err != nil {
+		syscall.Close(s.r)
+		syscall.Close(s.w)
+		return err
+	}
+	el.signals = s
+	go func() {
+		for sig := range s.ch {
+			// 管道满时丢弃:还没有处理的同一信号会合并,和内核对标准信号的处理一致
+			syscall.Write(s.w, []byte{byte(sig.(syscall.Signal))})
+		}
+		syscall.Close(s.w)
+	}()
+	return nil
+}
+
+/**
+ * @description:管道可读:取出信号并依次执行处理函数
+ * @param {*EventLoop} el
+ * @param {interface{}} _
+ * @return {*}
+ */
+func (el *EventLoop) readSignals(_ *EventLoop, _ interface{}) enum.Action {
+	buf := [64]byte{}
+	n, err := syscall.Read(el.signals.r, buf[:])
+	if err != nil || n <= 0 {
+		return enum.CONTINUE
+	}
+	for _, b := range buf[:n] {
+		sig := syscall.Signal(b)
+		for _, handler := range el.signals.handlers[sig] {
+			el.protect(nil, func() { handler(el, sig) })
+		}
+	}
+	return enum.CONTINUE
+}
+
+/**
+ * @description:停止在事件循环中处理信号,恢复信号的默认动作
+ * @param {*}
+ * @return {*}
+ */
+func (el *EventLoop) StopSignals() {
+	s := el.signals
+	if s == nil {
+		return
+	}
+	signal.Stop(s.ch)
+	close(s.ch)
+	el.UnRegisterEvent(s.r, enum.EVENT_READABLE)
+	syscall.Close(s.r)
+	el.signals = nil
+}
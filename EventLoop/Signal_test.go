@@ -0,0 +1,65 @@
+/*
+ * @Description: 信号处理测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-12 15:02:26
+ * @LastEditTime: 2021-08-12 16:18:40
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestOnSignal(t *testing.T) {
+	el := New()
+	got := []os.Signal{}
+	handler := func(el *EventLoop, sig os.Signal) {
+		got = append(got, sig)
+		if sig == syscall.SIGUSR2 {
+			el.Done()
+		}
+	}
+	if err := el.OnSignal(handler, syscall.SIGUSR1, syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	defer el.StopSignals()
+	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	for i := 0; i < 20 && len(got) == 0; i++ {
+		el.TikTok()
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGUSR2)
+	for i := 0; i < 20 && !el.done; i++ {
+		el.TikTok()
+	}
+	if len(got) != 2 || got[0] != syscall.SIGUSR1 || got[1] != syscall.SIGUSR2 {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestOnSignalPanic(t *testing.T) {
+	el := New()
+	panics := 0
+	el.SetPanicHandler(func(el *EventLoop, value interface{}, stack []byte, src EventSource) {
+		panics++
+	})
+	got := 0
+	if err := el.OnSignal(func(el *EventLoop, sig os.Signal) { panic("boom") }, syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	if err := el.OnSignal(func(el *EventLoop, sig os.Signal) { got++ }, syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	defer el.StopSignals()
+	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	for i := 0; i < 20 && got == 0; i++ {
+		el.TikTok()
+	}
+	if got != 1 || panics != 1 {
+		t.Fatalf("got %d, panics %d", got, panics)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * @Description: 用户事件(周期任务与定时任务)的最小堆,按下一次触发时间排序;
+ *  每个连接都可能挂着超时、限速、PROXY协议头等定时器,查找最近的任务为O(1),添加和移除为O(log n)
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-27 14:20:31
+ * @LastEditTime: 2021-08-27 16:05:48
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import "container/heap"
+
+// 按NexttriggerTime排序的最小堆,实现heap.Interface
+type timerHeap []*UserEvent
+
+func (h timerHeap) Len() int {
+	return len(h)
+}
+
+func (h timerHeap) Less(i, j int) bool {
+	return h[i].NexttriggerTime.Before(h[j].NexttriggerTime)
+}
+
+func (h timerHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i + 1
+	h[j].index = j + 1
+}
+
+func (h *timerHeap) Push(x interface{}) {
+	ue := x.(*UserEvent)
+	ue.index = len(*h) + 1
+	*h = append(*h, ue)
+}
+
+func (h *timerHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	ue := old[n-1]
+	old[n-1] = nil
+	ue.index = 0
+	*h = old[:n-1]
+	return ue
+}
+
+/**
+ * @description:加入堆,已经在堆中时按新的触发时间调整位置
+ * @param {*UserEvent} ue
+ * @return {*}
+ */
+func (h *timerHeap) add(ue *UserEvent) {
+	if ue.index > 0 {
+		heap.Fix(h, ue.index-1)
+		return
+	}
+	heap.Push(h, ue)
+}
+
+/**
+ * @description:从堆中移除,不在堆中时返回false
+ * @param {*UserEvent} ue
+ * @return {*}
+ */
+func (h *timerHeap) remove(ue *UserEvent) bool {
+	if ue.index <= 0 || ue.index > len(*h) || (*h)[ue.index-1] != ue {
+		return false
+	}
+	heap.Remove(h, ue.index-1)
+	return true
+}
+
+// 触发时间最早的任务,堆为空时返回nil
+func (h timerHeap) peek() *UserEvent {
+	if len(h) == 0 {
+		return nil
+	}
+	return h[0]
+}
@@ -0,0 +1,69 @@
+/*
+ * @Description: 定时任务测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-27 10:12:40
+ * @LastEditTime: 2021-08-27 10:48:15
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRemoveInSameTick(t *testing.T) {
+	el := New()
+	var b *UserEvent
+	fired := []string{}
+	el.AddTimer(0, func(el *EventLoop, _ *interface{}) {
+		fired = append(fired, "a")
+		el.RemoveUserEvent(b)
+	})
+	b = el.AddTimer(0, func(el *EventLoop, _ *interface{}) {
+		fired = append(fired, "b")
+	})
+	time.Sleep(time.Millisecond)
+	el.TikTok()
+	el.TikTok()
+	if len(fired) != 1 || fired[0] != "a" {
+		t.Fatalf("fired %v, removed timer must not run", fired)
+	}
+	if len(el.user_events) != 0 {
+		t.Fatalf("%d timers left", len(el.user_events))
+	}
+}
+
+func TestTimerHeapOrder(t *testing.T) {
+	el := New()
+	var fired []int
+	timers := make([]*UserEvent, 0, 20)
+	for i := 0; i < 20; i++ {
+		i := i
+		delay := time.Duration((i*7)%20) * time.Millisecond
+		timers = append(timers, el.AddTimer(delay, func(el *EventLoop, _ *interface{}) {
+			fired = append(fired, (i*7)%20)
+		}))
+	}
+	// 移除一部分定时器,堆中的位置需要保持正确
+	for i := 0; i < 20; i += 3 {
+		el.RemoveUserEvent(timers[i])
+	}
+	if len(el.user_events) != 13 {
+		t.Fatalf("%d timers in heap", len(el.user_events))
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(el.user_events) > 0 && time.Now().Before(deadline) {
+		el.TikTok()
+	}
+	if len(fired) != 13 {
+		t.Fatalf("fired %v", fired)
+	}
+	for i := 1; i < len(fired); i++ {
+		if fired[i] < fired[i-1] {
+			t.Fatalf("timers fired out of order: %v", fired)
+		}
+	}
+}
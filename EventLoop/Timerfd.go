@@ -0,0 +1,107 @@
+/*
+ * @Description: 基于timerfd的高精度定时器:epoll_wait的超时只能精确到毫秒,开启后由注册在Selector中的
+ *  timerfd在最近的定时任务到期时唤醒事件循环,精度可以达到微秒级
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-13 10:22:08
+ * @LastEditTime: 2021-08-13 15:47:31
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	enum "Reactloop/Utils/Enum"
+	err "Reactloop/Utils/Error"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	clockMonotonic = 1
+	tfdNonblock    = syscall.O_NONBLOCK
+	tfdCloexec     = syscall.O_CLOEXEC
+)
+
+// timerfd_settime的参数
+type itimerspec struct {
+	interval syscall.Timespec
+	value    syscall.Timespec
+}
+
+/**
+ * @description:开启或关闭高精度定时器,每个EventLoop单独选择;默认关闭,定时任务按毫秒精度触发
+ * @param {bool} on
+ * @return {*}
+ */
+func (el *EventLoop) SetHighResTimers(on bool) error {
+	if on == (el.timerfd >= 0) {
+		return nil
+	}
+	if !on {
+		el.UnRegisterEvent(el.timerfd, enum.EVENT_READABLE)
+		syscall.Close(el.timerfd)
+		el.timerfd = -1
+		return nil
+	}
+	fd, _, errno := syscall.Syscall(syscall.SYS_TIMERFD_CREATE, clockMonotonic, tfdNonblock|tfdCloexec, 0)
+	if errno != 0 {
+		return err.Syscall("timerfd_create", errno)
+	}
+	if err := el.RegisterEvent(int(fd), enum.EVENT_READABLE, el.readTimerfd, nil); err != nil {
+		syscall.Close(int(fd))
+		return err
+	}
+	el.timerfd = int(fd)
+	return nil
+}
+
+/**
+ * @description:设置timerfd在d之后触发一次,d为0时取消
+ * @param {time.Duration} d
+ * @return {*}
+ */
+func (el *EventLoop) armTimerfd(d time.Duration) error {
+	spec := itimerspec{}
+	if d > 0 {
+		spec.value = syscall.NsecToTimespec(int64(d))
+	}
+	_, _, errno := syscall.Syscall6(syscall.SYS_TIMERFD_SETTIME, uintptr(el.timerfd), 0,
+		uintptr(unsafe.Pointer(&spec)), 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+/**
+ * @description:timerfd到期:读出到期次数清除可读状态,到期的任务在Poll之后统一执行
+ * @param {*EventLoop} el
+ * @param {interface{}} _
+ * @return {*}
+ */
+func (el *EventLoop) readTimerfd(_ *EventLoop, _ interface{}) enum.Action {
+	buf := [8]byte{}
+	syscall.Read(el.timerfd, buf[:])
+	return enum.CONTINUE
+}
+
+/**
+ * @description:计算epoll_wait的超时(毫秒):开启高精度定时器时由timerfd负责唤醒,
+ *  否则向上取整,避免提前醒来后空转到任务到期
+ * @param {time.Duration} sleepTime 距离最近的任务到期的时间
+ * @param {bool} hasTask 是否有等待执行的任务
+ * @return {*}
+ */
+func (el *EventLoop) pollTimeout(sleepTime time.Duration, hasTask bool) int {
+	if hasTask && el.timerfd >= 0 {
+		if sleepTime <= 0 {
+			return 0
+		}
+		if el.armTimerfd(sleepTime) == nil {
+			return -1
+		}
+	}
+	return int((sleepTime + time.Millisecond - 1) / time.Millisecond)
+}
@@ -0,0 +1,51 @@
+/*
+ * @Description: 高精度定时器测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-13 14:55:10
+ * @LastEditTime: 2021-08-13 15:40:02
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHighResTimers(t *testing.T) {
+	el := New()
+	if err := el.SetHighResTimers(true); err != nil {
+		t.Fatal(err)
+	}
+	defer el.SetHighResTimers(false)
+	var fired time.Time
+	start := time.Now()
+	el.AddTimer(300*time.Microsecond, func(el *EventLoop, _ *interface{}) {
+		fired = time.Now()
+	})
+	ticks := 0
+	for fired.IsZero() && ticks < 100 {
+		el.TikTok()
+		ticks++
+	}
+	elapsed := fired.Sub(start)
+	if elapsed < 300*time.Microsecond || elapsed > 50*time.Millisecond {
+		t.Fatalf("timer fired after %v", elapsed)
+	}
+	// 等待期间阻塞在epoll_wait中,而不是空转
+	if ticks > 3 {
+		t.Fatalf("loop spun %d times", ticks)
+	}
+}
+
+func TestPollTimeoutRoundsUp(t *testing.T) {
+	el := New()
+	if ms := el.pollTimeout(1500*time.Microsecond, true); ms != 2 {
+		t.Fatalf("timeout %dms", ms)
+	}
+	if ms := el.pollTimeout(0, true); ms != 0 {
+		t.Fatalf("timeout %dms", ms)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ * @Description: 监听任意非阻塞fd(管道、eventfd、inotify、终端等),把套接字之外的I/O接入同一个事件循环
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-14 09:30:52
+ * @LastEditTime: 2021-08-14 16:05:13
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	enum "Reactloop/Utils/Enum"
+	"syscall"
+)
+
+/**
+ * @description:fd就绪时的回调,在事件循环中执行
+ * @param {*EventLoop} el
+ * @param {*Watcher} w
+ * @param {uint32} events 就绪的事件:EVENT_READABLE/EVENT_WRITABLE/EVENT_HANGUP/EVENT_ERROR的组合
+ * @return {*}
+ */
+type WatchHandler func(el *EventLoop, w *Watcher, events uint32)
+
+/**
+ * @description:一个被监听的fd
+ *  所有权:fd始终归调用方所有,Watcher不会关闭它;关闭fd之前必须先调用Stop,
+ *  否则Selector中会残留该fd的记录,之后复用同一个fd号时注册会失败
+ *  触发方式为水平触发:回调没有把数据读完(或者没有写满)时下一轮会再次触发
+ * @param {*}
+ * @return {*}
+ */
+type Watcher struct {
+	el       *EventLoop
+	fd       int
+	interest uint32
+	handler  WatchHandler
+}
+
+/**
+ * @description:开始监听fd,fd会被设置为非阻塞(该标志与dup得到的fd共享);
+ *  普通文件和目录总是就绪,epoll不支持,返回的错误匹配syscall.EPERM(errors.Is)
+ * @param {int} fd
+ * @param {uint32} interest EVENT_READABLE、EVENT_WRITABLE或者两者的组合
+ * @param {WatchHandler} handler
+ * @return {*}
+ */
+func (el *EventLoop) Watch(fd int, interest uint32, handler WatchHandler) (*Watcher, error) {
+	// 是否支持epoll由内核判断(注册时返回EPERM),不能根据文件类型判断:如新内核中pidfd的类型就是普通文件
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		return nil, err
+	}
+	w := &Watcher{el: el, fd: fd, handler: handler}
+	if err := w.Modify(interest); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+/**
+ * @description:监听的fd
+ * @param {*}
+ * @return {*}
+ */
+func (w *Watcher) Fd() int {
+	return w.fd
+}
+
+/**
+ * @description:修改关注的事件,EVENT_NONE表示暂时不关注(Watcher仍然有效,可以再次Modify)
+ * @param {uint32} interest
+ * @return {*}
+ */
+func (w *Watcher) Modify(interest uint32) error {
+	interest &= enum.EVENT_READABLE | enum.EVENT_WRITABLE
+	if interest == w.interest {
+		return nil
+	}
+	if interest == enum.EVENT_NONE {
+		w.el.UnRegisterEvent(w.fd, w.interest)
+		w.interest = interest
+		return nil
+	}
+	if err := w.el.RegisterEvent(w.fd, interest, w.dispatch, nil); err != nil {
+		return err
+	}
+	w.interest = interest
+	return nil
+}
+
+/**
+ * @description:停止监听,之后调用方可以关闭fd
+ * @param {*}
+ * @return {*}
+ */
+func (w *Watcher) Stop() {
+	w.Modify(enum.EVENT_NONE)
+}
+
+// 把epoll的就绪事件转换为EVENT_*标志后调用回调
+func (w *Watcher) dispatch(el *EventLoop, data interface{}) enum.Action {
+	ready := data.(EventData).ready
+	events := uint32(0)
+	if ready&syscall.EPOLLIN != 0 {
+		events |= enum.EVENT_READABLE
+	}
+	if ready&syscall.EPOLLOUT != 0 {
+		events |= enum.EVENT_WRITABLE
+	}
+	if ready&syscall.EPOLLHUP != 0 {
+		events |= enum.EVENT_HANGUP
+	}
+	if ready&syscall.EPOLLERR != 0 {
+		events |= enum.EVENT_ERROR
+	}
+	w.handler(el, w, events)
+	return enum.CONTINUE
+}
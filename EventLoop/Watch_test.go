@@ -0,0 +1,72 @@
+/*
+ * @Description: 监听任意fd的测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-14 14:12:37
+ * @LastEditTime: 2021-08-14 15:58:20
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	enum "Reactloop/Utils/Enum"
+	"errors"
+	"io/ioutil"
+	"syscall"
+	"testing"
+)
+
+func TestWatchPipe(t *testing.T) {
+	p := make([]int, 2)
+	if err := syscall.Pipe(p); err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(p[0])
+	el := New()
+	got := []byte{}
+	hangup := false
+	w, err := el.Watch(p[0], enum.EVENT_READABLE, func(el *EventLoop, w *Watcher, events uint32) {
+		buf := make([]byte, 16)
+		if n, _ := syscall.Read(w.Fd(), buf); n > 0 {
+			got = append(got, buf[:n]...)
+		}
+		if events&enum.EVENT_HANGUP != 0 {
+			hangup = true
+			w.Stop()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writable := 0
+	ww, err := el.Watch(p[1], enum.EVENT_WRITABLE, func(el *EventLoop, w *Watcher, events uint32) {
+		writable++
+		syscall.Write(w.Fd(), []byte("hi"))
+		w.Stop()
+		syscall.Close(w.Fd())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10 && !hangup; i++ {
+		el.TikTok()
+	}
+	if string(got) != "hi" || writable != 1 || !hangup {
+		t.Fatalf("got %q writable %d hangup %v", got, writable, hangup)
+	}
+	if w.interest != enum.EVENT_NONE || ww.interest != enum.EVENT_NONE {
+		t.Fatal("watchers should be stopped")
+	}
+}
+
+func TestWatchRegularFile(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := New().Watch(int(f.Fd()), enum.EVENT_READABLE, nil); !errors.Is(err, syscall.EPERM) {
+		t.Fatal("expected EPERM, got", err)
+	}
+}
@@ -0,0 +1,258 @@
+/*
+ * @Description: 事件循环卡顿检测:统计每轮循环的耗时和定时任务的延迟,
+ *  看门狗goroutine定期检查当前回调的运行时间,超过预算时带上事件循环goroutine的调用栈上报
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-22 10:14:36
+ * @LastEditTime: 2021-08-22 15:47:03
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	logger "Reactloop/Utils/Log"
+	"bytes"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * @description:事件循环的运行统计,只能在事件循环中读取
+ * @param {*}
+ * @return {*}
+ */
+type LoopStats struct {
+	Iterations    uint64        //TikTok执行的轮数
+	LastIteration time.Duration //上一轮处理就绪事件和到期任务的耗时(不包含epoll等待)
+	MaxIteration  time.Duration
+	LastTimerLag  time.Duration //上一个定时任务实际执行时间与预定时间的差
+	MaxTimerLag   time.Duration
+}
+
+/**
+ * @description:一次卡顿的信息
+ * @param {*}
+ * @return {*}
+ */
+type Stall struct {
+	Callback string        //卡住的回调类型:open/data/close/io/task
+	Elapsed  time.Duration //发现时回调已经运行的时间
+	Budget   time.Duration
+	Stack    []byte //发现时事件循环goroutine的调用栈
+}
+
+/**
+ * @description:卡顿处理函数,在看门狗goroutine中调用,此时回调仍在事件循环中运行,不能访问事件循环的状态
+ * @param {Stall} stall
+ * @return {*}
+ */
+type StallHandler func(stall Stall)
+
+type watchdog struct {
+	budget  time.Duration
+	handler StallHandler
+	gid     atomic.Value //事件循环goroutine调用栈的首行前缀,如"goroutine 7 "
+	next    uint64       //下一个回调的序号,只在事件循环中使用
+	seq     uint64       //当前回调的序号(原子访问),0表示没有回调在运行
+	start   int64        //当前回调开始的时间(UnixNano,原子访问)
+	kind    int32        //当前回调的类型(原子访问)
+	stop    chan struct{}
+}
+
+// 回调开始前的状态,嵌套的回调结束后恢复外层回调
+type callbackFrame struct {
+	start time.Time
+	seq   uint64
+	begin int64
+	kind  int32
+}
+
+/**
+ * @description:开启看门狗:单个回调运行超过budget时调用handler(为nil时输出到事件循环的Logger);
+ *  budget<=0时关闭;看门狗goroutine在Run返回时退出
+ * @param {time.Duration} budget
+ * @param {StallHandler} handler
+ * @return {*}
+ */
+func (el *EventLoop) SetWatchdog(budget time.Duration, handler StallHandler) {
+	if el.watchdog != nil {
+		close(el.watchdog.stop)
+		el.watchdog = nil
+	}
+	if budget <= 0 {
+		return
+	}
+	if handler == nil {
+		handler = el.logStall
+	}
+	w := &watchdog{budget: budget, handler: handler, stop: make(chan struct{})}
+	w.gid.Store("")
+	el.watchdog = w
+	go w.run()
+}
+
+/**
+ * @description:事件循环的运行统计
+ * @param {*}
+ * @return {*}
+ */
+func (el *EventLoop) Stats() LoopStats {
+	return el.stats
+}
+
+func (el *EventLoop) logStall(stall Stall) {
+	el.logger.Log(logger.WARN, "EventLoop-watchdog:回调运行时间超过预算",
+		logger.F("callback", stall.Callback), logger.F("elapsed", stall.Elapsed),
+		logger.F("budget", stall.Budget), logger.F("stack", string(stall.Stack)))
+}
+
+/**
+ * @description:回调开始:记录看门狗检查的状态,开启指标时记录开始时间
+ * @param {int} kind
+ * @return {*}
+ */
+func (el *EventLoop) enter(kind int) callbackFrame {
+	frame := callbackFrame{start: el.metrics.start()}
+	w := el.watchdog
+	if w == nil {
+		return frame
+	}
+	frame.seq, frame.begin, frame.kind = atomic.LoadUint64(&w.seq), atomic.LoadInt64(&w.start), atomic.LoadInt32(&w.kind)
+	w.next++
+	atomic.StoreInt64(&w.start, time.Now().UnixNano())
+	atomic.StoreInt32(&w.kind, int32(kind))
+	atomic.StoreUint64(&w.seq, w.next)
+	return frame
+}
+
+/**
+ * @description:回调结束:恢复外层回调的状态,开启指标时记录耗时
+ * @param {int} kind
+ * @param {callbackFrame} frame enter的返回值
+ * @return {*}
+ */
+func (el *EventLoop) leave(kind int, frame callbackFrame) {
+	el.metrics.observe(kind, frame.start)
+	w := el.watchdog
+	if w == nil {
+		return
+	}
+	atomic.StoreUint64(&w.seq, 0)
+	atomic.StoreInt64(&w.start, frame.begin)
+	atomic.StoreInt32(&w.kind, frame.kind)
+	atomic.StoreUint64(&w.seq, frame.seq)
+}
+
+/**
+ * @description:记录当前goroutine为事件循环goroutine,看门狗只输出它的调用栈
+ * @param {*}
+ * @return {*}
+ */
+func (w *watchdog) bind() {
+	if w.gid.Load().(string) != "" {
+		return
+	}
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	if i := bytes.IndexByte(buf, '['); i > 0 {
+		w.gid.Store(string(buf[:i]))
+	}
+}
+
+/**
+ * @description:看门狗goroutine:每budget/4检查一次,同一个回调只上报一次
+ * @param {*}
+ * @return {*}
+ */
+func (w *watchdog) run() {
+	interval := w.budget / 4
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var reported uint64
+	for {
+		select {
+		case <-w.stop:
+			return
+		case now := <-ticker.C:
+			seq := atomic.LoadUint64(&w.seq)
+			start, kind := atomic.LoadInt64(&w.start), atomic.LoadInt32(&w.kind)
+			// 读取过程中回调发生了切换
+			if seq == 0 || seq == reported || seq != atomic.LoadUint64(&w.seq) {
+				continue
+			}
+			elapsed := now.Sub(time.Unix(0, start))
+			if elapsed <= w.budget {
+				continue
+			}
+			reported = seq
+			w.handler(Stall{
+				Callback: callbackNames[kind],
+				Elapsed:  elapsed,
+				Budget:   w.budget,
+				Stack:    w.loopStack(),
+			})
+		}
+	}
+}
+
+/**
+ * @description:事件循环goroutine的调用栈,找不到时返回所有goroutine的调用栈
+ * @param {*}
+ * @return {*}
+ */
+func (w *watchdog) loopStack() []byte {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	gid := w.gid.Load().(string)
+	if gid == "" {
+		return buf
+	}
+	for _, block := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.HasPrefix(block, []byte(gid)) {
+			return block
+		}
+	}
+	return buf
+}
+
+/**
+ * @description:一轮TikTok结束,更新循环耗时
+ * @param {time.Time} start 本轮epoll返回的时间
+ * @return {*}
+ */
+func (el *EventLoop) iterationDone(start time.Time) {
+	d := time.Since(start)
+	el.stats.Iterations++
+	el.stats.LastIteration = d
+	if d > el.stats.MaxIteration {
+		el.stats.MaxIteration = d
+	}
+	el.metrics.iterated(d)
+}
+
+/**
+ * @description:记录定时任务的延迟
+ * @param {time.Time} scheduled
+ * @param {time.Time} now
+ * @return {*}
+ */
+func (el *EventLoop) timerFired(scheduled, now time.Time) {
+	lag := now.Sub(scheduled)
+	el.stats.LastTimerLag = lag
+	if lag > el.stats.MaxTimerLag {
+		el.stats.MaxTimerLag = lag
+	}
+	el.metrics.lag(scheduled, now)
+}
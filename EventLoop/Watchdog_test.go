@@ -0,0 +1,57 @@
+/*
+ * @Description: 卡顿检测测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-22 14:05:51
+ * @LastEditTime: 2021-08-22 15:30:22
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package EventLoop
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func slowTask(d time.Duration) {
+	time.Sleep(d)
+}
+
+func TestWatchdog(t *testing.T) {
+	el := New()
+	stalls := make(chan Stall, 4)
+	el.SetWatchdog(20*time.Millisecond, func(s Stall) { stalls <- s })
+	defer el.SetWatchdog(0, nil)
+	el.AddTimer(0, func(el *EventLoop, _ *interface{}) { slowTask(100 * time.Millisecond) })
+	el.AddTimer(0, func(el *EventLoop, _ *interface{}) {})
+	for i := 0; i < 5 && el.Stats().MaxIteration == 0; i++ {
+		el.TikTok()
+	}
+	select {
+	case s := <-stalls:
+		if s.Callback != "task" || s.Elapsed <= 20*time.Millisecond {
+			t.Fatalf("stall %s %v", s.Callback, s.Elapsed)
+		}
+		// 只输出事件循环goroutine的调用栈
+		if !strings.Contains(string(s.Stack), "slowTask") || strings.Count(string(s.Stack), "\ngoroutine ") != 0 {
+			t.Fatalf("stack\n%s", s.Stack)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watchdog did not report the slow task")
+	}
+	select {
+	case s := <-stalls:
+		t.Fatal("the same callback should be reported once", s.Callback)
+	case <-time.After(50 * time.Millisecond):
+	}
+	stats := el.Stats()
+	if stats.Iterations == 0 || stats.MaxIteration < 100*time.Millisecond {
+		t.Fatalf("stats %+v", stats)
+	}
+	// 第二个定时任务排在慢任务之后执行
+	if stats.LastTimerLag < 100*time.Millisecond || stats.MaxTimerLag != stats.LastTimerLag {
+		t.Fatalf("timer lag %+v", stats)
+	}
+}
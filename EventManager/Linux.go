@@ -12,13 +12,14 @@ package EventManager
 import (
 	enum "Reactloop/Utils/Enum"
 	err "Reactloop/Utils/Error"
-	"log"
+	logger "Reactloop/Utils/Log"
 	"syscall"
 )
 
 type Selector struct {
 	epfd          int //epoll返回的fd
 	selectorykeys []*SelectorKey
+	logger        logger.Logger
 }
 
 // 存放保存的事件的fd(如socket的fd)
@@ -31,31 +32,48 @@ type SelectorKey struct {
 /**
  * @description: 创建一个Selector监控所有socket
  * @param  {*}
- * @return {*}
+ * @return {*} 创建epoll失败时返回SYSCALL_ERR(如fd耗尽时匹配ErrFDLimit)
  * @param {int} size epoll监听队列的大小
  */
-func New(size int) *Selector {
-	epfd, err := syscall.EpollCreate(size)
-	if err != nil {
-		log.Panic(err.Error())
-		return nil
+func New(size int) (*Selector, error) {
+	epfd, errs := syscall.EpollCreate(size)
+	if errs != nil {
+		return nil, err.Syscall("epoll_create", errs)
 	}
 	return &Selector{
 		epfd:          epfd,
 		selectorykeys: make([]*SelectorKey, size),
+		logger:        logger.Nop,
+	}, nil
+}
+
+// nil或者已经关闭的Selector上的操作都返回CLOSED_ERR
+func (p *Selector) closed() bool {
+	return p == nil || p.selectorykeys == nil
+}
+
+/**
+ * @description:设置日志输出
+ * @param {logger.Logger} l
+ * @return {*}
+ */
+func (p *Selector) SetLogger(l logger.Logger) {
+	if p != nil {
+		p.logger = l
 	}
 }
 
 /**
- * @description:关闭epoll
+ * @description:关闭epoll,之后Selector上的所有操作返回CLOSED_ERR
  * @param  {*}
  * @return {*}
  */
-func (p *Selector) Close() {
-	if err := syscall.Close(p.epfd); err != nil {
-		log.Panic(err)
+func (p *Selector) Close() error {
+	if p.closed() {
+		return &err.CLOSED_ERR{Op: "close"}
 	}
 	p.selectorykeys = nil
+	return err.Syscall("close", syscall.Close(p.epfd))
 }
 
 /**
@@ -72,19 +90,19 @@ func InitEpollEvent(selectorkey *SelectorKey, event_mask uint32, data interface{
 	epollevent := &syscall.EpollEvent{
 		Fd: int32(selectorkey.Fd),
 	}
-	switch {
-	case event_mask&enum.EVENT_READABLE != 0:
+	// 读写可以同时监听
+	if event_mask&enum.EVENT_READABLE != 0 {
 		epollevent.Events |= syscall.EPOLLIN
-		selectorkey.Data = data
-		// fallthrough 忽略case真假 强制往下执行
-	case event_mask&enum.EVENT_WRITABLE != 0:
+	}
+	if event_mask&enum.EVENT_WRITABLE != 0 {
 		epollevent.Events |= syscall.EPOLLOUT
-		selectorkey.Data = data
-	default:
+	}
+	if epollevent.Events == 0 {
 		return nil, &err.UNKNOW_MASK_ERR{
 			Mask: selectorkey.event_mask,
 		}
 	}
+	selectorkey.Data = data
 	return epollevent, nil
 }
 
@@ -97,7 +115,10 @@ func InitEpollEvent(selectorkey *SelectorKey, event_mask uint32, data interface{
  * @param {interface{}} Data
  */
 func (p *Selector) Register(fd int, event_mask uint32, Data interface{}) error {
-	if fd > len(p.selectorykeys) {
+	if p.closed() {
+		return &err.CLOSED_ERR{Op: "register"}
+	}
+	if fd >= len(p.selectorykeys) {
 		return &err.FD_EXEC_LIMIT_ERROR{
 			FD: fd,
 		}
@@ -110,6 +131,7 @@ func (p *Selector) Register(fd int, event_mask uint32, Data interface{}) error {
 		}
 	}
 	selectorkey := p.selectorykeys[fd]
+	old_mask, old_data := selectorkey.event_mask, selectorkey.Data
 
 	var op int
 	// 如果epoll中没有注册事件泽注册事件，否则修改对应事件
@@ -119,16 +141,24 @@ func (p *Selector) Register(fd int, event_mask uint32, Data interface{}) error {
 		op = syscall.EPOLL_CTL_MOD
 		// 需要更新Data
 	}
+	// 失败时恢复原来的记录
+	rollback := func() {
+		if op == syscall.EPOLL_CTL_ADD {
+			p.selectorykeys[fd] = nil
+		} else {
+			selectorkey.event_mask, selectorkey.Data = old_mask, old_data
+		}
+	}
 	selectorkey.event_mask = event_mask
-	epollevent, err := InitEpollEvent(selectorkey, event_mask, Data)
-	if err != nil {
-		log.Panic(err)
-		return err
+	epollevent, errs := InitEpollEvent(selectorkey, event_mask, Data)
+	if errs != nil {
+		rollback()
+		return errs
 	}
-	// 将epoll事件注册到内核
-	if err := syscall.EpollCtl(p.epfd, op, fd, epollevent); err != nil {
-		log.Panic(err)
-		return err
+	// 将epoll事件注册到内核,失败时(如普通文件不支持epoll)恢复原来的记录
+	if errs := syscall.EpollCtl(p.epfd, op, fd, epollevent); errs != nil {
+		rollback()
+		return err.Syscall("epoll_ctl", errs)
 	}
 	return nil
 }
@@ -141,25 +171,28 @@ func (p *Selector) Register(fd int, event_mask uint32, Data interface{}) error {
  * @param {uint32} event_mask
  */
 func (p *Selector) UnRegister(fd int, event_mask uint32) (*SelectorKey, error) {
-	if fd > len(p.selectorykeys) {
+	if p.closed() {
+		return nil, &err.CLOSED_ERR{Op: "unregister"}
+	}
+	if fd >= len(p.selectorykeys) {
 		return nil, &err.FD_EXEC_LIMIT_ERROR{
 			FD: fd,
 		}
 	}
 	selectorkey := p.selectorykeys[fd]
-	selectorkey.Data = nil
-	p.selectorykeys[fd] = nil
 	if selectorkey == nil || selectorkey.event_mask&event_mask == 0 {
-		log.Printf("EventManager.UnRegister:UnRegister failed,selectorkey or event do not exist!\n")
+		p.logger.Log(logger.DEBUG, "EventManager.UnRegister:fd没有注册该事件", logger.Fd(fd), logger.F("mask", event_mask))
 		return nil, nil
 	}
-	epollevent, err := InitEpollEvent(selectorkey, event_mask, nil)
-	if err != nil {
-		return nil, err
+	selectorkey.Data = nil
+	p.selectorykeys[fd] = nil
+	epollevent, errs := InitEpollEvent(selectorkey, event_mask, nil)
+	if errs != nil {
+		return nil, errs
 	}
 	op := syscall.EPOLL_CTL_DEL
-	if err := syscall.EpollCtl(p.epfd, op, fd, epollevent); err != nil {
-		return nil, err
+	if errs := syscall.EpollCtl(p.epfd, op, fd, epollevent); errs != nil {
+		return nil, err.Syscall("epoll_ctl", errs)
 	}
 	return selectorkey, nil
 }
@@ -171,6 +204,9 @@ func (p *Selector) UnRegister(fd int, event_mask uint32) (*SelectorKey, error) {
  * @param {int} fd socket对应的fd
  */
 func (p *Selector) GetData(fd int) interface{} {
+	if p.closed() || fd < 0 || fd >= len(p.selectorykeys) || p.selectorykeys[fd] == nil {
+		return nil
+	}
 	return p.selectorykeys[fd].Data
 }
 
@@ -183,16 +219,20 @@ func (p *Selector) GetData(fd int) interface{} {
 * @param {int} time 超时等待时间
 */
 func (p *Selector) Poll(time int) ([]*SelectorKey, []uint32, error) {
+	if p.closed() {
+		return nil, nil, &err.CLOSED_ERR{Op: "poll"}
+	}
 	events := make([]syscall.EpollEvent, len(p.selectorykeys))
-	n, err := syscall.EpollWait(p.epfd, events, time)
-	if err != nil {
-		return nil, nil, err
+	n, errs := syscall.EpollWait(p.epfd, events, time)
+	if errs != nil {
+		return nil, nil, err.Syscall("epoll_wait", errs)
 	}
 	var awake_event, mask = make([]*SelectorKey, n), make([]uint32, n)
 	for i := 0; i < n; i++ {
 		epoll_event := &events[i]
 		awake_event[i] = p.selectorykeys[epoll_event.Fd]
-
+		// 挂断和错误总是会上报,不需要注册
+		mask[i] |= epoll_event.Events & (syscall.EPOLLHUP | syscall.EPOLLERR)
 		if (epoll_event.Events&syscall.EPOLLERR != 0) && (epoll_event.Events&syscall.EPOLLRDHUP != 0) {
 			continue
 		}
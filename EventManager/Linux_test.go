@@ -11,13 +11,57 @@ package EventManager
 
 import (
 	enum "Reactloop/Utils/Enum"
+	err "Reactloop/Utils/Error"
+	"errors"
+	"syscall"
 	"testing"
 )
 
-func TestLinux(*testing.T) {
-	selector := New(100)
+func TestLinux(t *testing.T) {
+	selector, errs := New(100)
+	if errs != nil {
+		t.Fatal(errs)
+	}
 	selector.Register(1, enum.EVENT_READABLE, "hello")
 	selector.Poll(1)
 	selector.UnRegister(1, enum.EVENT_READABLE|enum.EVENT_WRITABLE)
 	selector.Close()
 }
+
+func TestSelectorErrors(t *testing.T) {
+	selector, errs := New(64)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	errs = selector.Register(64, enum.EVENT_READABLE, nil)
+	if !errors.Is(errs, err.ErrFDLimit) {
+		t.Fatal("fd beyond the selector should match ErrFDLimit", errs)
+	}
+	// 普通文件不支持epoll,失败后不能留下注册记录
+	f, errs := syscall.Open("/dev/null", syscall.O_RDONLY, 0)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	defer syscall.Close(f)
+	if f < 64 {
+		errs = selector.Register(f, enum.EVENT_READABLE, nil)
+		if !errors.Is(errs, syscall.EPERM) || selector.GetData(f) != nil {
+			t.Fatal(errs)
+		}
+	}
+	if errs := selector.Register(0, 0, nil); errs == nil || selector.GetData(0) != nil {
+		t.Fatal("bad mask should fail without registering", errs)
+	}
+	if errs := selector.Close(); errs != nil {
+		t.Fatal(errs)
+	}
+	if errs := selector.Close(); !errors.Is(errs, err.ErrClosed) || !errors.Is(errs, syscall.EBADF) {
+		t.Fatal(errs)
+	}
+	if _, _, errs := selector.Poll(0); !errors.Is(errs, err.ErrClosed) {
+		t.Fatal(errs)
+	}
+	if errs := selector.Register(1, enum.EVENT_READABLE, nil); !errors.Is(errs, err.ErrClosed) {
+		t.Fatal(errs)
+	}
+}
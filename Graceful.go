@@ -0,0 +1,234 @@
+/*
+ * @Description: 平滑重启:把监听套接字交给新进程(环境变量描述的继承fd,或者通过Unix域套接字SCM_RIGHTS传递),
+ *  新进程在StartServe时接管同地址的监听套接字,旧进程停止accept,等待已有连接处理完后退出
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-10 20:40:17
+ * @LastEditTime: 2021-08-10 23:02:35
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Reactloop
+
+import (
+	"Reactloop/EventLoop"
+	"Reactloop/Socket"
+	enum "Reactloop/Utils/Enum"
+	logger "Reactloop/Utils/Log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// EnvListenFds 描述继承得到的监听fd,格式为"network:address:port=fd,..."
+const EnvListenFds = "REACTLOOP_LISTEN_FDS"
+
+const drainCheckInterval = 100 * time.Millisecond
+
+// 继承得到、还没有被Listener接管的监听fd,key为Listener.Key()
+var inherited map[string]int
+
+/**
+ * @description:读取环境变量中描述的继承fd,读取后删除该环境变量,避免再传给孙进程
+ * @param {*}
+ * @return {*}
+ */
+func loadInheritedFromEnv() {
+	if inherited == nil {
+		inherited = map[string]int{}
+	}
+	value, ok := os.LookupEnv(EnvListenFds)
+	if !ok {
+		return
+	}
+	os.Unsetenv(EnvListenFds)
+	for _, item := range strings.Split(value, ",") {
+		i := strings.LastIndex(item, "=")
+		if i < 0 {
+			continue
+		}
+		fd, errs := strconv.Atoi(item[i+1:])
+		if errs != nil {
+			continue
+		}
+		syscall.CloseOnExec(fd)
+		inherited[item[:i]] = fd
+	}
+}
+
+/**
+ * @description:新进程启动时调用:连接旧进程ServeHandoff监听的Unix域套接字,接收它的监听fd,
+ *  之后StartServe会接管同地址的监听套接字;需要在StartServe之前调用
+ * @param {string} path 旧进程ServeHandoff使用的路径
+ * @return {*}
+ */
+func InheritFromSocket(path string) error {
+	loadInheritedFromEnv()
+	fd, errs := syscall.Socket(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if errs != nil {
+		return errs
+	}
+	defer syscall.Close(fd)
+	if errs := syscall.Connect(fd, &syscall.SockaddrUnix{Name: path}); errs != nil {
+		return errs
+	}
+	data, fds, errs := Socket.RecvFds(fd, 64*1024)
+	if errs != nil {
+		return errs
+	}
+	keys := strings.Split(string(data), "\n")
+	for i, fd := range fds {
+		if i < len(keys) && keys[i] != "" {
+			inherited[keys[i]] = fd
+		} else {
+			syscall.Close(fd)
+		}
+	}
+	return nil
+}
+
+/**
+ * @description:用继承得到的fd替换Listener自己创建的socket
+ * @param {*Socket.Listener} l
+ * @return {*}
+ */
+func adoptInherited(l *Socket.Listener) error {
+	fd, ok := inherited[l.Key()]
+	if !ok {
+		return nil
+	}
+	delete(inherited, l.Key())
+	if err := l.Adopt(fd); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+	return nil
+}
+
+// 关闭没有被任何Listener接管的继承fd
+func closeUnclaimed() {
+	for key, fd := range inherited {
+		syscall.Close(fd)
+		delete(inherited, key)
+	}
+}
+
+/**
+ * @description:启动新的进程(相同的可执行文件和参数)并把所有监听套接字交给它,然后开始Drain;
+ *  需要在事件循环所在的goroutine中调用(例如定时任务或者事件回调中)
+ * @param {time.Duration} drainTimeout 等待已有连接关闭的最长时间,0表示一直等待
+ * @return {*} 新进程的pid
+ */
+func (s *Server) Restart(drainTimeout time.Duration) (int, error) {
+	path, errs := os.Executable()
+	if errs != nil {
+		return 0, errs
+	}
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	descs := make([]string, 0, len(s.listeners))
+	for i, l := range s.listeners {
+		// ExtraFiles中的第i个文件在子进程中的fd为3+i
+		dup, errs := syscall.Dup(l.Fd())
+		if errs != nil {
+			closeFiles(cmd.ExtraFiles)
+			return 0, errs
+		}
+		cmd.ExtraFiles = append(cmd.ExtraFiles, os.NewFile(uintptr(dup), l.Key()))
+		descs = append(descs, l.Key()+"="+strconv.Itoa(3+i))
+	}
+	cmd.Env = append(os.Environ(), EnvListenFds+"="+strings.Join(descs, ","))
+	errs = cmd.Start()
+	closeFiles(cmd.ExtraFiles)
+	if errs != nil {
+		return 0, errs
+	}
+	go cmd.Wait()
+	s.el.Logger().Log(logger.INFO, "Server-Restart:新进程已启动", logger.F("pid", cmd.Process.Pid))
+	s.Drain(drainTimeout)
+	return cmd.Process.Pid, nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+/**
+ * @description:在path上监听Unix域套接字,新进程通过InheritFromSocket连接后把所有监听fd发给它,然后开始Drain
+ * @param {string} path
+ * @param {time.Duration} drainTimeout 等待已有连接关闭的最长时间,0表示一直等待
+ * @return {*}
+ */
+func (s *Server) ServeHandoff(path string, drainTimeout time.Duration) error {
+	fd, errs := syscall.Socket(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, 0)
+	if errs != nil {
+		return errs
+	}
+	os.Remove(path)
+	if errs := syscall.Bind(fd, &syscall.SockaddrUnix{Name: path}); errs != nil {
+		syscall.Close(fd)
+		return errs
+	}
+	if errs := syscall.Listen(fd, 1); errs != nil {
+		syscall.Close(fd)
+		return errs
+	}
+	return s.el.RegisterEvent(fd, enum.EVENT_READABLE, func(el *EventLoop.EventLoop, _ interface{}) enum.Action {
+		confd, _, errs := syscall.Accept4(fd, syscall.SOCK_CLOEXEC)
+		if errs != nil {
+			return enum.CONTINUE
+		}
+		defer syscall.Close(confd)
+		keys := make([]string, 0, len(s.listeners))
+		fds := make([]int, 0, len(s.listeners))
+		for _, l := range s.listeners {
+			keys = append(keys, l.Key())
+			fds = append(fds, l.Fd())
+		}
+		if errs := Socket.SendFds(confd, []byte(strings.Join(keys, "\n")), fds...); errs != nil {
+			el.Logger().Log(logger.WARN, "Server-ServeHandoff:发送监听套接字失败", logger.Err(errs))
+			return enum.CONTINUE
+		}
+		el.UnRegisterEvent(fd, enum.EVENT_READABLE)
+		syscall.Close(fd)
+		os.Remove(path)
+		s.Drain(drainTimeout)
+		return enum.CONTINUE
+	}, nil)
+}
+
+/**
+ * @description:停止accept,等待所有Listener上的连接关闭(或者超时)后结束事件循环
+ * @param {time.Duration} timeout 0表示一直等待
+ * @return {*}
+ */
+func (s *Server) Drain(timeout time.Duration) {
+	for _, l := range s.listeners {
+		l.StopAccept(s.el)
+	}
+	deadline := time.Now().Add(timeout)
+	var check EventLoop.TrigerProcess
+	check = func(el *EventLoop.EventLoop, _ *interface{}) {
+		if s.activeConns() == 0 || (timeout > 0 && !time.Now().Before(deadline)) {
+			el.Logger().Log(logger.INFO, "Server-Drain:事件循环退出", logger.F("active", s.activeConns()))
+			el.Done()
+			return
+		}
+		el.AddTimer(drainCheckInterval, check)
+	}
+	s.el.AddTimer(0, check)
+}
+
+// 所有Listener上还没有关闭的连接数
+func (s *Server) activeConns() int {
+	n := 0
+	for _, l := range s.listeners {
+		n += l.ActiveConns()
+	}
+	return n
+}
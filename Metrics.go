@@ -0,0 +1,185 @@
+/*
+ * @Description: 服务器的指标采集以及内置的指标HTTP端点(由ReactLoop自己的事件循环提供,只支持GET/HEAD /metrics)
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-21 13:26:54
+ * @LastEditTime: 2021-08-21 16:03:12
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Reactloop
+
+import (
+	"Reactloop/EventLoop"
+	"Reactloop/Metrics"
+	"Reactloop/Socket"
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+const (
+	metricsPath        = "/metrics"
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+	maxMetricsRequest  = 8 * 1024 //请求头的最大长度
+)
+
+// 指标端点上每个连接的状态,保存在Conn的Context中
+type metricsSession struct {
+	buf     []byte //还没有解析完整的请求头
+	closing bool   //已经回复了最后一个响应,等待写完后关闭
+}
+
+/**
+ * @description:开启事件循环(loop="main")和所有Listener(listener=Key())的指标采集,启动服务器时生效
+ * @param {*Metrics.Registry} reg 为nil时使用Metrics.Default
+ * @return {*}
+ */
+func (s *Server) EnableMetrics(reg *Metrics.Registry) {
+	if reg == nil {
+		reg = Metrics.Default
+	}
+	s.metrics = reg
+}
+
+/**
+ * @description:在addr(ip:port)上提供指标HTTP端点,该端口上的连接只触发端点自己的回调;
+ *  没有调用EnableMetrics时使用Metrics.Default开启指标采集
+ * @param {string} addr
+ * @return {*}
+ */
+func (s *Server) ServeMetrics(addr string) error {
+	l, err := Socket.NewListener("tcp4", addr)
+	if err != nil {
+		return err
+	}
+	if s.metrics == nil {
+		s.EnableMetrics(nil)
+	}
+	s.AddListener(l, &EventLoop.Event{Data: s.metricsData})
+	return nil
+}
+
+/**
+ * @description:开启指标后为事件循环和所有Listener开启采集
+ * @param {*}
+ * @return {*}
+ */
+func (s *Server) installMetrics() {
+	if s.metrics == nil {
+		return
+	}
+	s.el.EnableMetrics(s.metrics, "main")
+	for _, l := range s.listeners {
+		l.EnableMetrics(s.metrics, "")
+	}
+}
+
+/**
+ * @description:指标端点的Data回调:解析出完整的请求头后依次回复,支持keep-alive和pipeline
+ * @param {*EventLoop.EventLoop} el
+ * @param {*interface{}} connPtr
+ * @return {*}
+ */
+func (s *Server) metricsData(el *EventLoop.EventLoop, connPtr *interface{}) {
+	conn, ok := (*connPtr).(*Socket.Conn)
+	if !ok {
+		return
+	}
+	sess, ok := conn.Context().(*metricsSession)
+	if !ok {
+		sess = &metricsSession{}
+		conn.SetContext(sess)
+	}
+	data := conn.Read()
+	if sess.closing {
+		return
+	}
+	sess.buf = append(sess.buf, data...)
+	for {
+		end := bytes.Index(sess.buf, []byte("\r\n\r\n"))
+		if end < 0 {
+			if len(sess.buf) > maxMetricsRequest {
+				writeMetricsResponse(conn, 431, "Request Header Fields Too Large", nil, false, false)
+				sess.closing = true
+				conn.CloseAfterFlush()
+			}
+			return
+		}
+		head := string(sess.buf[:end])
+		sess.buf = sess.buf[end+4:]
+		if !s.answerMetrics(conn, head) {
+			sess.closing = true
+			conn.CloseAfterFlush()
+			return
+		}
+	}
+}
+
+/**
+ * @description:回复一个请求
+ * @param {*Socket.Conn} conn
+ * @param {string} head 请求行和请求头,不包含结尾的空行
+ * @return {bool} 连接是否保持
+ */
+func (s *Server) answerMetrics(conn *Socket.Conn, head string) bool {
+	lines := strings.Split(head, "\r\n")
+	parts := strings.Fields(lines[0])
+	if len(parts) != 3 || !strings.HasPrefix(parts[2], "HTTP/1.") {
+		writeMetricsResponse(conn, 400, "Bad Request", nil, false, false)
+		return false
+	}
+	method, target, proto := parts[0], parts[1], parts[2]
+	keepAlive := proto != "HTTP/1.0"
+	for _, line := range lines[1:] {
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			continue
+		}
+		name, value := strings.TrimSpace(line[:i]), strings.ToLower(strings.TrimSpace(line[i+1:]))
+		switch strings.ToLower(name) {
+		case "connection":
+			if value == "close" {
+				keepAlive = false
+			} else if value == "keep-alive" {
+				keepAlive = true
+			}
+		case "content-length", "transfer-encoding":
+			// 端点不接收请求体,无法确定下一个请求的起始位置
+			if value != "0" {
+				writeMetricsResponse(conn, 400, "Bad Request", nil, false, false)
+				return false
+			}
+		}
+	}
+	if i := strings.IndexByte(target, '?'); i >= 0 {
+		target = target[:i]
+	}
+	switch {
+	case target != metricsPath:
+		writeMetricsResponse(conn, 404, "Not Found", nil, method == "HEAD", keepAlive)
+	case method != "GET" && method != "HEAD":
+		writeMetricsResponse(conn, 405, "Method Not Allowed", nil, false, keepAlive)
+	default:
+		body := &bytes.Buffer{}
+		s.metrics.WriteText(body)
+		writeMetricsResponse(conn, 200, "OK", body.Bytes(), method == "HEAD", keepAlive)
+	}
+	return keepAlive
+}
+
+func writeMetricsResponse(conn *Socket.Conn, code int, status string, body []byte, headOnly, keepAlive bool) {
+	connection := "close"
+	if keepAlive {
+		connection = "keep-alive"
+	}
+	resp := &bytes.Buffer{}
+	resp.WriteString("HTTP/1.1 " + strconv.Itoa(code) + " " + status + "\r\n")
+	resp.WriteString("Content-Type: " + metricsContentType + "\r\n")
+	resp.WriteString("Content-Length: " + strconv.Itoa(len(body)) + "\r\n")
+	resp.WriteString("Connection: " + connection + "\r\n\r\n")
+	if !headOnly {
+		resp.Write(body)
+	}
+	conn.Write(resp.Bytes())
+}
@@ -0,0 +1,336 @@
+/*
+ * @Description: 指标采集(计数器/仪表盘/直方图)以及Prometheus文本格式输出,只依赖Utils,
+ *  EventLoop和Socket在开启指标后直接更新这里的指标,所有指标都可以在任意goroutine中读取
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-21 09:30:12
+ * @LastEditTime: 2021-08-21 14:52:40
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Metrics
+
+import (
+	err "Reactloop/Utils/Error"
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 回调耗时等延迟类指标默认的桶(秒)
+var LatencyBuckets = []float64{0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// 每次epoll返回的事件数等计数类指标默认的桶
+var CountBuckets = []float64{0, 1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024}
+
+// 未指定Registry时使用的默认Registry
+var Default = NewRegistry()
+
+// Labels 指标的标签,同名指标通过标签区分(如不同的EventLoop/Listener)
+type Labels map[string]string
+
+// Counter 只增不减的计数器
+type Counter struct {
+	v uint64
+}
+
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.v, 1)
+}
+
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.v, n)
+}
+
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.v)
+}
+
+// Gauge 可增可减的当前值
+type Gauge struct {
+	v int64
+}
+
+func (g *Gauge) Inc() {
+	atomic.AddInt64(&g.v, 1)
+}
+
+func (g *Gauge) Dec() {
+	atomic.AddInt64(&g.v, -1)
+}
+
+func (g *Gauge) Add(n int64) {
+	atomic.AddInt64(&g.v, n)
+}
+
+func (g *Gauge) Set(n int64) {
+	atomic.StoreInt64(&g.v, n)
+}
+
+func (g *Gauge) Value() int64 {
+	return atomic.LoadInt64(&g.v)
+}
+
+// Histogram 按桶统计观测值的分布
+type Histogram struct {
+	mu     sync.Mutex
+	bounds []float64 //各个桶的上界(升序,不包含+Inf)
+	counts []uint64  //落在各个桶中的观测次数(不累加),最后一个为+Inf桶
+	sum    float64
+	count  uint64
+}
+
+/**
+ * @description: Histogram构造函数
+ * @param {[]float64} bounds 桶的上界,会被排序
+ * @return {*}
+ */
+func NewHistogram(bounds []float64) *Histogram {
+	b := append([]float64{}, bounds...)
+	sort.Float64s(b)
+	return &Histogram{bounds: b, counts: make([]uint64, len(b)+1)}
+}
+
+/**
+ * @description:记录一次观测值
+ * @param {float64} v
+ * @return {*}
+ */
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+/**
+ * @description:以秒为单位记录一段耗时
+ * @param {time.Duration} d
+ * @return {*}
+ */
+func (h *Histogram) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+/**
+ * @description:观测次数与观测值之和
+ * @param {*}
+ * @return {*}
+ */
+func (h *Histogram) Count() (uint64, float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count, h.sum
+}
+
+// 指标类型,即输出中TYPE行的值
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+// 同名同类型的一组指标
+type family struct {
+	name, help, kind string
+	series           []*series
+}
+
+// 一组标签对应的一个指标
+type series struct {
+	labels string //已经格式化的标签,如`loop="main"`
+	metric interface{}
+}
+
+// Registry 保存所有指标,输出时按指标名排序
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+	onError  func(e error)
+}
+
+/**
+ * @description: Registry构造函数
+ * @param {*}
+ * @return {*}
+ */
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]*family{}}
+}
+
+/**
+ * @description:设置注册指标出错(同名指标的类型不一致)时的回调,在注册指标的goroutine中调用
+ * @param {func(e error)} handler
+ * @return {*}
+ */
+func (r *Registry) OnError(handler func(e error)) {
+	r.mu.Lock()
+	r.onError = handler
+	r.mu.Unlock()
+}
+
+/**
+ * @description:获取(不存在时创建)一个计数器;同名指标的类型必须一致,
+ *  不一致时通过OnError报告,并返回一个可以正常使用但不会被输出的指标
+ * @param {string} name
+ * @param {string} help
+ * @param {Labels} labels
+ * @return {*}
+ */
+func (r *Registry) Counter(name, help string, labels Labels) *Counter {
+	return r.get(name, help, kindCounter, labels, func() interface{} { return &Counter{} }).(*Counter)
+}
+
+/**
+ * @description:获取(不存在时创建)一个仪表盘
+ * @param {string} name
+ * @param {string} help
+ * @param {Labels} labels
+ * @return {*}
+ */
+func (r *Registry) Gauge(name, help string, labels Labels) *Gauge {
+	return r.get(name, help, kindGauge, labels, func() interface{} { return &Gauge{} }).(*Gauge)
+}
+
+/**
+ * @description:获取(不存在时创建)一个直方图,已经存在时忽略buckets
+ * @param {string} name
+ * @param {string} help
+ * @param {[]float64} buckets
+ * @param {Labels} labels
+ * @return {*}
+ */
+func (r *Registry) Histogram(name, help string, buckets []float64, labels Labels) *Histogram {
+	return r.get(name, help, kindHistogram, labels, func() interface{} { return NewHistogram(buckets) }).(*Histogram)
+}
+
+func (r *Registry) get(name, help, kind string, labels Labels, create func() interface{}) interface{} {
+	key := formatLabels(labels)
+	r.mu.Lock()
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{name: name, help: help, kind: kind}
+		r.families[name] = f
+	}
+	if f.kind != kind {
+		handler := r.onError
+		r.mu.Unlock()
+		if handler != nil {
+			handler(&err.METRIC_KIND_ERR{Name: name, Registered: f.kind, Requested: kind})
+		}
+		return create()
+	}
+	defer r.mu.Unlock()
+	for _, s := range f.series {
+		if s.labels == key {
+			return s.metric
+		}
+	}
+	s := &series{labels: key, metric: create()}
+	f.series = append(f.series, s)
+	return s.metric
+}
+
+/**
+ * @description:以Prometheus文本格式(0.0.4)输出所有指标
+ * @param {io.Writer} w
+ * @return {*}
+ */
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, &family{name: f.name, help: f.help, kind: f.kind, series: append([]*series{}, f.series...)})
+	}
+	r.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.kind)
+		for _, s := range f.series {
+			switch m := s.metric.(type) {
+			case *Counter:
+				writeSample(bw, f.name, s.labels, strconv.FormatUint(m.Value(), 10))
+			case *Gauge:
+				writeSample(bw, f.name, s.labels, strconv.FormatInt(m.Value(), 10))
+			case *Histogram:
+				writeHistogram(bw, f.name, s.labels, m)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+func writeHistogram(w *bufio.Writer, name, labels string, h *Histogram) {
+	h.mu.Lock()
+	counts := append([]uint64{}, h.counts...)
+	sum, count := h.sum, h.count
+	h.mu.Unlock()
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += counts[i]
+		writeSample(w, name+"_bucket", joinLabels(labels, `le="`+formatFloat(bound)+`"`), strconv.FormatUint(cumulative, 10))
+	}
+	writeSample(w, name+"_bucket", joinLabels(labels, `le="+Inf"`), strconv.FormatUint(count, 10))
+	writeSample(w, name+"_sum", labels, formatFloat(sum))
+	writeSample(w, name+"_count", labels, strconv.FormatUint(count, 10))
+}
+
+func writeSample(w *bufio.Writer, name, labels, value string) {
+	w.WriteString(name)
+	if labels != "" {
+		w.WriteString("{" + labels + "}")
+	}
+	w.WriteString(" " + value + "\n")
+}
+
+func joinLabels(labels, extra string) string {
+	if labels == "" {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+// 标签按名字排序,保证同一组标签得到相同的key
+func formatLabels(labels Labels) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + `="` + escapeLabel(labels[name]) + `"`
+	}
+	return strings.Join(parts, ",")
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func escapeHelp(v string) string {
+	return helpEscaper.Replace(v)
+}
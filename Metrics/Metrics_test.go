@@ -0,0 +1,75 @@
+/*
+ * @Description: 指标与Prometheus文本格式输出测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-21 10:05:33
+ * @LastEditTime: 2021-08-21 14:20:18
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Metrics
+
+import (
+	err "Reactloop/Utils/Error"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("reqs_total", "Requests.", Labels{"port": "80", "host": `a"b`})
+	c.Add(3)
+	if r.Counter("reqs_total", "Requests.", Labels{"host": `a"b`, "port": "80"}) != c {
+		t.Fatal("same labels should return the same counter")
+	}
+	r.Gauge("active", "Active conns.", nil).Set(-2)
+	h := r.Histogram("lat_seconds", "Latency.", []float64{1, 0.1}, Labels{"loop": "main"})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(3)
+
+	buf := &bytes.Buffer{}
+	if err := r.WriteText(buf); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"# HELP active Active conns.",
+		"# TYPE active gauge",
+		"active -2",
+		"# HELP lat_seconds Latency.",
+		"# TYPE lat_seconds histogram",
+		`lat_seconds_bucket{loop="main",le="0.1"} 1`,
+		`lat_seconds_bucket{loop="main",le="1"} 2`,
+		`lat_seconds_bucket{loop="main",le="+Inf"} 3`,
+		`lat_seconds_sum{loop="main"} 3.55`,
+		`lat_seconds_count{loop="main"} 3`,
+		"# HELP reqs_total Requests.",
+		"# TYPE reqs_total counter",
+		`reqs_total{host="a\"b",port="80"} 3`,
+		"",
+	}, "\n")
+	if buf.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestKindMismatch(t *testing.T) {
+	r := NewRegistry()
+	var reported error
+	r.OnError(func(e error) { reported = e })
+	r.Counter("x", "", nil).Inc()
+	g := r.Gauge("x", "", nil)
+	var kindErr *err.METRIC_KIND_ERR
+	if !errors.As(reported, &kindErr) || kindErr.Registered != kindCounter || kindErr.Requested != kindGauge {
+		t.Fatalf("expected kind mismatch error, got %v", reported)
+	}
+	// 返回的指标可以使用,但不会出现在输出中
+	g.Set(5)
+	var buf bytes.Buffer
+	r.WriteText(&buf)
+	if strings.Contains(buf.String(), "gauge") || !strings.Contains(buf.String(), "x 1") {
+		t.Fatalf("unexpected output:\n%s", buf.String())
+	}
+}
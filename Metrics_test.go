@@ -0,0 +1,126 @@
+/*
+ * @Description: 指标采集与内置指标HTTP端点测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-21 15:22:37
+ * @LastEditTime: 2021-08-21 16:40:05
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Reactloop
+
+import (
+	"Reactloop/EventLoop"
+	"Reactloop/Metrics"
+	"Reactloop/Socket"
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 找一个空闲端口,Listener的指标以ip:port区分
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestServeMetrics(t *testing.T) {
+	s := NewServer()
+	s.EnableMetrics(Metrics.NewRegistry())
+	appAddr, metricsAddr := freeAddr(t), freeAddr(t)
+	app, err := Socket.NewListener("tcp4", appAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AddListener(app)
+	s.AddSystemEvent(&EventLoop.Event{Data: func(el *EventLoop.EventLoop, p *interface{}) {
+		conn := (*p).(*Socket.Conn)
+		conn.Write(conn.Read())
+	}})
+	if err := s.ServeMetrics(metricsAddr); err != nil {
+		t.Fatal(err)
+	}
+	go s.StartServe()
+	defer s.Post(func(el *EventLoop.EventLoop) {
+		s.CloseAllListener()
+		el.Done()
+	})
+
+	var c net.Conn
+	for i := 0; i < 50; i++ {
+		if c, err = net.Dial("tcp4", appAddr); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Write([]byte("ping"))
+	echo := make([]byte, 4)
+	if _, err := c.Read(echo); err != nil || string(echo) != "ping" {
+		t.Fatal(string(echo), err)
+	}
+	c.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	m, err := net.Dial("tcp4", metricsAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	// 两个请求一起发出,连接保持
+	m.Write([]byte("GET /metrics HTTP/1.1\r\nHost: x\r\n\r\nHEAD /metrics?x=1 HTTP/1.1\r\n\r\nGET /nope HTTP/1.1\r\n\r\n"))
+	r := bufio.NewReader(m)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatal(resp.Status, resp.Header)
+	}
+	label := `{listener="tcp4:` + appAddr + `"}`
+	for _, want := range []string{
+		"reactloop_listener_accepted_total" + label + " 1",
+		"reactloop_listener_closed_total" + label + " 1",
+		"reactloop_listener_active_connections" + label + " 0",
+		"reactloop_listener_received_bytes_total" + label + " 4",
+		"reactloop_listener_sent_bytes_total" + label + " 4",
+		`reactloop_loop_callback_duration_seconds_count{callback="data",loop="main"}`,
+		`reactloop_loop_wakeups_total{loop="main"}`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("missing %q in\n%s", want, body)
+		}
+	}
+	head, err := http.ReadResponse(r, &http.Request{Method: "HEAD"})
+	if err != nil || head.StatusCode != 200 || head.ContentLength <= 0 {
+		t.Fatal(head, err)
+	}
+	missing, err := http.ReadResponse(r, nil)
+	if err != nil || missing.StatusCode != 404 {
+		t.Fatal(missing, err)
+	}
+
+	// HTTP/1.0默认回复后关闭连接
+	m.Write([]byte("GET /metrics HTTP/1.0\r\n\r\n"))
+	last, err := http.ReadResponse(r, nil)
+	if err != nil || last.StatusCode != 200 {
+		t.Fatal(last, err)
+	}
+	ioutil.ReadAll(last.Body)
+	m.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Fatal("connection should be closed after an HTTP/1.0 response")
+	}
+}
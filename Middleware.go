@@ -0,0 +1,175 @@
+/*
+ * @Description: 连接事件的中间件:像http中间件一样把Open/Data/Close回调包装成一条调用链,
+ *  用于日志、鉴权、统计等在所有回调中重复的逻辑
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-19 10:05:18
+ * @LastEditTime: 2021-08-19 16:42:37
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Reactloop
+
+import (
+	"Reactloop/EventLoop"
+	"Reactloop/Socket"
+)
+
+// EventKind 中间件处理的事件类型
+type EventKind int
+
+const (
+	EVENT_OPEN EventKind = iota
+	EVENT_DATA
+	EVENT_CLOSE
+)
+
+/**
+ * @description:一次事件在中间件链中传递的上下文
+ *  Data为传给回调的触发指针:Open时为连接信息[]string,Data/Close时为*Socket.Conn
+ * @param {*}
+ * @return {*}
+ */
+type EventContext struct {
+	Kind EventKind
+	Loop *EventLoop.EventLoop
+	Data *interface{}
+	Conn *Socket.Conn //事件所属的连接,没有时为nil
+}
+
+/**
+ * @description:以reason为原因关闭事件所属的连接,通常在中间件不调用next(短路)时使用
+ * @param {error} reason
+ * @return {*}
+ */
+func (ctx *EventContext) Close(reason error) {
+	if ctx.Conn != nil {
+		ctx.Conn.CloseWithError(reason)
+	}
+}
+
+// Handler 中间件链中的一环
+type Handler func(ctx *EventContext)
+
+/**
+ * @description:中间件,返回包装了next的Handler;不调用next时事件不再向内传递(短路)
+ * @param {Handler} next
+ * @return {*}
+ */
+type Middleware func(next Handler) Handler
+
+/**
+ * @description:添加中间件,需要在StartServe之前调用;先添加的在外层,
+ *  即事件按添加顺序经过各个中间件,最后到达AddSystemEvent添加的回调
+ * @param {...Middleware} mws
+ * @return {*}
+ */
+func (s *Server) Use(mws ...Middleware) {
+	s.middlewares = append(s.middlewares, mws...)
+}
+
+/**
+ * @description:把系统事件注册到事件循环;有中间件时注册一个组合事件,由中间件链的最内层依次调用各个回调,
+ *  Listener自己的回调集合同样替换为经过中间件链的组合事件
+ * @param {*}
+ * @return {*}
+ */
+func (s *Server) installEvents() {
+	// Listener的回调集合不经过事件循环的系统事件,其中的Serving由这里额外注册的事件调用
+	owned := []*EventLoop.Event{}
+	for _, l := range s.listeners {
+		owned = append(owned, l.Events()...)
+	}
+	if len(s.middlewares) == 0 {
+		for _, event := range s.events {
+			s.el.AddSystemEvent(event)
+		}
+		if len(owned) > 0 {
+			s.el.AddSystemEvent(&EventLoop.Event{Serving: servingOf(owned)})
+		}
+		return
+	}
+	for _, l := range s.listeners {
+		if events := l.Events(); events != nil {
+			l.SetEvents([]*EventLoop.Event{s.composite(events)})
+		}
+	}
+	composite := s.composite(s.events)
+	composite.Serving = servingOf(append(append([]*EventLoop.Event{}, s.events...), owned...))
+	s.el.AddSystemEvent(composite)
+}
+
+// 依次调用events中的Serving
+func servingOf(events []*EventLoop.Event) EventLoop.TrigerProcess {
+	return func(el *EventLoop.EventLoop, ptr *interface{}) {
+		for _, event := range events {
+			if event.Serving != nil {
+				event.Serving(el, ptr)
+			}
+		}
+	}
+}
+
+/**
+ * @description:把一组回调组合为一个经过中间件链的事件;Open被中间件短路的连接关闭时,
+ *  Close只经过中间件,不再调用没有收到过Open的内层回调
+ * @param {[]*EventLoop.Event} events
+ * @return {*}
+ */
+func (s *Server) composite(events []*EventLoop.Event) *EventLoop.Event {
+	opened := map[*Socket.Conn]bool{} //Open到达了内层回调的连接
+	return &EventLoop.Event{
+		Open:  s.chain(EVENT_OPEN, events, opened, func(e *EventLoop.Event) EventLoop.TrigerProcess { return e.Open }),
+		Data:  s.chain(EVENT_DATA, events, opened, func(e *EventLoop.Event) EventLoop.TrigerProcess { return e.Data }),
+		Close: s.chain(EVENT_CLOSE, events, opened, func(e *EventLoop.Event) EventLoop.TrigerProcess { return e.Close }),
+	}
+}
+
+/**
+ * @description:为一种事件构造中间件调用链
+ * @param {EventKind} kind
+ * @param {[]*EventLoop.Event} events 链的最内层依次调用的回调
+ * @param {map[*Socket.Conn]bool} opened 同一组回调的各个调用链共享,记录Open到达了内层回调的连接
+ * @param {func(*EventLoop.Event) EventLoop.TrigerProcess} pick 选出该事件对应的回调
+ * @return {*}
+ */
+func (s *Server) chain(kind EventKind, events []*EventLoop.Event, opened map[*Socket.Conn]bool, pick func(e *EventLoop.Event) EventLoop.TrigerProcess) EventLoop.TrigerProcess {
+	var h Handler = func(ctx *EventContext) {
+		if ctx.Conn != nil {
+			switch kind {
+			case EVENT_OPEN:
+				opened[ctx.Conn] = true
+			case EVENT_CLOSE:
+				if !opened[ctx.Conn] {
+					return
+				}
+			}
+		}
+		for _, event := range events {
+			if callback := pick(event); callback != nil {
+				callback(ctx.Loop, ctx.Data)
+			}
+		}
+	}
+	for i := len(s.middlewares) - 1; i >= 0; i-- {
+		h = s.middlewares[i](h)
+	}
+	return func(el *EventLoop.EventLoop, ptr *interface{}) {
+		conn := eventConn(el, ptr)
+		h(&EventContext{Kind: kind, Loop: el, Data: ptr, Conn: conn})
+		if kind == EVENT_CLOSE && conn != nil {
+			delete(opened, conn)
+		}
+	}
+}
+
+// 找出事件所属的连接
+func eventConn(el *EventLoop.EventLoop, ptr *interface{}) *Socket.Conn {
+	if ptr != nil {
+		if conn, ok := (*ptr).(*Socket.Conn); ok {
+			return conn
+		}
+	}
+	conn, _ := el.Source().(*Socket.Conn)
+	return conn
+}
@@ -0,0 +1,122 @@
+/*
+ * @Description: 中间件调用链测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-19 15:10:44
+ * @LastEditTime: 2021-08-19 16:38:09
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Reactloop
+
+import (
+	"Reactloop/EventLoop"
+	"Reactloop/Socket"
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestMiddlewareChain(t *testing.T) {
+	s := NewServer()
+	trace := []string{}
+	logger := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx *EventContext) {
+				trace = append(trace, name+">")
+				next(ctx)
+				trace = append(trace, "<"+name)
+			}
+		}
+	}
+	denied := errors.New("denied")
+	auth := func(next Handler) Handler {
+		return func(ctx *EventContext) {
+			if ctx.Kind == EVENT_DATA && strings.Contains(string(ctx.Conn.Read()), "deny") {
+				trace = append(trace, "auth-close")
+				ctx.Close(denied)
+				return
+			}
+			next(ctx)
+		}
+	}
+	s.Use(logger("a"), logger("b"), auth)
+	s.AddSystemEvent(&EventLoop.Event{
+		Open:  func(el *EventLoop.EventLoop, p *interface{}) { trace = append(trace, "open") },
+		Data:  func(el *EventLoop.EventLoop, p *interface{}) { trace = append(trace, "data") },
+		Close: func(el *EventLoop.EventLoop, p *interface{}) { trace = append(trace, "close") },
+	})
+	s.installEvents()
+
+	pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(pair[1])
+	conn, err := Socket.AdoptConn(s.el, pair[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(trace, " "); got != "a> b> open <b <a" {
+		t.Fatalf("open trace %q", got)
+	}
+	trace = nil
+	syscall.Write(pair[1], []byte("hello"))
+	for i := 0; i < 10 && len(trace) == 0; i++ {
+		s.el.TikTok()
+	}
+	if got := strings.Join(trace, " "); got != "a> b> data <b <a" {
+		t.Fatalf("data trace %q", got)
+	}
+	trace = nil
+	syscall.Write(pair[1], []byte("deny me"))
+	for i := 0; i < 10 && len(trace) == 0; i++ {
+		s.el.TikTok()
+	}
+	// 短路的中间件关闭连接,Close事件同样经过中间件链,Data回调不会被调用
+	if got := strings.Join(trace, " "); got != "a> b> auth-close a> b> close <b <a <b <a" {
+		t.Fatalf("short-circuit trace %q", got)
+	}
+	if conn.Err() != denied {
+		t.Fatal("conn should be closed with the middleware's reason", conn.Err())
+	}
+}
+
+func TestMiddlewareOpenShortCircuit(t *testing.T) {
+	s := NewServer()
+	trace := []string{}
+	rejected := errors.New("rejected")
+	s.Use(func(next Handler) Handler {
+		return func(ctx *EventContext) {
+			trace = append(trace, "mw-"+[]string{"open", "data", "close"}[ctx.Kind])
+			if ctx.Kind == EVENT_OPEN {
+				ctx.Close(rejected)
+				return
+			}
+			next(ctx)
+		}
+	})
+	s.AddSystemEvent(&EventLoop.Event{
+		Open:  func(el *EventLoop.EventLoop, p *interface{}) { trace = append(trace, "open") },
+		Close: func(el *EventLoop.EventLoop, p *interface{}) { trace = append(trace, "close") },
+	})
+	s.installEvents()
+
+	pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(pair[1])
+	conn, err := Socket.AdoptConn(s.el, pair[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Open被短路,内层回调既没有收到Open也不应该收到Close
+	if got := strings.Join(trace, " "); got != "mw-open mw-close" {
+		t.Fatalf("trace %q", got)
+	}
+	if conn.Err() != rejected {
+		t.Fatal("conn should be closed by the middleware", conn.Err())
+	}
+}
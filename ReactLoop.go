@@ -10,12 +10,21 @@ package Reactloop
 
 import (
 	"Reactloop/EventLoop"
+	"Reactloop/Metrics"
 	"Reactloop/Socket"
+	logger "Reactloop/Utils/Log"
+	"os"
+	"time"
 )
 
 type Server struct {
-	el        *EventLoop.EventLoop
-	listeners []*Socket.Listener
+	el          *EventLoop.EventLoop
+	listeners   []*Socket.Listener
+	timeouts    Socket.Timeouts    //所有连接默认的超时设置
+	sockOpts    Socket.SockOpts    //所有Listener默认的套接字选项
+	events      []*EventLoop.Event //StartServe时注册到事件循环的系统事件
+	middlewares []Middleware       //包装Open/Data/Close的中间件,先Use的在外层
+	metrics     *Metrics.Registry  //指标输出的Registry,没有开启指标时为nil
 }
 
 func NewServer() *Server {
@@ -25,7 +34,16 @@ func NewServer() *Server {
 	}
 }
 
-func (s *Server) AddListener(l *Socket.Listener) {
+/**
+ * @description:添加监听套接字;传入events时该端口上的连接只触发这些回调,否则触发AddSystemEvent添加的回调
+ * @param {*Socket.Listener} l
+ * @param {...*EventLoop.Event} events
+ * @return {*}
+ */
+func (s *Server) AddListener(l *Socket.Listener, events ...*EventLoop.Event) {
+	for _, event := range events {
+		l.AddEvent(event)
+	}
 	s.listeners = append(s.listeners, l)
 }
 
@@ -35,7 +53,7 @@ func (s *Server) AddListener(l *Socket.Listener) {
  * @return {*}
  */
 func (s *Server) AddSystemEvent(event *EventLoop.Event) {
-	s.el.AddSystemEvent(event)
+	s.events = append(s.events, event)
 }
 
 /**
@@ -47,6 +65,89 @@ func (s *Server) AddUserEvent(user_event *EventLoop.UserEvent) {
 	s.el.AddUserEvent(user_event)
 }
 
+/**
+ * @description:注册信号处理函数,在事件循环中执行(如收到SIGTERM时Drain,收到SIGHUP时重新加载配置)
+ * @param {EventLoop.SignalHandler} handler
+ * @param {...os.Signal} sigs
+ * @return {*}
+ */
+func (s *Server) OnSignal(handler EventLoop.SignalHandler, sigs ...os.Signal) error {
+	return s.el.OnSignal(handler, sigs...)
+}
+
+/**
+ * @description:设置回调panic时的处理函数,发生panic的连接会被关闭,服务器继续运行
+ * @param {EventLoop.PanicHandler} handler
+ * @return {*}
+ */
+func (s *Server) SetPanicHandler(handler EventLoop.PanicHandler) {
+	s.el.SetPanicHandler(handler)
+}
+
+/**
+ * @description:设置运行中错误(如accept失败、fd耗尽)的处理函数,可以用errors.Is与Utils/Error中的哨兵错误比较
+ * @param {EventLoop.ErrorHandler} handler
+ * @return {*}
+ */
+func (s *Server) OnError(handler EventLoop.ErrorHandler) {
+	s.el.OnError(handler)
+}
+
+/**
+ * @description:设置日志输出(事件循环、连接以及平滑重启相关的日志),默认不输出
+ * @param {logger.Logger} l 可以用logger.NewStd适配标准库的log.Logger
+ * @return {*}
+ */
+func (s *Server) SetLogger(l logger.Logger) {
+	s.el.SetLogger(l)
+}
+
+/**
+ * @description:开启事件循环的看门狗,单个回调运行超过budget时带上调用栈上报,见EventLoop.SetWatchdog
+ * @param {time.Duration} budget
+ * @param {EventLoop.StallHandler} handler 为nil时输出到Logger
+ * @return {*}
+ */
+func (s *Server) SetWatchdog(budget time.Duration, handler EventLoop.StallHandler) {
+	s.el.SetWatchdog(budget, handler)
+}
+
+/**
+ * @description:创建绑定在服务器事件循环上的工作池,用于在回调中执行阻塞操作
+ * @param {EventLoop.PoolConfig} cfg
+ * @return {*}
+ */
+func (s *Server) NewPool(cfg EventLoop.PoolConfig) *EventLoop.Pool {
+	return s.el.NewPool(cfg)
+}
+
+/**
+ * @description:从任意goroutine向服务器的事件循环投递任务
+ * @param {func(el *EventLoop.EventLoop)} fn
+ * @return {*}
+ */
+func (s *Server) Post(fn func(el *EventLoop.EventLoop)) error {
+	return s.el.Post(fn)
+}
+
+/**
+ * @description:设置服务器范围内默认的连接超时,没有单独设置超时的Listener在启动时使用该设置
+ * @param {Socket.Timeouts} t
+ * @return {*}
+ */
+func (s *Server) SetTimeouts(t Socket.Timeouts) {
+	s.timeouts = t
+}
+
+/**
+ * @description:设置服务器范围内默认的套接字选项,没有单独设置选项的Listener在启动时使用该设置
+ * @param {Socket.SockOpts} o
+ * @return {*}
+ */
+func (s *Server) SetSockOpts(o Socket.SockOpts) {
+	s.sockOpts = o
+}
+
 func (s *Server) CloseAllListener() {
 	for _, listener := range s.listeners {
 		listener.Close()
@@ -54,12 +155,29 @@ func (s *Server) CloseAllListener() {
 }
 
 /**
- * @description:启动服务器,如果有一个监听socket报错则全部关闭
+ * @description:启动服务器,如果有一个监听socket报错则全部关闭;
+ *  从旧进程继承了监听套接字(见Restart/ServeHandoff)时直接接管同地址的套接字
  * @param {*}
  * @return {*}
  */
 func (s *Server) StartServe() error {
+	if errs := s.el.Err(); errs != nil {
+		return errs
+	}
+	loadInheritedFromEnv()
+	s.installEvents()
+	s.installMetrics()
 	for _, l := range s.listeners {
+		if l.Timeouts() == (Socket.Timeouts{}) {
+			l.SetTimeouts(s.timeouts)
+		}
+		if l.SockOpts() == (Socket.SockOpts{}) {
+			l.SetSockOpts(s.sockOpts)
+		}
+		if err := adoptInherited(l); err != nil {
+			s.CloseAllListener()
+			return err
+		}
 		if err := l.BindAndListen(); err != nil {
 			s.CloseAllListener()
 			return err
@@ -69,6 +187,7 @@ func (s *Server) StartServe() error {
 			return err
 		}
 	}
+	closeUnclaimed()
 	s.el.Run()
 	return nil
 }
@@ -0,0 +1,343 @@
+/*
+ * @Description: RESP2/RESP3协议的增量解析器(数据可以分多次到达,解析不完整时保留剩余数据等待下一次输入)
+ * @Author: Rocky Hoo
+ * @Date: 2021-07-27 20:10:32
+ * @LastEditTime: 2021-07-27 23:41:17
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Resp
+
+import (
+	err "Reactloop/Utils/Error"
+	"bytes"
+	"strconv"
+)
+
+// RESP数据类型,取值即为协议中该类型的首字节
+type Type byte
+
+const (
+	SimpleString   Type = '+'
+	Error          Type = '-'
+	Integer        Type = ':'
+	BulkString     Type = '$'
+	Array          Type = '*'
+	Null           Type = '_' //RESP3
+	Boolean        Type = '#' //RESP3
+	Double         Type = ',' //RESP3
+	BigNumber      Type = '(' //RESP3
+	BulkError      Type = '!' //RESP3
+	VerbatimString Type = '=' //RESP3
+	Map            Type = '%' //RESP3
+	Set            Type = '~' //RESP3
+	Attribute      Type = '|' //RESP3
+	Push           Type = '>' //RESP3
+)
+
+const (
+	maxBulkLen   = 512 * 1024 * 1024 //与redis一致,单个bulk字符串最大512MB
+	maxInlineLen = 64 * 1024         //inline命令一行的最大长度
+	maxElems     = 1024 * 1024       //聚合类型最大元素个数
+	maxDepth     = 32                //聚合类型默认的最大嵌套层数
+	initElems    = 16                //聚合类型预分配的元素个数,之后随实际到达的元素增长
+)
+
+/**
+ * @description:解析得到的一个RESP值
+ *  Map和Attribute类型的键值对按k1,v1,k2,v2...的顺序平铺在Elems中
+ * @param {*}
+ * @return {*}
+ */
+type Value struct {
+	Type   Type
+	Str    []byte  //SimpleString\Error\BulkString\BigNumber\BulkError\VerbatimString的内容
+	Int    int64   //Integer
+	Float  float64 //Double
+	Bool   bool    //Boolean
+	IsNull bool    //RESP2的$-1/*-1以及RESP3的_
+	Elems  []Value //Array\Set\Push\Map\Attribute的元素
+	Attrs  []Value //RESP3中附加在该值前面的Attribute
+}
+
+/**
+ * @description:将Array类型的命令转换成参数列表,非命令格式时返回false
+ * @param {*}
+ * @return {*}
+ */
+func (v *Value) Command() ([][]byte, bool) {
+	if v.Type != Array || v.IsNull || len(v.Elems) == 0 {
+		return nil, false
+	}
+	args := make([][]byte, len(v.Elems))
+	for i, elem := range v.Elems {
+		if elem.Type != BulkString && elem.Type != SimpleString {
+			return nil, false
+		}
+		args[i] = elem.Str
+	}
+	return args, true
+}
+
+// 正在解析的聚合类型
+type frame struct {
+	v      Value
+	remain int     //还需要的元素个数
+	attrs  []Value //非nil时该层只等待一个被Attribute修饰的值
+}
+
+// Parser 每个连接持有一个,Feed输入数据,Next取出解析完整的值;
+// 已经解析完的元素保存在栈中,数据分多次到达时不会从头重新解析
+type Parser struct {
+	buf      []byte
+	stack    []frame
+	maxDepth int
+}
+
+/**
+ * @description: Parser构造函数
+ * @param {*}
+ * @return {*}
+ */
+func NewParser() *Parser {
+	return &Parser{buf: []byte{}, maxDepth: maxDepth}
+}
+
+/**
+ * @description:设置聚合类型的最大嵌套层数,超过时返回协议错误;
+ *  客户端的请求都是由bulk字符串组成的数组,服务端设置为1即可拒绝嵌套的聚合类型
+ * @param {int} depth
+ * @return {*}
+ */
+func (p *Parser) SetMaxDepth(depth int) {
+	p.maxDepth = depth
+}
+
+/**
+ * @description:追加从连接中读到的数据
+ * @param {[]byte} data
+ * @return {*}
+ */
+func (p *Parser) Feed(data []byte) {
+	p.buf = append(p.buf, data...)
+}
+
+/**
+ * @description:缓冲区中还没有被解析的字节数
+ * @param {*}
+ * @return {*}
+ */
+func (p *Parser) Buffered() int {
+	return len(p.buf)
+}
+
+/**
+ * @description:尝试从缓冲区中解析出一个完整的值,数据不完整时返回false,已经解析的部分保留在栈中;
+ *  一次Feed可能包含多个值(pipeline),需要循环调用直到返回false
+ * @param {*}
+ * @return {*}
+ */
+func (p *Parser) Next() (Value, bool, error) {
+	pos := 0
+	// 已经解析的部分(值都是复制出来的)丢弃,剩余部分前移,避免缓冲区无限增长
+	defer func() {
+		p.buf = append(p.buf[:0], p.buf[pos:]...)
+	}()
+	for pos < len(p.buf) {
+		if len(p.stack) == 0 && !isTypeByte(p.buf[pos]) {
+			v, next, ok, errs := parseInline(p.buf[pos:])
+			if errs != nil || !ok {
+				return Value{}, false, errs
+			}
+			pos += next
+			return v, true, nil
+		}
+		v, n, next, ok, errs := parseHeader(p.buf, pos)
+		if errs != nil {
+			p.stack = nil
+			return Value{}, false, errs
+		}
+		if !ok {
+			return Value{}, false, nil
+		}
+		pos = next
+		if n > 0 {
+			if len(p.stack) >= p.maxDepth {
+				p.stack = nil
+				return Value{}, false, protocolError("too deep nesting")
+			}
+			if n > initElems {
+				v.Elems = make([]Value, 0, initElems)
+			} else {
+				v.Elems = make([]Value, 0, n)
+			}
+			p.stack = append(p.stack, frame{v: v, remain: n})
+			continue
+		}
+		if v, ok = p.complete(v); ok {
+			return v, true, nil
+		}
+	}
+	return Value{}, false, nil
+}
+
+/**
+ * @description:一个值解析完成后逐层放入所属的聚合类型,最外层的值完整时返回true
+ * @param {Value} v
+ * @return {*}
+ */
+func (p *Parser) complete(v Value) (Value, bool) {
+	for {
+		// Attribute修饰紧跟其后的值
+		if v.Type == Attribute && !v.IsNull {
+			attrs := v.Elems
+			if attrs == nil {
+				attrs = []Value{}
+			}
+			p.stack = append(p.stack, frame{attrs: attrs, remain: 1})
+			return Value{}, false
+		}
+		if len(p.stack) == 0 {
+			return v, true
+		}
+		top := &p.stack[len(p.stack)-1]
+		if top.attrs != nil {
+			v.Attrs = top.attrs
+			p.stack = p.stack[:len(p.stack)-1]
+			continue
+		}
+		top.v.Elems = append(top.v.Elems, v)
+		top.remain--
+		if top.remain > 0 {
+			return Value{}, false
+		}
+		v = top.v
+		p.stack = p.stack[:len(p.stack)-1]
+	}
+}
+
+func isTypeByte(b byte) bool {
+	switch Type(b) {
+	case SimpleString, Error, Integer, BulkString, Array, Null, Boolean, Double,
+		BigNumber, BulkError, VerbatimString, Map, Set, Attribute, Push:
+		return true
+	}
+	return false
+}
+
+/**
+ * @description:读取从pos开始到\r\n之前的一行
+ * @param {[]byte} buf
+ * @param {int} pos
+ * @return {*} 行内容,下一行的起始位置,是否读到完整的一行
+ */
+func readLine(buf []byte, pos int) ([]byte, int, bool) {
+	i := bytes.Index(buf[pos:], []byte("\r\n"))
+	if i < 0 {
+		return nil, 0, false
+	}
+	return buf[pos : pos+i], pos + i + 2, true
+}
+
+func protocolError(msg string) error {
+	return &err.RESP_PROTOCOL_ERR{Msg: msg}
+}
+
+/**
+ * @description:解析telnet等客户端发送的inline命令(以空白分隔参数,以\r\n或\n结尾)
+ * @param {[]byte} buf
+ * @return {*}
+ */
+func parseInline(buf []byte) (Value, int, bool, error) {
+	i := bytes.IndexByte(buf, '\n')
+	if i < 0 {
+		if len(buf) > maxInlineLen {
+			return Value{}, 0, false, protocolError("too big inline request")
+		}
+		return Value{}, 0, false, nil
+	}
+	line := bytes.TrimSuffix(buf[:i], []byte("\r"))
+	fields := bytes.Fields(line)
+	v := Value{Type: Array, Elems: make([]Value, len(fields))}
+	for j, field := range fields {
+		v.Elems[j] = Value{Type: BulkString, Str: append([]byte{}, field...)}
+	}
+	return v, i + 1, true, nil
+}
+
+/**
+ * @description:从pos开始解析一个值的头部,非聚合类型直接解析出完整的值
+ * @param {[]byte} buf
+ * @param {int} pos
+ * @return {*} 解析出的值,聚合类型还需要的元素个数,下一个值的起始位置,数据是否完整,协议错误
+ */
+func parseHeader(buf []byte, pos int) (Value, int, int, bool, error) {
+	t := Type(buf[pos])
+	line, next, ok := readLine(buf, pos+1)
+	if !ok {
+		return Value{}, 0, 0, false, nil
+	}
+	v := Value{Type: t}
+	switch t {
+	case SimpleString, Error, BigNumber:
+		v.Str = append([]byte{}, line...)
+	case Integer:
+		n, errs := strconv.ParseInt(string(line), 10, 64)
+		if errs != nil {
+			return Value{}, 0, 0, false, protocolError("invalid integer")
+		}
+		v.Int = n
+	case Null:
+		v.IsNull = true
+	case Boolean:
+		switch string(line) {
+		case "t":
+			v.Bool = true
+		case "f":
+			v.Bool = false
+		default:
+			return Value{}, 0, 0, false, protocolError("invalid boolean")
+		}
+	case Double:
+		f, errs := strconv.ParseFloat(string(line), 64)
+		if errs != nil {
+			return Value{}, 0, 0, false, protocolError("invalid double")
+		}
+		v.Float = f
+	case BulkString, BulkError, VerbatimString:
+		n, errs := strconv.Atoi(string(line))
+		if errs != nil || n < -1 || n > maxBulkLen {
+			return Value{}, 0, 0, false, protocolError("invalid bulk length")
+		}
+		if n == -1 {
+			v.IsNull = true
+			return v, 0, next, true, nil
+		}
+		if len(buf) < next+n+2 {
+			return Value{}, 0, 0, false, nil
+		}
+		if buf[next+n] != '\r' || buf[next+n+1] != '\n' {
+			return Value{}, 0, 0, false, protocolError("bulk string not terminated by CRLF")
+		}
+		v.Str = append([]byte{}, buf[next:next+n]...)
+		next += n + 2
+	case Array, Set, Push, Map, Attribute:
+		n, errs := strconv.Atoi(string(line))
+		if errs != nil || n < -1 || n > maxElems {
+			return Value{}, 0, 0, false, protocolError("invalid multibulk length")
+		}
+		if n == -1 {
+			v.IsNull = true
+			return v, 0, next, true, nil
+		}
+		// Map和Attribute的长度是键值对的个数
+		if t == Map || t == Attribute {
+			n *= 2
+		}
+		return v, n, next, true, nil
+	default:
+		return Value{}, 0, 0, false, protocolError("invalid type byte '" + string(buf[pos]) + "'")
+	}
+	return v, 0, next, true, nil
+}
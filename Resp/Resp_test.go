@@ -0,0 +1,167 @@
+/*
+ * @Description: Resp解析器与编码器测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-07-27 23:12:50
+ * @LastEditTime: 2021-07-27 23:50:13
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Resp
+
+import (
+	"Reactloop/EventLoop"
+	"Reactloop/Socket"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestParserIncremental(t *testing.T) {
+	p := NewParser()
+	input := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n*1\r\n$4\r\nPING\r\n"
+	// 逐字节输入,模拟数据分多次到达
+	var cmds [][][]byte
+	for i := 0; i < len(input); i++ {
+		p.Feed([]byte{input[i]})
+		for {
+			v, ok, err := p.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				break
+			}
+			args, ok := v.Command()
+			if !ok {
+				t.Fatalf("not a command: %+v", v)
+			}
+			cmds = append(cmds, args)
+		}
+	}
+	if len(cmds) != 2 || string(cmds[0][2]) != "value" || string(cmds[1][0]) != "PING" {
+		t.Fatalf("unexpected commands: %q", cmds)
+	}
+	if p.Buffered() != 0 {
+		t.Fatalf("buffer not drained: %d", p.Buffered())
+	}
+}
+
+func TestParserResp3(t *testing.T) {
+	p := NewParser()
+	p.Feed([]byte("|1\r\n+ttl\r\n:3\r\n%2\r\n+a\r\n#t\r\n+b\r\n,1.5\r\n_\r\nPING hello\r\n"))
+	v, ok, err := p.Next()
+	if err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	if v.Type != Map || len(v.Elems) != 4 || len(v.Attrs) != 2 || !v.Elems[1].Bool || v.Elems[3].Float != 1.5 {
+		t.Fatalf("unexpected map: %+v", v)
+	}
+	v, ok, _ = p.Next()
+	if !ok || v.Type != Null || !v.IsNull {
+		t.Fatalf("unexpected null: %+v", v)
+	}
+	v, ok, _ = p.Next()
+	args, _ := v.Command()
+	if !ok || len(args) != 2 || string(args[1]) != "hello" {
+		t.Fatalf("unexpected inline command: %+v", v)
+	}
+}
+
+func TestParserProtocolError(t *testing.T) {
+	p := NewParser()
+	p.Feed([]byte("$abc\r\n"))
+	if _, _, err := p.Next(); err == nil {
+		t.Fatal("expected protocol error")
+	}
+}
+
+func TestParserLimits(t *testing.T) {
+	// 只有头部时不按声明的元素个数预分配
+	p := NewParser()
+	p.Feed([]byte("*1048576\r\n$1\r\na\r\n"))
+	if _, ok, err := p.Next(); ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	if len(p.stack) != 1 || cap(p.stack[0].v.Elems) > initElems || p.Buffered() != 0 {
+		t.Fatalf("header allocated %d elems, %d bytes buffered", cap(p.stack[0].v.Elems), p.Buffered())
+	}
+
+	// 已经解析的元素在两次Feed之间保留
+	p = NewParser()
+	p.Feed([]byte("*2\r\n$1\r\na\r\n"))
+	if _, ok, _ := p.Next(); ok || p.Buffered() != 0 {
+		t.Fatal("partial array should be consumed into the parser state")
+	}
+	p.Feed([]byte("$1\r\nb\r\n"))
+	v, ok, err := p.Next()
+	if args, _ := v.Command(); !ok || err != nil || len(args) != 2 || string(args[1]) != "b" {
+		t.Fatalf("unexpected value: %+v %v", v, err)
+	}
+
+	p = NewParser()
+	p.Feed([]byte(strings.Repeat("*1\r\n", maxDepth+1)))
+	if _, _, err := p.Next(); err == nil {
+		t.Fatal("expected error for deep nesting")
+	}
+
+	// 服务端只接受平铺的数组
+	p = NewParser()
+	p.SetMaxDepth(1)
+	p.Feed([]byte("*1\r\n*1\r\n$1\r\na\r\n"))
+	if _, _, err := p.Next(); err == nil {
+		t.Fatal("expected error for nested request")
+	}
+}
+
+func TestWriter(t *testing.T) {
+	w2, w3 := NewWriter(2), NewWriter(3)
+	for _, w := range []*Writer{w2, w3} {
+		w.WriteMap(1)
+		w.WriteBulkString("k")
+		w.WriteBool(true)
+		w.WriteNull()
+	}
+	if got := string(w2.Bytes()); got != "*2\r\n$1\r\nk\r\n:1\r\n$-1\r\n" {
+		t.Fatalf("resp2: %q", got)
+	}
+	if got := string(w3.Bytes()); got != "%1\r\n$1\r\nk\r\n#t\r\n_\r\n" {
+		t.Fatalf("resp3: %q", got)
+	}
+}
+
+func TestWriterSanitizesLines(t *testing.T) {
+	w := NewWriter(2)
+	w.WriteError("ERR unknown command 'x\r\n+OK'")
+	w.WriteSimpleString("a\nb")
+	if got := string(w.Bytes()); got != "-ERR unknown command 'x  +OK'\r\n+a b\r\n" {
+		t.Fatalf("unsanitized: %q", got)
+	}
+}
+
+func TestMuxClosesOnProtocolError(t *testing.T) {
+	pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(pair[0])
+	syscall.SetsockoptTimeval(pair[0], syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &syscall.Timeval{Sec: 2})
+	el := EventLoop.New()
+	el.AddSystemEvent(NewMux().Event())
+	if _, err := Socket.AdoptConn(el, pair[1]); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Write(pair[0], []byte("$abc\r\n"))
+	for i := 0; i < 3; i++ {
+		el.TikTok()
+	}
+	buf := make([]byte, 128)
+	n, _ := syscall.Read(pair[0], buf)
+	if !strings.HasPrefix(string(buf[:n]), "-ERR ") {
+		t.Fatalf("reply %q", buf[:n])
+	}
+	// 回复错误后连接被关闭
+	if n, err := syscall.Read(pair[0], buf); n != 0 || err != nil {
+		t.Fatalf("conn still open: %d %v", n, err)
+	}
+}
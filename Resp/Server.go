@@ -0,0 +1,173 @@
+/*
+ * @Description: RESP命令分发(按命令名路由),挂载到EventLoop.Event的Data回调上,支持pipeline
+ * @Author: Rocky Hoo
+ * @Date: 2021-07-27 21:45:19
+ * @LastEditTime: 2021-07-27 23:52:36
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Resp
+
+import (
+	"Reactloop/EventLoop"
+	"Reactloop/Socket"
+	"strconv"
+	"strings"
+)
+
+// Command 一条解析完成的命令
+type Command struct {
+	Name string   //小写的命令名
+	Args [][]byte //不包含命令名的参数
+	Conn *Socket.Conn
+	Loop *EventLoop.EventLoop
+}
+
+// HandlerFunc 命令处理函数,回复写入w
+type HandlerFunc func(w *Writer, cmd *Command)
+
+type handler struct {
+	fn    HandlerFunc
+	arity int //与redis相同:正数表示参数个数(含命令名)必须相等,负数表示至少为-arity
+}
+
+// 每个连接上的协议状态,保存在Conn的Context中
+type session struct {
+	parser *Parser
+	proto  int
+	broken bool //出现协议错误,回复错误后关闭连接
+}
+
+// Mux 按命令名分发的路由器
+type Mux struct {
+	handlers map[string]*handler
+}
+
+/**
+ * @description: Mux构造函数,内置HELLO命令用于协商RESP2/RESP3
+ * @param {*}
+ * @return {*}
+ */
+func NewMux() *Mux {
+	m := &Mux{handlers: map[string]*handler{}}
+	m.handlers["hello"] = &handler{fn: nil, arity: -1}
+	return m
+}
+
+/**
+ * @description:注册一个命令,命令名不区分大小写
+ * @param {string} name
+ * @param {int} arity 参数个数约束(含命令名),0表示不检查
+ * @param {HandlerFunc} fn
+ * @return {*}
+ */
+func (m *Mux) Handle(name string, arity int, fn HandlerFunc) {
+	m.handlers[strings.ToLower(name)] = &handler{fn: fn, arity: arity}
+}
+
+/**
+ * @description:生成可以直接添加到Server上的系统事件
+ * @param {*}
+ * @return {*}
+ */
+func (m *Mux) Event() *EventLoop.Event {
+	return &EventLoop.Event{Data: m.Data}
+}
+
+/**
+ * @description:Data回调:将连接读到的数据喂给该连接的解析器,依次执行解析出的所有命令,最后统一回复
+ * @param {*EventLoop.EventLoop} el
+ * @param {*interface{}} connPtr
+ * @return {*}
+ */
+func (m *Mux) Data(el *EventLoop.EventLoop, connPtr *interface{}) {
+	conn, ok := (*connPtr).(*Socket.Conn)
+	if !ok {
+		return
+	}
+	sess, ok := conn.Context().(*session)
+	if !ok {
+		sess = &session{parser: NewParser(), proto: 2}
+		// 请求只能是由bulk字符串组成的数组
+		sess.parser.SetMaxDepth(1)
+		conn.SetContext(sess)
+	}
+	data := conn.Read()
+	if sess.broken {
+		return
+	}
+	sess.parser.Feed(data)
+	w := NewWriter(sess.proto)
+	for {
+		v, ok, errs := sess.parser.Next()
+		if errs != nil {
+			w.WriteError("ERR " + errs.Error())
+			sess.broken = true
+			break
+		}
+		if !ok {
+			break
+		}
+		args, ok := v.Command()
+		if !ok {
+			// 空行等无效输入直接忽略
+			continue
+		}
+		m.dispatch(w, sess, &Command{
+			Name: strings.ToLower(string(args[0])),
+			Args: args[1:],
+			Conn: conn,
+			Loop: el,
+		})
+	}
+	w.Flush(conn)
+	if sess.broken {
+		// 同Redis:回复协议错误后关闭连接,而不是继续丢弃之后的数据
+		conn.CloseAfterFlush()
+	}
+}
+
+func (m *Mux) dispatch(w *Writer, sess *session, cmd *Command) {
+	h, ok := m.handlers[cmd.Name]
+	if !ok {
+		w.WriteError("ERR unknown command '" + cmd.Name + "'")
+		return
+	}
+	argc := len(cmd.Args) + 1
+	if (h.arity > 0 && argc != h.arity) || (h.arity < 0 && argc < -h.arity) {
+		w.WriteError("ERR wrong number of arguments for '" + cmd.Name + "' command")
+		return
+	}
+	if cmd.Name == "hello" && h.fn == nil {
+		m.hello(w, sess, cmd)
+		return
+	}
+	h.fn(w, cmd)
+}
+
+/**
+ * @description:HELLO [protover]:切换连接使用的协议版本,并返回服务器信息
+ * @param {*Writer} w
+ * @param {*session} sess
+ * @param {*Command} cmd
+ * @return {*}
+ */
+func (m *Mux) hello(w *Writer, sess *session, cmd *Command) {
+	if len(cmd.Args) > 0 {
+		proto, errs := strconv.Atoi(string(cmd.Args[0]))
+		if errs != nil || (proto != 2 && proto != 3) {
+			w.WriteError("NOPROTO unsupported protocol version")
+			return
+		}
+		sess.proto = proto
+		w.proto = proto
+	}
+	w.WriteMap(3)
+	w.WriteBulkString("server")
+	w.WriteBulkString("reactloop")
+	w.WriteBulkString("proto")
+	w.WriteInteger(int64(sess.proto))
+	w.WriteBulkString("mode")
+	w.WriteBulkString("standalone")
+}
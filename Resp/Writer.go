@@ -0,0 +1,289 @@
+/*
+ * @Description: RESP回复的编码器,根据连接协商的协议版本(2或3)输出对应格式
+ * @Author: Rocky Hoo
+ * @Date: 2021-07-27 21:02:44
+ * @LastEditTime: 2021-07-27 23:40:02
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Resp
+
+import (
+	"math"
+	"strconv"
+)
+
+// Sink 回复最终写入的地方,Socket.Conn满足此接口
+type Sink interface {
+	Write(data []byte)
+}
+
+// Writer 在一次Data事件中累积所有回复,Flush时一次性写入连接(pipeline的回复只写一次)
+type Writer struct {
+	buf   []byte
+	proto int //协议版本,2或3
+}
+
+/**
+ * @description: Writer构造函数
+ * @param {int} proto 协议版本,非3时按RESP2处理
+ * @return {*}
+ */
+func NewWriter(proto int) *Writer {
+	if proto != 3 {
+		proto = 2
+	}
+	return &Writer{buf: []byte{}, proto: proto}
+}
+
+/**
+ * @description:当前使用的协议版本
+ * @param {*}
+ * @return {*}
+ */
+func (w *Writer) Proto() int {
+	return w.proto
+}
+
+/**
+ * @description:取出已经编码的数据并清空缓冲区
+ * @param {*}
+ * @return {*}
+ */
+func (w *Writer) Bytes() []byte {
+	res := w.buf
+	w.buf = []byte{}
+	return res
+}
+
+/**
+ * @description:将缓冲区的数据写入sink
+ * @param {Sink} sink
+ * @return {*}
+ */
+func (w *Writer) Flush(sink Sink) {
+	if len(w.buf) > 0 {
+		sink.Write(w.Bytes())
+	}
+}
+
+func (w *Writer) writeHeader(t Type, n int) {
+	w.buf = append(w.buf, byte(t))
+	w.buf = strconv.AppendInt(w.buf, int64(n), 10)
+	w.buf = append(w.buf, '\r', '\n')
+}
+
+/**
+ * @description:写入单行内容,其中的\r\n替换为空格(同Redis),避免客户端可控的内容(如命令名)伪造出额外的回复
+ * @param {string} s
+ * @return {*}
+ */
+func (w *Writer) appendLine(s string) {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\r' || s[i] == '\n' {
+			w.buf = append(w.buf, ' ')
+		} else {
+			w.buf = append(w.buf, s[i])
+		}
+	}
+	w.buf = append(w.buf, '\r', '\n')
+}
+
+func (w *Writer) WriteSimpleString(s string) {
+	w.buf = append(w.buf, byte(SimpleString))
+	w.appendLine(s)
+}
+
+/**
+ * @description:写入错误回复,msg中一般以错误类型开头,如"ERR xxx"
+ * @param {string} msg
+ * @return {*}
+ */
+func (w *Writer) WriteError(msg string) {
+	w.buf = append(w.buf, byte(Error))
+	w.appendLine(msg)
+}
+
+func (w *Writer) WriteInteger(n int64) {
+	w.buf = append(w.buf, byte(Integer))
+	w.buf = strconv.AppendInt(w.buf, n, 10)
+	w.buf = append(w.buf, '\r', '\n')
+}
+
+func (w *Writer) WriteBulk(data []byte) {
+	w.writeHeader(BulkString, len(data))
+	w.buf = append(w.buf, data...)
+	w.buf = append(w.buf, '\r', '\n')
+}
+
+func (w *Writer) WriteBulkString(s string) {
+	w.WriteBulk([]byte(s))
+}
+
+/**
+ * @description:写入空值,RESP2中为$-1,RESP3中为_
+ * @param {*}
+ * @return {*}
+ */
+func (w *Writer) WriteNull() {
+	if w.proto == 3 {
+		w.buf = append(w.buf, '_', '\r', '\n')
+		return
+	}
+	w.buf = append(w.buf, '$', '-', '1', '\r', '\n')
+}
+
+/**
+ * @description:写入空数组,RESP2中为*-1,RESP3中为_
+ * @param {*}
+ * @return {*}
+ */
+func (w *Writer) WriteNullArray() {
+	if w.proto == 3 {
+		w.buf = append(w.buf, '_', '\r', '\n')
+		return
+	}
+	w.buf = append(w.buf, '*', '-', '1', '\r', '\n')
+}
+
+/**
+ * @description:写入数组头,之后需要再写入n个元素
+ * @param {int} n
+ * @return {*}
+ */
+func (w *Writer) WriteArray(n int) {
+	w.writeHeader(Array, n)
+}
+
+/**
+ * @description:写入集合头,RESP2中退化为数组
+ * @param {int} n
+ * @return {*}
+ */
+func (w *Writer) WriteSet(n int) {
+	if w.proto == 3 {
+		w.writeHeader(Set, n)
+		return
+	}
+	w.writeHeader(Array, n)
+}
+
+/**
+ * @description:写入Map头,之后需要再写入n对键值;RESP2中退化为2n个元素的数组
+ * @param {int} n 键值对的个数
+ * @return {*}
+ */
+func (w *Writer) WriteMap(n int) {
+	if w.proto == 3 {
+		w.writeHeader(Map, n)
+		return
+	}
+	w.writeHeader(Array, 2*n)
+}
+
+/**
+ * @description:写入推送消息头(如pub/sub),RESP2中退化为数组
+ * @param {int} n
+ * @return {*}
+ */
+func (w *Writer) WritePush(n int) {
+	if w.proto == 3 {
+		w.writeHeader(Push, n)
+		return
+	}
+	w.writeHeader(Array, n)
+}
+
+/**
+ * @description:写入布尔值,RESP2中退化为整数1/0
+ * @param {bool} b
+ * @return {*}
+ */
+func (w *Writer) WriteBool(b bool) {
+	if w.proto == 3 {
+		if b {
+			w.buf = append(w.buf, '#', 't', '\r', '\n')
+		} else {
+			w.buf = append(w.buf, '#', 'f', '\r', '\n')
+		}
+		return
+	}
+	if b {
+		w.WriteInteger(1)
+	} else {
+		w.WriteInteger(0)
+	}
+}
+
+/**
+ * @description:写入浮点数,RESP2中退化为bulk字符串
+ * @param {float64} f
+ * @return {*}
+ */
+func (w *Writer) WriteDouble(f float64) {
+	var s string
+	switch {
+	case math.IsInf(f, 1):
+		s = "inf"
+	case math.IsInf(f, -1):
+		s = "-inf"
+	case math.IsNaN(f):
+		s = "nan"
+	default:
+		s = strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	if w.proto == 3 {
+		w.buf = append(w.buf, byte(Double))
+		w.buf = append(w.buf, s...)
+		w.buf = append(w.buf, '\r', '\n')
+		return
+	}
+	w.WriteBulkString(s)
+}
+
+/**
+ * @description:按照Value的类型原样写入一个值(用于转发或测试)
+ * @param {Value} v
+ * @return {*}
+ */
+func (w *Writer) WriteValue(v Value) {
+	switch v.Type {
+	case SimpleString:
+		w.WriteSimpleString(string(v.Str))
+	case Error, BulkError:
+		w.WriteError(string(v.Str))
+	case Integer:
+		w.WriteInteger(v.Int)
+	case BulkString, VerbatimString, BigNumber:
+		if v.IsNull {
+			w.WriteNull()
+			return
+		}
+		w.WriteBulk(v.Str)
+	case Null:
+		w.WriteNull()
+	case Boolean:
+		w.WriteBool(v.Bool)
+	case Double:
+		w.WriteDouble(v.Float)
+	case Array, Set, Push, Map, Attribute:
+		if v.IsNull {
+			w.WriteNullArray()
+			return
+		}
+		switch v.Type {
+		case Set:
+			w.WriteSet(len(v.Elems))
+		case Push:
+			w.WritePush(len(v.Elems))
+		case Map, Attribute:
+			w.WriteMap(len(v.Elems) / 2)
+		default:
+			w.WriteArray(len(v.Elems))
+		}
+		for _, elem := range v.Elems {
+			w.WriteValue(elem)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+/*
+ * @Description: 基于CIDR的ip访问控制列表(支持IPv4/IPv6),在accept时检查对端ip;规则可以在其他goroutine中热更新
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-05 20:15:02
+ * @LastEditTime: 2021-08-05 22:47:31
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import (
+	err "Reactloop/Utils/Error"
+	"net"
+	"strings"
+	"sync/atomic"
+)
+
+// 一组不可变的规则,热更新时整体替换
+type aclRules struct {
+	allow, deny []*net.IPNet
+}
+
+/**
+ * @description:访问控制列表:命中deny的拒绝;allow不为空时只允许命中allow的ip,为空时允许其余所有ip
+ * @param {*}
+ * @return {*}
+ */
+type ACL struct {
+	rejected uint64       //被拒绝的连接数,放在第一个字段保证64位对齐
+	rules    atomic.Value //*aclRules
+}
+
+/**
+ * @description: ACL构造函数
+ * @param {[]string} allow 允许的网段,如"10.0.0.0/8"、"fd00::/8",不带掩码的单个ip按/32或/128处理
+ * @param {[]string} deny 拒绝的网段
+ * @return {*}
+ */
+func NewACL(allow, deny []string) (*ACL, error) {
+	a := &ACL{}
+	if errs := a.Reload(allow, deny); errs != nil {
+		return nil, errs
+	}
+	return a, nil
+}
+
+/**
+ * @description:原子地替换全部规则,可以在任意goroutine中调用;解析失败时保留原有规则
+ * @param {[]string} allow
+ * @param {[]string} deny
+ * @return {*}
+ */
+func (a *ACL) Reload(allow, deny []string) error {
+	rules := &aclRules{}
+	var errs error
+	if rules.allow, errs = parseCIDRs(allow); errs != nil {
+		return errs
+	}
+	if rules.deny, errs = parseCIDRs(deny); errs != nil {
+		return errs
+	}
+	a.rules.Store(rules)
+	return nil
+}
+
+func parseCIDRs(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, ipnet, errs := net.ParseCIDR(s)
+		if errs != nil {
+			return nil, errs
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipnet := range nets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * @description:检查ip是否允许连接
+ * @param {net.IP} ip
+ * @return {*}
+ */
+func (a *ACL) Allowed(ip net.IP) bool {
+	rules, _ := a.rules.Load().(*aclRules)
+	if rules == nil || ip == nil {
+		return rules == nil
+	}
+	// IPv4-mapped的IPv6地址按IPv4匹配
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if containsIP(rules.deny, ip) {
+		return false
+	}
+	return len(rules.allow) == 0 || containsIP(rules.allow, ip)
+}
+
+/**
+ * @description:检查ip并在拒绝时计数
+ * @param {string} address
+ * @return {*}
+ */
+func (a *ACL) check(address string) bool {
+	if a.Allowed(net.ParseIP(address)) {
+		return true
+	}
+	atomic.AddUint64(&a.rejected, 1)
+	return false
+}
+
+func aclDenied(address string) error {
+	return &err.ACL_DENIED_ERR{IP: address}
+}
+
+/**
+ * @description:累计被拒绝的连接数,可以在任意goroutine中调用
+ * @param {*}
+ * @return {*}
+ */
+func (a *ACL) Rejected() uint64 {
+	return atomic.LoadUint64(&a.rejected)
+}
+
+/**
+ * @description:为Listener设置访问控制列表,nil表示不限制;被拒绝的连接会立即关闭并触发OnReject
+ * @param {*ACL} acl
+ * @return {*}
+ */
+func (l *Listener) SetACL(acl *ACL) {
+	l.acl = acl
+}
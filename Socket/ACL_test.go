@@ -0,0 +1,124 @@
+/*
+ * @Description: ip访问控制列表测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-05 22:20:48
+ * @LastEditTime: 2021-08-05 22:45:13
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import (
+	"Reactloop/EventLoop"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestACL(t *testing.T) {
+	acl, e := NewACL([]string{"10.0.0.0/8", "fd00::/8", "192.168.1.7"}, []string{"10.1.0.0/16"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	cases := map[string]bool{
+		"10.2.3.4":         true,
+		"10.1.2.3":         false,
+		"::ffff:10.2.3.4":  true,
+		"fd12::1":          true,
+		"2001:db8::1":      false,
+		"192.168.1.7":      true,
+		"192.168.1.8":      false,
+		"not-an-ip":        false,
+		"::ffff:10.1.0.10": false,
+	}
+	for ip, want := range cases {
+		if got := acl.check(ip); got != want {
+			t.Errorf("%s: got %v want %v", ip, got, want)
+		}
+	}
+	if acl.Rejected() != 5 {
+		t.Fatalf("rejected %d", acl.Rejected())
+	}
+	// 热更新失败时保留原规则
+	if e := acl.Reload([]string{"bad"}, nil); e == nil || !acl.Allowed(net.ParseIP("10.2.3.4")) {
+		t.Fatal("invalid reload should keep old rules")
+	}
+	if e := acl.Reload(nil, []string{"0.0.0.0/0"}); e != nil || acl.Allowed(net.ParseIP("10.2.3.4")) || !acl.Allowed(net.ParseIP("fd12::1")) {
+		t.Fatal("reload not applied")
+	}
+}
+
+func TestACLTCP6(t *testing.T) {
+	acl, e := NewACL(nil, []string{"::1"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	l, e := NewListener("tcp6", "[::1]:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	l.SetACL(acl)
+	if e := l.BindAndListen(); e != nil {
+		t.Skip("IPv6 loopback unavailable:", e)
+	}
+	defer l.Close()
+	if getsockopt(t, l.fd, syscall.IPPROTO_IPV6, syscall.IPV6_V6ONLY) != 1 {
+		t.Fatal("tcp6 listener should be IPv6 only")
+	}
+	el := EventLoop.New()
+	var opened *Conn
+	el.AddSystemEvent(&EventLoop.Event{Open: func(el *EventLoop.EventLoop, _ *interface{}) {
+		opened = el.Source().(*Conn)
+	}})
+	l.RegisterAccept(el)
+	sa, _ := syscall.Getsockname(l.fd)
+	dial := func() net.Conn {
+		client, e := net.Dial("tcp6", netAddr(sa).String())
+		if e != nil {
+			t.Fatal(e)
+		}
+		return client
+	}
+
+	// IPv6的拒绝规则对tcp6连接生效
+	denied := dial()
+	defer denied.Close()
+	for i := 0; i < 10 && acl.Rejected() == 0; i++ {
+		el.TikTok()
+	}
+	if acl.Rejected() != 1 || opened != nil {
+		t.Fatalf("::1 should be rejected, rejected=%d", acl.Rejected())
+	}
+
+	if e := acl.Reload([]string{"::1/128"}, nil); e != nil {
+		t.Fatal(e)
+	}
+	allowed := dial()
+	defer allowed.Close()
+	for i := 0; i < 10 && opened == nil; i++ {
+		el.TikTok()
+	}
+	if opened == nil || opened.network != "tcp6" || opened.address != "::1" {
+		t.Fatal("::1 should be accepted over tcp6", opened)
+	}
+	opened.release(el, nil)
+}
+
+func TestGetSockAddrTCP6(t *testing.T) {
+	sa, e := getSockAddr("tcp6", "[::ffff:10.0.0.1]:80")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if sa6, ok := sa.(*syscall.SockaddrInet6); !ok || sa6.Port != 80 || net.IP(sa6.Addr[:]).String() != "10.0.0.1" {
+		t.Fatal("unexpected sockaddr", sa)
+	}
+	if sa, e := getSockAddr("tcp6", "[fe80::1%1]:80"); e != nil || sa.(*syscall.SockaddrInet6).ZoneId != 1 {
+		t.Fatal("zone not parsed", sa, e)
+	}
+	for _, addr := range []string{"127.0.0.1:80", "[::1]:x", "::1"} {
+		if _, e := getSockAddr("tcp6", addr); e == nil {
+			t.Errorf("%s should be rejected for tcp6", addr)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+/*
+ * @Description: 读端背压:手动暂停/恢复读,以及未消费的输入超过上限时自动暂停读
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-08 10:16:25
+ * @LastEditTime: 2021-08-08 16:02:47
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+// 暂停读的原因
+const (
+	pauseRate         uint8 = 1 << iota //限速
+	pauseUser                           //用户调用PauseRead
+	pauseBackpressure                   //未消费的输入超过上限
+)
+
+/**
+ * @description:因为某个原因暂停读(不再监听读事件),所有原因都解除后才恢复
+ * @param {uint8} reason
+ * @return {*}
+ */
+func (c *Conn) pauseRead(reason uint8) {
+	c.readPaused |= reason
+	c.updateInterest()
+}
+
+func (c *Conn) resumeRead(reason uint8) {
+	c.readPaused &^= reason
+	c.updateInterest()
+}
+
+/**
+ * @description:暂停从socket读取数据(不再监听读事件),数据留在内核缓冲区中,由TCP流控反压到对端
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) PauseRead() {
+	c.pauseRead(pauseUser)
+}
+
+/**
+ * @description:恢复读取,与PauseRead成对使用;限速等其他原因导致的暂停不受影响
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) ResumeRead() {
+	c.resumeRead(pauseUser)
+}
+
+/**
+ * @description:连接当前是否因为任何原因暂停了读
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) ReadPaused() bool {
+	return c.readPaused != 0
+}
+
+/**
+ * @description:设置未消费输入的上限,c.in超过上限时自动暂停读,消费到上限以下后自动恢复
+ * @param {int} n 0表示不限制
+ * @return {*}
+ */
+func (c *Conn) SetMaxPendingInput(n int) {
+	c.maxPending = n
+	c.checkPending()
+}
+
+/**
+ * @description:为Listener之后accept的连接设置默认的未消费输入上限
+ * @param {int} n 0表示不限制
+ * @return {*}
+ */
+func (l *Listener) SetMaxPendingInput(n int) {
+	l.maxPending = n
+}
+
+/**
+ * @description:还没有被Read/Discard消费的输入字节数
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) Pending() int {
+	return len(c.in)
+}
+
+/**
+ * @description:查看但不消费已经读到的数据,返回的切片在下一次Read/Discard之前有效
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) Peek() []byte {
+	return c.in
+}
+
+/**
+ * @description:消费前n个字节(只处理了部分数据的场景)
+ * @param {int} n
+ * @return {*}
+ */
+func (c *Conn) Discard(n int) {
+	if n > len(c.in) {
+		n = len(c.in)
+	}
+	c.in = c.in[n:]
+	c.checkPending()
+}
+
+/**
+ * @description:根据未消费输入的大小自动暂停或恢复读
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) checkPending() {
+	over := c.maxPending > 0 && len(c.in) >= c.maxPending
+	if over && c.readPaused&pauseBackpressure == 0 {
+		c.pauseRead(pauseBackpressure)
+	} else if !over && c.readPaused&pauseBackpressure != 0 {
+		c.resumeRead(pauseBackpressure)
+	}
+}
@@ -0,0 +1,36 @@
+/*
+ * @Description: 读端背压测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-08 15:40:09
+ * @LastEditTime: 2021-08-08 15:58:33
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import "testing"
+
+func TestBackpressure(t *testing.T) {
+	c := &Conn{Socket: &Socket{}}
+	c.SetMaxPendingInput(4)
+	c.in = []byte("abcdef")
+	c.checkPending()
+	if !c.ReadPaused() {
+		t.Fatal("should pause when pending input exceeds the limit")
+	}
+	c.PauseRead()
+	c.Discard(3)
+	if c.readPaused != pauseUser || string(c.Peek()) != "def" {
+		t.Fatalf("paused %b pending %q", c.readPaused, c.Peek())
+	}
+	c.ResumeRead()
+	if c.ReadPaused() {
+		t.Fatal("should resume after all reasons are cleared")
+	}
+	c.in = append(c.in, "ghij"...)
+	c.checkPending()
+	if got := string(c.Read()); got != "defghij" || c.ReadPaused() {
+		t.Fatalf("read %q paused %v", got, c.ReadPaused())
+	}
+}
@@ -0,0 +1,56 @@
+/*
+ * @Description: 连接上的字节变换层(如TLS),位于socket原始字节和用户读写的数据之间
+ * @Author: Rocky Hoo
+ * @Date: 2021-07-29 19:20:41
+ * @LastEditTime: 2021-07-29 22:05:13
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import (
+	"Reactloop/EventLoop"
+	enum "Reactloop/Utils/Enum"
+)
+
+/**
+ * @description:Codec接口,所有方法都在事件循环中调用
+ *  Decode:处理从socket读到的原始字节,返回交给Data回调的数据以及需要直接发回对端的字节(如握手消息);
+ *   不能阻塞,在事件循环之外完成的工作通过Conn.WakeCodec通知,随后以空输入再次调用Decode取走结果
+ *  Encode:将用户Write的数据转换成写入socket的字节
+ *  Ready:前置步骤(如握手)是否已经完成,完成之后才会触发Open
+ *  Close:连接关闭时释放资源
+ * @param {*}
+ * @return {*}
+ */
+type Codec interface {
+	Decode(raw []byte) (plain, reply []byte, err error)
+	Encode(plain []byte) ([]byte, error)
+	Ready() bool
+	Close()
+}
+
+// CodecFactory 为每个新建立的连接创建一个Codec
+type CodecFactory func(c *Conn) Codec
+
+/**
+ * @description:Codec在事件循环之外(如TLS的握手goroutine)产生了输出或者完成了前置步骤时调用,可以在任意goroutine中调用;
+ *  事件循环随后以空输入调用Decode,发送回复,Ready时补发Open,有明文时触发Data
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) WakeCodec() {
+	if c.loop == nil {
+		return
+	}
+	c.loop.Post(func(el *EventLoop.EventLoop) {
+		if c.closedCount >= 2 || c.codec == nil {
+			return
+		}
+		if c.deliver(el, nil) == enum.TRIGGER_DATA_EVENT {
+			el.TriggerFrom(c, enum.TRIGGER_DATA_EVENT, c)
+		}
+		c.updateInterest()
+	})
+}
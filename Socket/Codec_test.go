@@ -0,0 +1,46 @@
+/*
+ * @Description: Codec接入连接的测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-29 10:05:12
+ * @LastEditTime: 2021-08-29 10:40:36
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import (
+	"Reactloop/EventLoop"
+	"errors"
+	"syscall"
+	"testing"
+)
+
+// 编码总是失败的Codec
+type failingCodec struct{ err error }
+
+func (f *failingCodec) Decode(raw []byte) ([]byte, []byte, error) { return raw, nil, nil }
+func (f *failingCodec) Encode(plain []byte) ([]byte, error)       { return nil, f.err }
+func (f *failingCodec) Ready() bool                               { return true }
+func (f *failingCodec) Close()                                    {}
+
+func TestWriteEncodeError(t *testing.T) {
+	pair, errs := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	defer syscall.Close(pair[1])
+	el := EventLoop.New()
+	closed := 0
+	el.AddSystemEvent(&EventLoop.Event{Close: func(el *EventLoop.EventLoop, _ *interface{}) { closed++ }})
+	c, errs := AdoptConn(el, pair[0])
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	broken := errors.New("encode failed")
+	c.codec = &failingCodec{err: broken}
+	c.Write([]byte("hello"))
+	if c.Err() != broken || closed != 1 {
+		t.Fatalf("encode error should close the conn: err=%v closed=%d", c.Err(), closed)
+	}
+}
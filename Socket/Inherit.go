@@ -0,0 +1,119 @@
+/*
+ * @Description: 从已有的监听fd创建Listener(进程平滑重启时子进程继承父进程的监听套接字)
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-10 20:02:51
+ * @LastEditTime: 2021-08-10 22:31:20
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import (
+	"Reactloop/EventLoop"
+	enum "Reactloop/Utils/Enum"
+	err "Reactloop/Utils/Error"
+	"strconv"
+	"syscall"
+)
+
+/**
+ * @description:用一个已经处于listen状态的fd创建Listener,之后BindAndListen不会再执行bind/listen
+ * @param {int} fd
+ * @return {*}
+ */
+func NewListenerFromFd(fd int) (*Listener, error) {
+	sock, errs := socketFromListeningFd(fd)
+	if errs != nil {
+		return nil, errs
+	}
+	return &Listener{Socket: sock, limiter: newAcceptLimiter(), listening: true}, nil
+}
+
+/**
+ * @description:检查fd是监听中的流式套接字,并读取它绑定的地址
+ * @param {int} fd
+ * @return {*}
+ */
+func socketFromListeningFd(fd int) (*Socket, error) {
+	accepting, errs := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_ACCEPTCONN)
+	if errs != nil {
+		return nil, errs
+	}
+	if accepting == 0 {
+		return nil, &err.INHERIT_ERR{Fd: fd, Reason: "not listening"}
+	}
+	sa, errs := syscall.Getsockname(fd)
+	if errs != nil {
+		return nil, errs
+	}
+	network, address, port, errs := resolveSockaddrInfo(sa)
+	if errs != nil {
+		return nil, errs
+	}
+	if errs := syscall.SetNonblock(fd, true); errs != nil {
+		return nil, errs
+	}
+	syscall.CloseOnExec(fd)
+	return &Socket{
+		network: network,
+		address: address,
+		port:    port,
+		sa:      sa,
+		in:      []byte{},
+		out:     []byte{},
+		fd:      fd,
+	}, nil
+}
+
+/**
+ * @description:用继承得到的监听fd替换Listener自己创建的socket,地址必须一致
+ * @param {int} fd
+ * @return {*}
+ */
+func (l *Listener) Adopt(fd int) error {
+	sock, errs := socketFromListeningFd(fd)
+	if errs != nil {
+		return errs
+	}
+	if sock.network != l.network || sock.address != l.address || sock.port != l.port {
+		return &err.INHERIT_ERR{Fd: fd, Reason: "bound to " + sock.network + " " + sock.address + ":" + strconv.Itoa(sock.port)}
+	}
+	syscall.Close(l.fd)
+	l.Socket = sock
+	l.listening = true
+	return nil
+}
+
+/**
+ * @description:监听套接字的fd
+ * @param {*}
+ * @return {*}
+ */
+func (l *Listener) Fd() int {
+	return l.fd
+}
+
+/**
+ * @description:Listener的唯一标识"network:address:port",用于在新旧进程之间匹配监听套接字
+ * @param {*}
+ * @return {*}
+ */
+func (l *Listener) Key() string {
+	return l.network + ":" + l.address + ":" + strconv.Itoa(l.port)
+}
+
+/**
+ * @description:停止accept:从事件循环中注销并关闭监听套接字,已经建立的连接不受影响
+ * @param {*EventLoop.EventLoop} el
+ * @return {*}
+ */
+func (l *Listener) StopAccept(el *EventLoop.EventLoop) {
+	if l.closedCount >= 2 {
+		return
+	}
+	if !l.limiter.paused {
+		el.UnRegisterEvent(l.fd, enum.EVENT_READABLE)
+	}
+	l.Close()
+}
@@ -0,0 +1,99 @@
+/*
+ * @Description: 继承监听fd以及SCM_RIGHTS传递fd的测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-10 21:48:30
+ * @LastEditTime: 2021-08-10 22:20:11
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import (
+	err "Reactloop/Utils/Error"
+	"errors"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestInheritListener(t *testing.T) {
+	l, err := NewListener("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.BindAndListen(); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	sa, _ := syscall.Getsockname(l.fd)
+	l.port = sa.(*syscall.SockaddrInet4).Port
+
+	pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(pair[0])
+	defer syscall.Close(pair[1])
+	if err := SendFds(pair[0], []byte(l.Key()), l.fd); err != nil {
+		t.Fatal(err)
+	}
+	data, fds, err := RecvFds(pair[1], 256)
+	if err != nil || len(fds) != 1 {
+		t.Fatal(fds, err)
+	}
+	if string(data) != l.Key() {
+		t.Fatalf("key %q", data)
+	}
+
+	adopted, err := NewListener("tcp4", "127.0.0.1:"+strconv.Itoa(l.port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := adopted.Adopt(fds[0]); err != nil {
+		t.Fatal(err)
+	}
+	defer adopted.Close()
+	if adopted.Key() != l.Key() || !adopted.listening {
+		t.Fatalf("adopted %s", adopted.Key())
+	}
+	if err := adopted.BindAndListen(); err != nil {
+		t.Fatal("adopted listener should skip bind", err)
+	}
+
+	other, _ := NewListener("tcp4", "127.0.0.1:1")
+	defer other.Close()
+	dup, _ := syscall.Dup(l.fd)
+	if err := other.Adopt(dup); err == nil {
+		t.Fatal("expected address mismatch")
+	}
+	syscall.Close(dup)
+	if _, err := NewListenerFromFd(pair[0]); err == nil {
+		t.Fatal("expected error for non-listening fd")
+	}
+}
+
+func TestInheritErrors(t *testing.T) {
+	l, errs := NewListener("tcp4", "127.0.0.1:0")
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	if errs := l.BindAndListen(); errs != nil {
+		t.Fatal(errs)
+	}
+	defer l.Close()
+	other, _ := NewListener("tcp4", "127.0.0.1:1")
+	defer other.Close()
+	dup, _ := syscall.Dup(l.fd)
+	defer syscall.Close(dup)
+	var inherit *err.INHERIT_ERR
+	if errs := other.Adopt(dup); !errors.As(errs, &inherit) || inherit.Fd != dup || errors.Is(errs, err.ErrUnknownNetwork) {
+		t.Fatal("expected INHERIT_ERR for address mismatch", errs)
+	}
+	pair, _ := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	defer syscall.Close(pair[0])
+	defer syscall.Close(pair[1])
+	if _, errs := NewListenerFromFd(pair[0]); !errors.As(errs, &inherit) || inherit.Reason != "not listening" {
+		t.Fatal("expected INHERIT_ERR for non-listening fd", errs)
+	}
+}
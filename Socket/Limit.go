@@ -0,0 +1,234 @@
+/*
+ * @Description: Listener的连接数限制与accept限流:总连接数/单ip连接数限制,fd耗尽时的预留fd与退避,可配置的backlog
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-03 09:50:04
+ * @LastEditTime: 2021-08-03 18:26:51
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import (
+	"Reactloop/EventLoop"
+	enum "Reactloop/Utils/Enum"
+	err "Reactloop/Utils/Error"
+	logger "Reactloop/Utils/Log"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultBacklog       = 1024
+	defaultAcceptBackoff = 100 * time.Millisecond
+)
+
+/**
+ * @description:连接数限制,0表示不限制
+ *  AcceptBackoff:fd耗尽且预留fd也无法使用时暂停accept的时间,0使用默认值100ms
+ * @param {*}
+ * @return {*}
+ */
+type Limits struct {
+	MaxConns      int
+	MaxConnsPerIP int
+	AcceptBackoff time.Duration
+}
+
+/**
+ * @description:连接被拒绝时的回调
+ * @param {*EventLoop.EventLoop} el
+ * @param {string} address 对端ip
+ * @param {int} port 对端端口
+ * @param {error} reason 超出限制时为CONN_LIMIT_ERR,fd耗尽时为对应的syscall.Errno
+ * @return {*}
+ */
+type RejectHandler func(el *EventLoop.EventLoop, address string, port int, reason error)
+
+// Listener上的连接计数与限流状态
+type acceptLimiter struct {
+	Limits
+	backlog  int
+	onReject RejectHandler
+	active   int            //当前连接总数
+	perIP    map[string]int //每个ip的连接数
+	reserved int            //预留的fd,fd耗尽时关闭它腾出一个fd来accept并拒绝新连接
+	paused   bool           //是否处于退避状态(暂停accept)
+}
+
+func newAcceptLimiter() acceptLimiter {
+	return acceptLimiter{
+		backlog:  defaultBacklog,
+		perIP:    map[string]int{},
+		reserved: -1,
+	}
+}
+
+/**
+ * @description:设置连接数限制
+ * @param {Limits} lim
+ * @return {*}
+ */
+func (l *Listener) SetLimits(lim Limits) {
+	l.limiter.Limits = lim
+}
+
+/**
+ * @description:设置listen的backlog(未完成与已完成连接队列的容量),需要在BindAndListen之前调用
+ * @param {int} backlog
+ * @return {*}
+ */
+func (l *Listener) SetBacklog(backlog int) {
+	if backlog <= 0 {
+		backlog = defaultBacklog
+	}
+	l.limiter.backlog = backlog
+}
+
+/**
+ * @description:设置连接被拒绝时的回调
+ * @param {RejectHandler} fn
+ * @return {*}
+ */
+func (l *Listener) OnReject(fn RejectHandler) {
+	l.limiter.onReject = fn
+}
+
+/**
+ * @description:当前通过该Listener建立且还没有关闭的连接数
+ * @param {*}
+ * @return {*}
+ */
+func (l *Listener) ActiveConns() int {
+	return l.limiter.active
+}
+
+/**
+ * @description:打开预留fd
+ * @param {*}
+ * @return {*}
+ */
+func (l *Listener) reserveFd() {
+	if l.limiter.reserved >= 0 {
+		return
+	}
+	fd, errs := syscall.Open("/dev/null", syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+	if errs == nil {
+		l.limiter.reserved = fd
+	}
+}
+
+func (l *Listener) releaseReservedFd() {
+	if l.limiter.reserved >= 0 {
+		syscall.Close(l.limiter.reserved)
+		l.limiter.reserved = -1
+	}
+}
+
+func (l *Listener) reject(el *EventLoop.EventLoop, sa syscall.Sockaddr, reason error) {
+	l.metrics.reject()
+	_, address, port, errs := resolveSockaddrInfo(sa)
+	if errs != nil {
+		return
+	}
+	el.Logger().Log(logger.DEBUG, "Socket-reject:拒绝连接", logger.F("listener", l.Key()),
+		logger.Remote(address+":"+strconv.Itoa(port)), logger.Err(reason))
+	if l.limiter.onReject == nil {
+		return
+	}
+	l.limiter.onReject(el, address, port, reason)
+}
+
+/**
+ * @description:检查新连接是否超出限制,没有超出时计入连接数
+ * @param {string} ip
+ * @return {*}
+ */
+func (l *Listener) admit(ip string) error {
+	lim := &l.limiter
+	if lim.MaxConns > 0 && lim.active >= lim.MaxConns {
+		return &err.CONN_LIMIT_ERR{Limit: lim.MaxConns}
+	}
+	if lim.MaxConnsPerIP > 0 && lim.perIP[ip] >= lim.MaxConnsPerIP {
+		return &err.CONN_LIMIT_ERR{Limit: lim.MaxConnsPerIP, PerIP: true}
+	}
+	lim.active++
+	lim.perIP[ip]++
+	l.metrics.admit()
+	return nil
+}
+
+/**
+ * @description:连接关闭时归还计数
+ * @param {string} ip
+ * @return {*}
+ */
+func (l *Listener) leave(ip string) {
+	lim := &l.limiter
+	lim.active--
+	l.metrics.leave()
+	if lim.perIP[ip] <= 1 {
+		delete(lim.perIP, ip)
+	} else {
+		lim.perIP[ip]--
+	}
+}
+
+/**
+ * @description:accept因为fd耗尽失败:先关闭预留fd腾出一个fd,accept后立即关闭以拒绝该连接,
+ *  避免连接一直留在队列中导致epoll不断触发;预留fd无法使用时暂停accept一段时间
+ * @param {*EventLoop.EventLoop} el
+ * @param {error} reason
+ * @return {*}
+ */
+func (l *Listener) handleFdExhausted(el *EventLoop.EventLoop, reason error) {
+	el.ReportError(reason, logger.Fd(l.fd), logger.F("listener", l.Key()))
+	if l.limiter.reserved >= 0 {
+		l.releaseReservedFd()
+		if confd, sa, errs := syscall.Accept(l.fd); errs == nil {
+			syscall.Close(confd)
+			l.reject(el, sa, reason)
+		}
+		l.reserveFd()
+		if l.limiter.reserved >= 0 {
+			return
+		}
+	}
+	l.pauseAccept(el)
+}
+
+/**
+ * @description:暂停accept,退避时间过后重新注册accept事件
+ * @param {*EventLoop.EventLoop} el
+ * @return {*}
+ */
+func (l *Listener) pauseAccept(el *EventLoop.EventLoop) {
+	if l.limiter.paused {
+		return
+	}
+	backoff := l.limiter.AcceptBackoff
+	if backoff <= 0 {
+		backoff = defaultAcceptBackoff
+	}
+	l.limiter.paused = true
+	el.UnRegisterEvent(l.fd, enum.EVENT_READABLE)
+	el.AddTimer(backoff, func(el *EventLoop.EventLoop, _ *interface{}) {
+		l.limiter.paused = false
+		if l.closedCount >= 2 {
+			return
+		}
+		l.reserveFd()
+		l.RegisterAccept(el)
+	})
+}
+
+/**
+ * @description: 关闭监听套接字以及预留fd
+ * @param  {*}
+ * @return {*}
+ */
+func (l *Listener) Close() error {
+	l.releaseReservedFd()
+	return l.Socket.Close()
+}
@@ -0,0 +1,38 @@
+/*
+ * @Description: 连接数限制测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-03 17:55:21
+ * @LastEditTime: 2021-08-03 18:20:09
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import (
+	err "Reactloop/Utils/Error"
+	"testing"
+)
+
+func TestAdmit(t *testing.T) {
+	l := &Listener{limiter: newAcceptLimiter()}
+	l.SetLimits(Limits{MaxConns: 3, MaxConnsPerIP: 2})
+	for _, ip := range []string{"10.0.0.1", "10.0.0.1", "10.0.0.2"} {
+		if e := l.admit(ip); e != nil {
+			t.Fatal(e)
+		}
+	}
+	if e, ok := l.admit("10.0.0.3").(*err.CONN_LIMIT_ERR); !ok || e.PerIP {
+		t.Fatalf("expected total limit, got %v", e)
+	}
+	l.leave("10.0.0.2")
+	if e, ok := l.admit("10.0.0.1").(*err.CONN_LIMIT_ERR); !ok || !e.PerIP {
+		t.Fatalf("expected per ip limit, got %v", e)
+	}
+	if e := l.admit("10.0.0.3"); e != nil {
+		t.Fatal(e)
+	}
+	if l.ActiveConns() != 3 || len(l.limiter.perIP) != 2 {
+		t.Fatalf("active %d perIP %v", l.ActiveConns(), l.limiter.perIP)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * @Description: Listener的指标:accept/拒绝/关闭的连接数、当前连接数以及收发字节数,
+ *  没有开启指标时listenerMetrics为nil,所有方法都是空操作
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-21 11:40:09
+ * @LastEditTime: 2021-08-21 15:18:51
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import "Reactloop/Metrics"
+
+type listenerMetrics struct {
+	accepted, rejected, closed *Metrics.Counter
+	active                     *Metrics.Gauge
+	bytesIn, bytesOut          *Metrics.Counter
+}
+
+/**
+ * @description:开启该Listener的指标采集,指标带有listener="name"标签
+ * @param {*Metrics.Registry} reg 为nil时使用Metrics.Default
+ * @param {string} name 为空时使用Key()
+ * @return {*}
+ */
+func (l *Listener) EnableMetrics(reg *Metrics.Registry, name string) {
+	if reg == nil {
+		reg = Metrics.Default
+	}
+	if name == "" {
+		name = l.Key()
+	}
+	labels := Metrics.Labels{"listener": name}
+	l.metrics = &listenerMetrics{
+		accepted: reg.Counter("reactloop_listener_accepted_total",
+			"Connections accepted and admitted by the listener.", labels),
+		rejected: reg.Counter("reactloop_listener_rejected_total",
+			"Connections rejected by ACL, limits or resource exhaustion.", labels),
+		closed: reg.Counter("reactloop_listener_closed_total",
+			"Accepted connections that have been closed.", labels),
+		active: reg.Gauge("reactloop_listener_active_connections",
+			"Connections currently open on the listener.", labels),
+		bytesIn: reg.Counter("reactloop_listener_received_bytes_total",
+			"Bytes read from connections of the listener.", labels),
+		bytesOut: reg.Counter("reactloop_listener_sent_bytes_total",
+			"Bytes written to connections of the listener.", labels),
+	}
+	l.metrics.active.Set(int64(l.limiter.active))
+}
+
+func (m *listenerMetrics) admit() {
+	if m == nil {
+		return
+	}
+	m.accepted.Inc()
+	m.active.Inc()
+}
+
+func (m *listenerMetrics) leave() {
+	if m == nil {
+		return
+	}
+	m.closed.Inc()
+	m.active.Dec()
+}
+
+func (m *listenerMetrics) reject() {
+	if m == nil {
+		return
+	}
+	m.rejected.Inc()
+}
+
+// 记录连接读到的字节数
+func (c *Conn) countIn(n int) {
+	if c.listener == nil || c.listener.metrics == nil {
+		return
+	}
+	c.listener.metrics.bytesIn.Add(uint64(n))
+}
+
+// 记录连接写出的字节数
+func (c *Conn) countOut(n int) {
+	if c.listener == nil || c.listener.metrics == nil {
+		return
+	}
+	c.listener.metrics.bytesOut.Add(uint64(n))
+}
@@ -0,0 +1,428 @@
+/*
+ * @Description: net.Listener/net.Conn适配器:把事件循环上的连接桥接为阻塞的Read/Write(支持deadline),
+ *  可以直接交给net/http等使用标准接口的库;事件循环一侧只在回调和Post的任务中访问Conn,
+ *  调用方goroutine只访问桥接的缓冲区
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-25 09:47:21
+ * @LastEditTime: 2021-08-25 16:32:08
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import (
+	"Reactloop/EventLoop"
+	err "Reactloop/Utils/Error"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	netReadHighWater  = 1 << 20 //桥接的读缓冲超过该值时暂停读
+	netReadLowWater   = 1 << 18 //暂停后读缓冲降到该值以下时恢复读
+	netWriteHighWater = 1 << 20 //待发送数据超过该值时Write等待数据写出
+)
+
+// 适配为net.Conn的连接
+type netConn struct {
+	c      *Conn
+	el     *EventLoop.EventLoop
+	local  net.Addr
+	remote net.Addr
+
+	mu       sync.Mutex
+	wake     chan struct{} //状态变化时关闭并替换,用于唤醒所有等待的Read/Write
+	done     chan struct{} //连接关闭后关闭
+	in       []byte        //已经从事件循环读到,还没有被Read取走的数据
+	rerr     error         //读完缓冲后返回的错误(对端关闭为io.EOF)
+	paused   bool          //是否因为读缓冲过多暂停了读
+	closed   bool          //是否已经调用Close
+	finished bool          //连接是否已经在事件循环中关闭
+	rdl, wdl time.Time     //读写deadline,零值表示不限制
+}
+
+/**
+ * @description:把连接适配为net.Conn,需要在事件循环中调用(如Open回调中);之后该连接上的Data/Close
+ *  只交给适配器处理,不再触发Listener或者事件循环的回调,已经读到还没有消费的数据可以通过Read读出
+ * @param {*Conn} c
+ * @return {*}
+ */
+func NewNetConn(c *Conn) net.Conn {
+	nc := &netConn{
+		c:      c,
+		el:     c.loop,
+		remote: netAddr(c.sa),
+		wake:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if sa, errs := syscall.Getsockname(c.fd); errs == nil {
+		nc.local = netAddr(sa)
+	}
+	c.events = []*EventLoop.Event{{Data: nc.onData, Close: nc.onClose}}
+	nc.in = c.Read()
+	if c.closedCount >= 2 {
+		nc.onClose(c.loop, nil)
+	}
+	return nc
+}
+
+// 状态变化,唤醒所有等待者;需要持有锁
+func (nc *netConn) broadcast() {
+	close(nc.wake)
+	nc.wake = make(chan struct{})
+}
+
+// Data回调(事件循环中):数据移入桥接缓冲,过多时暂停读
+func (nc *netConn) onData(el *EventLoop.EventLoop, _ *interface{}) {
+	data := nc.c.Read()
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	if nc.closed {
+		return
+	}
+	nc.in = append(nc.in, data...)
+	if len(nc.in) > netReadHighWater && !nc.paused {
+		nc.paused = true
+		nc.c.PauseRead()
+	}
+	nc.broadcast()
+}
+
+// Close回调(事件循环中):缓冲读完后返回关闭原因
+func (nc *netConn) onClose(el *EventLoop.EventLoop, _ *interface{}) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	if nc.finished {
+		return
+	}
+	nc.finished = true
+	nc.rerr = nc.c.Err()
+	if nc.rerr == nil {
+		nc.rerr = io.EOF
+	}
+	close(nc.done)
+	nc.broadcast()
+}
+
+/**
+ * @description:等待状态变化或者deadline到期
+ * @param {time.Time} deadline
+ * @param {chan struct{}} wake 持有锁时取得的唤醒通道
+ * @return {*}
+ */
+func waitFor(deadline time.Time, wake chan struct{}) {
+	if deadline.IsZero() {
+		<-wake
+		return
+	}
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case <-wake:
+	case <-timer.C:
+	}
+}
+
+func expired(deadline time.Time) bool {
+	return !deadline.IsZero() && !time.Now().Before(deadline)
+}
+
+func (nc *netConn) Read(b []byte) (int, error) {
+	nc.mu.Lock()
+	for {
+		if nc.closed {
+			nc.mu.Unlock()
+			return 0, &err.CLOSED_ERR{Op: "read"}
+		}
+		if len(nc.in) > 0 {
+			n := copy(b, nc.in)
+			nc.in = nc.in[n:]
+			if nc.paused && len(nc.in) < netReadLowWater {
+				nc.paused = false
+				c := nc.c
+				nc.el.Post(func(el *EventLoop.EventLoop) { c.ResumeRead() })
+			}
+			nc.mu.Unlock()
+			return n, nil
+		}
+		if nc.rerr != nil {
+			nc.mu.Unlock()
+			return 0, nc.rerr
+		}
+		if expired(nc.rdl) {
+			nc.mu.Unlock()
+			return 0, os.ErrDeadlineExceeded
+		}
+		deadline, wake := nc.rdl, nc.wake
+		nc.mu.Unlock()
+		waitFor(deadline, wake)
+		nc.mu.Lock()
+	}
+}
+
+// 一次Write的数据所处的状态
+const (
+	writePending   = iota //已经Post,事件循环还没有处理
+	writeQueued           //已经交给连接,等待待发送数据降到上限以下
+	writeDone             //已经交给连接且不需要再等待
+	writeCancelled        //事件循环处理之前因为deadline或者关闭被取消,数据不会发送
+	writeDropped          //事件循环处理时连接已经关闭,数据不会发送
+)
+
+/**
+ * @description:把数据交给事件循环发送,待发送数据过多时等待写出到内核后才返回;
+ *  数据已经交给连接后即认为写入成功(之后的deadline或者关闭只影响下一次Write),避免调用方重试时重复发送
+ * @param {[]byte} b
+ * @return {*}
+ */
+func (nc *netConn) Write(b []byte) (int, error) {
+	nc.mu.Lock()
+	if nc.closed {
+		nc.mu.Unlock()
+		return 0, &err.CLOSED_ERR{Op: "write"}
+	}
+	if nc.finished {
+		nc.mu.Unlock()
+		return 0, syscall.EPIPE
+	}
+	if expired(nc.wdl) {
+		nc.mu.Unlock()
+		return 0, os.ErrDeadlineExceeded
+	}
+	nc.mu.Unlock()
+
+	data := append([]byte{}, b...)
+	state := writePending //由nc.mu保护
+	c := nc.c
+	if errs := nc.el.Post(func(el *EventLoop.EventLoop) {
+		nc.mu.Lock()
+		if state == writeCancelled {
+			nc.mu.Unlock()
+			return
+		}
+		if c.closedCount >= 2 {
+			state = writeDropped
+			nc.broadcast()
+			nc.mu.Unlock()
+			return
+		}
+		state = writeQueued
+		nc.mu.Unlock()
+		c.Write(data)
+		if len(c.out) > netWriteHighWater {
+			c.onDrain = append(c.onDrain, func() { nc.writeFinished(&state) })
+			return
+		}
+		nc.writeFinished(&state)
+	}); errs != nil {
+		return 0, errs
+	}
+	nc.mu.Lock()
+	for {
+		switch state {
+		case writeDone:
+			nc.mu.Unlock()
+			return len(b), nil
+		case writeDropped:
+			nc.mu.Unlock()
+			return 0, syscall.EPIPE
+		}
+		var errs error
+		switch {
+		case nc.closed:
+			errs = &err.CLOSED_ERR{Op: "write"}
+		case nc.finished:
+			errs = syscall.EPIPE
+		case expired(nc.wdl):
+			errs = os.ErrDeadlineExceeded
+		}
+		if errs != nil {
+			if state == writePending {
+				state = writeCancelled
+				nc.mu.Unlock()
+				return 0, errs
+			}
+			// 数据已经交给连接,之后会被发送(或者随连接关闭丢弃),错误由下一次Write返回
+			nc.mu.Unlock()
+			return len(b), nil
+		}
+		deadline, wake := nc.wdl, nc.wake
+		nc.mu.Unlock()
+		waitFor(deadline, wake)
+		nc.mu.Lock()
+	}
+}
+
+// 事件循环中:一次Write的数据已经交给连接且不需要再等待
+func (nc *netConn) writeFinished(state *int) {
+	nc.mu.Lock()
+	if *state == writeQueued {
+		*state = writeDone
+	}
+	nc.broadcast()
+	nc.mu.Unlock()
+}
+
+/**
+ * @description:关闭连接,已经交给事件循环的数据会先发送完
+ * @param {*}
+ * @return {*}
+ */
+func (nc *netConn) Close() error {
+	nc.mu.Lock()
+	if nc.closed {
+		nc.mu.Unlock()
+		return &err.CLOSED_ERR{Op: "close"}
+	}
+	nc.closed = true
+	nc.broadcast()
+	nc.mu.Unlock()
+	c := nc.c
+	nc.el.Post(func(el *EventLoop.EventLoop) {
+		if c.closedCount < 2 {
+			c.CloseAfterFlush()
+		}
+	})
+	return nil
+}
+
+func (nc *netConn) LocalAddr() net.Addr {
+	return nc.local
+}
+
+func (nc *netConn) RemoteAddr() net.Addr {
+	return nc.remote
+}
+
+func (nc *netConn) SetDeadline(t time.Time) error {
+	nc.mu.Lock()
+	nc.rdl, nc.wdl = t, t
+	nc.broadcast()
+	nc.mu.Unlock()
+	return nil
+}
+
+func (nc *netConn) SetReadDeadline(t time.Time) error {
+	nc.mu.Lock()
+	nc.rdl = t
+	nc.broadcast()
+	nc.mu.Unlock()
+	return nil
+}
+
+func (nc *netConn) SetWriteDeadline(t time.Time) error {
+	nc.mu.Lock()
+	nc.wdl = t
+	nc.broadcast()
+	nc.mu.Unlock()
+	return nil
+}
+
+// 适配为net.Listener的监听套接字
+type netListener struct {
+	l      *Listener
+	mu     sync.Mutex
+	wake   chan struct{}
+	queue  []net.Conn
+	closed bool
+}
+
+/**
+ * @description:把Listener适配为net.Listener:Listener上的连接只交给Accept,不再触发其他回调;
+ *  Listener仍然需要通过Server.AddListener或者BindAndListen+RegisterAccept挂到运行中的事件循环上
+ * @param {*Listener} l
+ * @return {*}
+ */
+func NewNetListener(l *Listener) net.Listener {
+	nl := &netListener{l: l, wake: make(chan struct{})}
+	l.SetEvents([]*EventLoop.Event{{Open: nl.onOpen}})
+	return nl
+}
+
+// Open回调(事件循环中):把连接放入Accept队列
+func (nl *netListener) onOpen(el *EventLoop.EventLoop, _ *interface{}) {
+	c, ok := el.Source().(*Conn)
+	if !ok {
+		return
+	}
+	nl.mu.Lock()
+	defer nl.mu.Unlock()
+	if nl.closed {
+		c.CloseWithError(&err.CLOSED_ERR{Op: "accept"})
+		return
+	}
+	nl.queue = append(nl.queue, NewNetConn(c))
+	close(nl.wake)
+	nl.wake = make(chan struct{})
+}
+
+func (nl *netListener) Accept() (net.Conn, error) {
+	nl.mu.Lock()
+	for {
+		if nl.closed {
+			nl.mu.Unlock()
+			return nil, &err.CLOSED_ERR{Op: "accept"}
+		}
+		if len(nl.queue) > 0 {
+			nc := nl.queue[0]
+			nl.queue = nl.queue[1:]
+			nl.mu.Unlock()
+			return nc, nil
+		}
+		wake := nl.wake
+		nl.mu.Unlock()
+		<-wake
+		nl.mu.Lock()
+	}
+}
+
+/**
+ * @description:停止accept并关闭还没有被Accept取走的连接,已经取走的连接不受影响
+ * @param {*}
+ * @return {*}
+ */
+func (nl *netListener) Close() error {
+	nl.mu.Lock()
+	if nl.closed {
+		nl.mu.Unlock()
+		return &err.CLOSED_ERR{Op: "close"}
+	}
+	nl.closed = true
+	pending := nl.queue
+	nl.queue = nil
+	close(nl.wake)
+	nl.mu.Unlock()
+	for _, nc := range pending {
+		nc.Close()
+	}
+	l := nl.l
+	if l.loop == nil {
+		return l.Close()
+	}
+	return l.loop.Post(func(el *EventLoop.EventLoop) { l.StopAccept(el) })
+}
+
+func (nl *netListener) Addr() net.Addr {
+	if sa, errs := syscall.Getsockname(nl.l.fd); errs == nil {
+		return netAddr(sa)
+	}
+	return netAddr(nl.l.sa)
+}
+
+// syscall.Sockaddr转换为net.Addr
+func netAddr(sa syscall.Sockaddr) net.Addr {
+	switch a := sa.(type) {
+	case *syscall.SockaddrInet4:
+		return &net.TCPAddr{IP: net.IPv4(a.Addr[0], a.Addr[1], a.Addr[2], a.Addr[3]), Port: a.Port}
+	case *syscall.SockaddrInet6:
+		return &net.TCPAddr{IP: append(net.IP{}, a.Addr[:]...), Port: a.Port}
+	case *syscall.SockaddrUnix:
+		return &net.UnixAddr{Name: a.Name, Net: "unix"}
+	}
+	return nil
+}
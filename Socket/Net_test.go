@@ -0,0 +1,157 @@
+/*
+ * @Description: net.Listener/net.Conn适配器测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-25 14:12:37
+ * @LastEditTime: 2021-08-25 16:20:51
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import (
+	"Reactloop/EventLoop"
+	err "Reactloop/Utils/Error"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNetAdapters(t *testing.T) {
+	l, errs := NewListener("tcp4", "127.0.0.1:0")
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	if errs := l.BindAndListen(); errs != nil {
+		t.Fatal(errs)
+	}
+	nl := NewNetListener(l)
+	el := EventLoop.New()
+	if errs := l.RegisterAccept(el); errs != nil {
+		t.Fatal(errs)
+	}
+	go el.Run()
+	defer el.Post(func(el *EventLoop.EventLoop) { el.Done() })
+	addr := nl.Addr().String()
+
+	// 原始连接:读deadline与对端关闭
+	raw, errs := net.Dial("tcp4", addr)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	conn, errs := nl.Accept()
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	if conn.RemoteAddr().String() != raw.LocalAddr().String() || conn.LocalAddr().String() != addr {
+		t.Fatalf("addr local %v remote %v", conn.LocalAddr(), conn.RemoteAddr())
+	}
+	buf := make([]byte, 16)
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, errs := conn.Read(buf); !errors.Is(errs, os.ErrDeadlineExceeded) {
+		t.Fatal("read should time out", errs)
+	}
+	conn.SetReadDeadline(time.Time{})
+	raw.Write([]byte("ping"))
+	if n, errs := conn.Read(buf); errs != nil || string(buf[:n]) != "ping" {
+		t.Fatalf("read %q %v", buf[:n], errs)
+	}
+	if _, errs := conn.Write([]byte("pong")); errs != nil {
+		t.Fatal(errs)
+	}
+	if n, _ := raw.Read(buf); string(buf[:n]) != "pong" {
+		t.Fatalf("peer read %q", buf[:n])
+	}
+	raw.Close()
+	if _, errs := conn.Read(buf); errs != io.EOF {
+		t.Fatal("read after peer close", errs)
+	}
+	conn.Close()
+	if _, errs := conn.Write([]byte("x")); !errors.Is(errs, err.ErrClosed) {
+		t.Fatal("write after close", errs)
+	}
+
+	// net/http直接运行在适配器上
+	go http.Serve(nl, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte("echo:" + string(body)))
+	}))
+	client := &http.Client{Timeout: 5 * time.Second}
+	for i := 0; i < 3; i++ {
+		resp, errs := client.Post("http://"+addr+"/", "text/plain", strings.NewReader("hello"))
+		if errs != nil {
+			t.Fatal(errs)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "echo:hello" {
+			t.Fatalf("response %q", body)
+		}
+	}
+	client.CloseIdleConnections()
+
+	if errs := nl.Close(); errs != nil {
+		t.Fatal(errs)
+	}
+	if _, errs := nl.Accept(); !errors.Is(errs, err.ErrClosed) {
+		t.Fatal("accept after close", errs)
+	}
+}
+
+func TestNetConnWriteDeadline(t *testing.T) {
+	l, errs := NewListener("tcp4", "127.0.0.1:0")
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	if errs := l.BindAndListen(); errs != nil {
+		t.Fatal(errs)
+	}
+	nl := NewNetListener(l)
+	el := EventLoop.New()
+	l.RegisterAccept(el)
+	go el.Run()
+	defer el.Post(func(el *EventLoop.EventLoop) { el.Done() })
+	defer nl.Close()
+	raw, errs := net.Dial("tcp4", nl.Addr().String())
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	defer raw.Close()
+	conn, errs := nl.Accept()
+	if errs != nil {
+		t.Fatal(errs)
+	}
+
+	// 对端不读,写到deadline到期为止;返回的字节数必须与对端实际收到的一致
+	conn.SetWriteDeadline(time.Now().Add(200 * time.Millisecond))
+	chunk := make([]byte, 2<<20)
+	total := 0
+	for i := 0; i < 100; i++ {
+		n, errs := conn.Write(chunk)
+		total += n
+		if errs != nil {
+			if !errors.Is(errs, os.ErrDeadlineExceeded) || n != 0 {
+				t.Fatalf("write returned %d %v", n, errs)
+			}
+			break
+		}
+	}
+	if total == 0 {
+		t.Fatal("nothing written")
+	}
+	raw.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, errs := io.ReadFull(raw, make([]byte, total)); errs != nil {
+		t.Fatal("peer missing reported bytes", errs)
+	}
+	raw.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if n, _ := raw.Read(make([]byte, 1)); n != 0 {
+		t.Fatal("peer received bytes that Write reported as not written")
+	}
+	conn.Close()
+}
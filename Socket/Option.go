@@ -0,0 +1,262 @@
+/*
+ * @Description: 套接字选项:TCP_NODELAY、keepalive、收发缓冲区、SO_LINGER、TCP_FASTOPEN、TCP_DEFER_ACCEPT、IP_TOS;
+ *  Listener上的选项在listen时设置,并应用到之后accept的连接上,单个连接可以再覆盖
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-26 09:18:42
+ * @LastEditTime: 2021-08-26 15:47:05
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import (
+	err "Reactloop/Utils/Error"
+	"syscall"
+	"time"
+)
+
+// syscall包中没有定义TCP_FASTOPEN
+const tcpFastOpen = 0x17
+
+/**
+ * @description:套接字选项,零值表示不修改系统默认值
+ *  NoDelay:关闭Nagle算法
+ *  KeepAlive:开启TCP保活;KeepIdle/KeepInterval/KeepCount为空闲多久开始探测、探测间隔和探测次数(精度为秒)
+ *  RecvBuf/SendBuf:SO_RCVBUF/SO_SNDBUF,需要大于64K的接收窗口时应在listen前设置
+ *  Linger:>0时close最多等待该时长发送剩余数据(连接的close在后台goroutine中执行,不阻塞事件循环);
+ *   <0时close直接丢弃未发送数据并发送RST
+ *  FastOpen:TCP_FASTOPEN的队列长度,只对Listener有效
+ *  DeferAccept:TCP_DEFER_ACCEPT,连接收到数据后(最多等待该时长)才能被accept,只对Listener有效
+ *  TOS:IP_TOS(如DSCP标记),tcp6上设置IPV6_TCLASS
+ *  Unix域套接字只应用RecvBuf/SendBuf/Linger
+ * @param {*}
+ * @return {*}
+ */
+type SockOpts struct {
+	NoDelay      bool
+	KeepAlive    bool
+	KeepIdle     time.Duration
+	KeepInterval time.Duration
+	KeepCount    int
+	RecvBuf      int
+	SendBuf      int
+	Linger       time.Duration
+	FastOpen     int
+	DeferAccept  time.Duration
+	TOS          int
+}
+
+// 时长换算为秒,不足1秒按1秒
+func seconds(d time.Duration) int {
+	s := int((d + time.Second - 1) / time.Second)
+	if s < 1 {
+		s = 1
+	}
+	return s
+}
+
+func setsockopt(fd, level, opt, value int) error {
+	return err.Syscall("setsockopt", syscall.SetsockoptInt(fd, level, opt, value))
+}
+
+/**
+ * @description:把选项中非零的部分设置到fd上,遇到第一个错误时返回
+ * @param {int} fd
+ * @param {string} network
+ * @param {SockOpts} o
+ * @param {bool} listener 是否为监听套接字,只有监听套接字设置FastOpen/DeferAccept
+ * @return {*}
+ */
+func applySockOpts(fd int, network string, o SockOpts, listener bool) error {
+	if o.RecvBuf > 0 {
+		if errs := setsockopt(fd, syscall.SOL_SOCKET, syscall.SO_RCVBUF, o.RecvBuf); errs != nil {
+			return errs
+		}
+	}
+	if o.SendBuf > 0 {
+		if errs := setsockopt(fd, syscall.SOL_SOCKET, syscall.SO_SNDBUF, o.SendBuf); errs != nil {
+			return errs
+		}
+	}
+	if o.Linger != 0 {
+		if errs := setLinger(fd, o.Linger); errs != nil {
+			return errs
+		}
+	}
+	if network == "unix" {
+		return nil
+	}
+	if o.NoDelay {
+		if errs := setsockopt(fd, syscall.IPPROTO_TCP, syscall.TCP_NODELAY, 1); errs != nil {
+			return errs
+		}
+	}
+	if o.KeepAlive {
+		if errs := setKeepAlive(fd, true, o.KeepIdle, o.KeepInterval, o.KeepCount); errs != nil {
+			return errs
+		}
+	}
+	if o.TOS != 0 {
+		level, opt := tosOption(network)
+		if errs := setsockopt(fd, level, opt, o.TOS); errs != nil {
+			return errs
+		}
+	}
+	if !listener {
+		return nil
+	}
+	if o.FastOpen > 0 {
+		if errs := setsockopt(fd, syscall.IPPROTO_TCP, tcpFastOpen, o.FastOpen); errs != nil {
+			return errs
+		}
+	}
+	if o.DeferAccept > 0 {
+		if errs := setsockopt(fd, syscall.IPPROTO_TCP, syscall.TCP_DEFER_ACCEPT, seconds(o.DeferAccept)); errs != nil {
+			return errs
+		}
+	}
+	return nil
+}
+
+func setKeepAlive(fd int, on bool, idle, interval time.Duration, count int) error {
+	if !on {
+		return setsockopt(fd, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE, 0)
+	}
+	if errs := setsockopt(fd, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE, 1); errs != nil {
+		return errs
+	}
+	if idle > 0 {
+		if errs := setsockopt(fd, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE, seconds(idle)); errs != nil {
+			return errs
+		}
+	}
+	if interval > 0 {
+		if errs := setsockopt(fd, syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, seconds(interval)); errs != nil {
+			return errs
+		}
+	}
+	if count > 0 {
+		return setsockopt(fd, syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT, count)
+	}
+	return nil
+}
+
+func setLinger(fd int, d time.Duration) error {
+	l := &syscall.Linger{}
+	if d > 0 {
+		l.Onoff, l.Linger = 1, int32(seconds(d))
+	} else if d < 0 {
+		l.Onoff = 1
+	}
+	return err.Syscall("setsockopt", syscall.SetsockoptLinger(fd, syscall.SOL_SOCKET, syscall.SO_LINGER, l))
+}
+
+/**
+ * @description:设置Listener的套接字选项,在BindAndListen时设置到监听套接字上,之后accept的连接也会应用这些选项;
+ *  已经处于listen状态时立即设置
+ * @param {SockOpts} o
+ * @return {*}
+ */
+func (l *Listener) SetSockOpts(o SockOpts) error {
+	l.sockOpts = o
+	if !l.listening {
+		return nil
+	}
+	return applySockOpts(l.fd, l.network, o, true)
+}
+
+/**
+ * @description:获取Listener的套接字选项
+ * @param {*}
+ * @return {*}
+ */
+func (l *Listener) SockOpts() SockOpts {
+	return l.sockOpts
+}
+
+/**
+ * @description:在连接上设置选项中非零的部分,覆盖从Listener继承的选项;关闭某个选项使用SetNoDelay等方法
+ * @param {SockOpts} o
+ * @return {*}
+ */
+func (c *Conn) SetSockOpts(o SockOpts) error {
+	if errs := applySockOpts(c.fd, c.network, o, false); errs != nil {
+		return errs
+	}
+	if o.Linger != 0 {
+		c.lingering = o.Linger > 0
+	}
+	return nil
+}
+
+/**
+ * @description:开启或关闭TCP_NODELAY
+ * @param {bool} on
+ * @return {*}
+ */
+func (c *Conn) SetNoDelay(on bool) error {
+	value := 0
+	if on {
+		value = 1
+	}
+	return setsockopt(c.fd, syscall.IPPROTO_TCP, syscall.TCP_NODELAY, value)
+}
+
+/**
+ * @description:开启或关闭TCP保活
+ * @param {bool} on
+ * @param {time.Duration} idle 空闲多久开始探测,0表示不修改
+ * @param {time.Duration} interval 探测间隔,0表示不修改
+ * @param {int} count 探测次数,0表示不修改
+ * @return {*}
+ */
+func (c *Conn) SetKeepAlive(on bool, idle, interval time.Duration, count int) error {
+	return setKeepAlive(c.fd, on, idle, interval, count)
+}
+
+/**
+ * @description:设置SO_LINGER
+ * @param {time.Duration} d >0时close最多等待d发送剩余数据(在后台goroutine中close);<0时close直接发送RST;0恢复默认行为
+ * @return {*}
+ */
+func (c *Conn) SetLinger(d time.Duration) error {
+	if errs := setLinger(c.fd, d); errs != nil {
+		return errs
+	}
+	c.lingering = d > 0
+	return nil
+}
+
+/**
+ * @description:关闭连接的fd;设置了SO_LINGER超时的fd在close时会忽略O_NONBLOCK阻塞到数据发送完或者超时,
+ *  所以放到单独的goroutine中close,fd在close之前不会被复用
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) closeFd() {
+	if !c.lingering {
+		c.Close()
+		return
+	}
+	c.closedCount = 2
+	go syscall.Close(c.fd)
+}
+
+/**
+ * @description:设置IP_TOS,tcp6连接设置IPV6_TCLASS
+ * @param {int} tos
+ * @return {*}
+ */
+func (c *Conn) SetTOS(tos int) error {
+	level, opt := tosOption(c.network)
+	return setsockopt(c.fd, level, opt, tos)
+}
+
+// TOS对应的套接字选项:IPv4为IP_TOS,IPv6为IPV6_TCLASS
+func tosOption(network string) (int, int) {
+	if network == "tcp6" {
+		return syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS
+	}
+	return syscall.IPPROTO_IP, syscall.IP_TOS
+}
@@ -0,0 +1,209 @@
+/*
+ * @Description: 套接字选项测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-26 14:05:16
+ * @LastEditTime: 2021-08-26 15:40:27
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import (
+	"Reactloop/EventLoop"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func getsockopt(t *testing.T, fd, level, opt int) int {
+	v, errs := syscall.GetsockoptInt(fd, level, opt)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	return v
+}
+
+// syscall包中没有GetsockoptLinger
+func getLinger(t *testing.T, fd int) syscall.Linger {
+	var lg syscall.Linger
+	size := uint32(unsafe.Sizeof(lg))
+	_, _, e := syscall.Syscall6(syscall.SYS_GETSOCKOPT, uintptr(fd), syscall.SOL_SOCKET, syscall.SO_LINGER,
+		uintptr(unsafe.Pointer(&lg)), uintptr(unsafe.Pointer(&size)), 0)
+	if e != 0 {
+		t.Fatal(e)
+	}
+	return lg
+}
+
+func TestSockOpts(t *testing.T) {
+	l, errs := NewListener("tcp4", "127.0.0.1:0")
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	opts := SockOpts{
+		NoDelay:      true,
+		KeepAlive:    true,
+		KeepIdle:     30 * time.Second,
+		KeepInterval: 5 * time.Second,
+		KeepCount:    3,
+		RecvBuf:      1 << 16,
+		Linger:       2 * time.Second,
+		DeferAccept:  time.Second,
+		TOS:          0x10,
+	}
+	if errs := l.SetSockOpts(opts); errs != nil {
+		t.Fatal(errs)
+	}
+	if errs := l.BindAndListen(); errs != nil {
+		t.Fatal(errs)
+	}
+	defer l.Close()
+	if getsockopt(t, l.fd, syscall.IPPROTO_TCP, syscall.TCP_DEFER_ACCEPT) == 0 {
+		t.Fatal("TCP_DEFER_ACCEPT not set on listener")
+	}
+
+	el := EventLoop.New()
+	var accepted *Conn
+	el.AddSystemEvent(&EventLoop.Event{Open: func(el *EventLoop.EventLoop, _ *interface{}) {
+		accepted = el.Source().(*Conn)
+	}})
+	l.RegisterAccept(el)
+	sa, _ := syscall.Getsockname(l.fd)
+	client, errs := net.Dial("tcp4", netAddr(sa).String())
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	defer client.Close()
+	// TCP_DEFER_ACCEPT:收到数据后连接才能被accept
+	client.Write([]byte("x"))
+	for i := 0; i < 10 && accepted == nil; i++ {
+		el.TikTok()
+	}
+	if accepted == nil {
+		t.Fatal("connection not accepted")
+	}
+
+	fd := accepted.fd
+	for _, o := range []struct {
+		name       string
+		level, opt int
+		want       int
+	}{
+		{"TCP_NODELAY", syscall.IPPROTO_TCP, syscall.TCP_NODELAY, 1},
+		{"SO_KEEPALIVE", syscall.SOL_SOCKET, syscall.SO_KEEPALIVE, 1},
+		{"TCP_KEEPIDLE", syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE, 30},
+		{"TCP_KEEPINTVL", syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, 5},
+		{"TCP_KEEPCNT", syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT, 3},
+		{"IP_TOS", syscall.IPPROTO_IP, syscall.IP_TOS, 0x10},
+	} {
+		if got := getsockopt(t, fd, o.level, o.opt); got != o.want {
+			t.Fatalf("%s inherited %d want %d", o.name, got, o.want)
+		}
+	}
+	if lg := getLinger(t, fd); lg.Onoff != 1 || lg.Linger != 2 {
+		t.Fatal("SO_LINGER not inherited", lg)
+	}
+
+	// 单个连接覆盖继承的选项
+	if errs := accepted.SetNoDelay(false); errs != nil {
+		t.Fatal(errs)
+	}
+	if errs := accepted.SetKeepAlive(false, 0, 0, 0); errs != nil {
+		t.Fatal(errs)
+	}
+	if errs := accepted.SetLinger(0); errs != nil {
+		t.Fatal(errs)
+	}
+	if errs := accepted.SetSockOpts(SockOpts{SendBuf: 1 << 15, TOS: 0x08}); errs != nil {
+		t.Fatal(errs)
+	}
+	if getsockopt(t, fd, syscall.IPPROTO_TCP, syscall.TCP_NODELAY) != 0 ||
+		getsockopt(t, fd, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE) != 0 ||
+		getsockopt(t, fd, syscall.IPPROTO_IP, syscall.IP_TOS) != 0x08 ||
+		getsockopt(t, fd, syscall.SOL_SOCKET, syscall.SO_SNDBUF) < 1<<15 {
+		t.Fatal("per-connection override not applied")
+	}
+	if lg := getLinger(t, fd); lg.Onoff != 0 {
+		t.Fatal("SO_LINGER not reset", lg)
+	}
+	accepted.release(el, nil)
+}
+
+func TestLingerCloseOffLoop(t *testing.T) {
+	l, errs := NewListener("tcp4", "127.0.0.1:0")
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	l.SetSockOpts(SockOpts{SendBuf: 4096, Linger: 3 * time.Second})
+	if errs := l.BindAndListen(); errs != nil {
+		t.Fatal(errs)
+	}
+	defer l.Close()
+	el := EventLoop.New()
+	var accepted *Conn
+	el.AddSystemEvent(&EventLoop.Event{Open: func(el *EventLoop.EventLoop, _ *interface{}) {
+		accepted = el.Source().(*Conn)
+	}})
+	l.RegisterAccept(el)
+	sa, _ := syscall.Getsockname(l.fd)
+	client, errs := net.Dial("tcp4", netAddr(sa).String())
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	defer client.Close()
+	client.(*net.TCPConn).SetReadBuffer(4096)
+	for i := 0; i < 10 && accepted == nil; i++ {
+		el.TikTok()
+	}
+	if accepted == nil {
+		t.Fatal("connection not accepted")
+	}
+	// 对端不读,内核发送缓冲区中留有未发送的数据
+	accepted.Write(make([]byte, 16<<20))
+	for i := 0; i < 10; i++ {
+		el.TikTok()
+	}
+	start := time.Now()
+	accepted.release(el, nil)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("close with SO_LINGER blocked the loop for %v", elapsed)
+	}
+}
+
+func TestSetTOSTCP6(t *testing.T) {
+	ln, errs := net.Listen("tcp6", "[::1]:0")
+	if errs != nil {
+		t.Skip("IPv6 loopback unavailable:", errs)
+	}
+	defer ln.Close()
+	client, errs := net.Dial("tcp6", ln.Addr().String())
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	defer client.Close()
+	server, errs := ln.Accept()
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	defer server.Close()
+	f, errs := server.(*net.TCPConn).File()
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	fd, _ := syscall.Dup(int(f.Fd()))
+	f.Close()
+	c, errs := AdoptConn(EventLoop.New(), fd)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	defer c.Close()
+	if errs := c.SetTOS(0x20); errs != nil {
+		t.Fatal(errs)
+	}
+	if getsockopt(t, fd, syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS) != 0x20 {
+		t.Fatal("IPV6_TCLASS not set on tcp6 conn")
+	}
+}
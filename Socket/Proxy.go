@@ -0,0 +1,316 @@
+/*
+ * @Description: HAProxy PROXY协议(v1文本格式/v2二进制格式)解析,用于在L4负载均衡之后获取真实的客户端地址
+ *  参考:https://www.haproxy.org/download/2.4/doc/proxy-protocol.txt
+ * @Author: Rocky Hoo
+ * @Date: 2021-07-31 10:12:40
+ * @LastEditTime: 2021-07-31 16:48:22
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import (
+	"Reactloop/EventLoop"
+	err "Reactloop/Utils/Error"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// v2协议头固定的12字节签名
+var proxyV2Sig = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const proxyV1MaxLen = 107 //v1协议头(含\r\n)的最大长度
+
+// PROXY协议v2中常用的TLV类型
+const (
+	PP2_TYPE_ALPN      byte = 0x01
+	PP2_TYPE_AUTHORITY byte = 0x02
+	PP2_TYPE_CRC32C    byte = 0x03
+	PP2_TYPE_NOOP      byte = 0x04
+	PP2_TYPE_UNIQUE_ID byte = 0x05
+	PP2_TYPE_SSL       byte = 0x20
+	PP2_TYPE_NETNS     byte = 0x30
+)
+
+// ProxyTLV v2协议头中附带的一个扩展字段
+type ProxyTLV struct {
+	Type  byte
+	Value []byte
+}
+
+/**
+ * @description:解析得到的PROXY协议头
+ *  Local为true表示负载均衡器自身发起的连接(v2的LOCAL命令或v1的UNKNOWN),此时不替换连接地址
+ * @param {*}
+ * @return {*}
+ */
+type ProxyHeader struct {
+	Version          int    //1或2
+	Local            bool   //是否为LOCAL/UNKNOWN
+	Network          string //tcp4/tcp6/unix,未知时为空
+	SrcAddr, DstAddr string
+	SrcPort, DstPort int
+	TLVs             []ProxyTLV
+}
+
+/**
+ * @description:按类型查找TLV字段
+ * @param {byte} t
+ * @return {*}
+ */
+func (h *ProxyHeader) TLV(t byte) ([]byte, bool) {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == t {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// 连接上PROXY协议头的解析状态
+type proxyState struct {
+	buf    []byte
+	header *ProxyHeader         //解析完成后不为nil
+	timer  *EventLoop.UserEvent //协议头超时定时器
+}
+
+/**
+ * @description:开启PROXY协议解析,之后accept的连接必须先发送PROXY协议头,解析完成后才触发Open,
+ *  Open收到的以及Conn报告的都是协议头中的客户端地址
+ * @param {time.Duration} timeout 等待协议头的超时时间,超时则关闭连接;0表示不限制
+ * @return {*}
+ */
+func (l *Listener) SetProxyProtocol(timeout time.Duration) {
+	l.proxy = true
+	l.proxyTimeout = timeout
+}
+
+/**
+ * @description:连接建立后开始等待PROXY协议头
+ * @param {*EventLoop.EventLoop} el
+ * @param {time.Duration} timeout
+ * @return {*}
+ */
+func (c *Conn) expectProxyHeader(el *EventLoop.EventLoop, timeout time.Duration) {
+	c.proxy = &proxyState{buf: []byte{}}
+	if timeout <= 0 {
+		return
+	}
+	c.proxy.timer = el.AddTimer(timeout, func(el *EventLoop.EventLoop, _ *interface{}) {
+		if c.proxy.header == nil {
+			c.release(el, &err.CONN_TIMEOUT_ERR{Kind: "proxy header"})
+		}
+	})
+}
+
+/**
+ * @description:获取连接的PROXY协议头,未开启或者还没有解析完成时返回nil
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) ProxyHeader() *ProxyHeader {
+	if c.proxy == nil {
+		return nil
+	}
+	return c.proxy.header
+}
+
+/**
+ * @description:协议头解析完成:取消超时定时器,用真实的客户端地址替换负载均衡器的地址
+ * @param {*EventLoop.EventLoop} el
+ * @return {*}
+ */
+func (c *Conn) applyProxyHeader(el *EventLoop.EventLoop) {
+	if c.proxy.timer != nil {
+		el.RemoveUserEvent(c.proxy.timer)
+		c.proxy.timer = nil
+	}
+	h := c.proxy.header
+	if h.Local || h.Network == "" {
+		return
+	}
+	c.network, c.address, c.port = h.Network, h.SrcAddr, h.SrcPort
+}
+
+/**
+ * @description:追加读到的数据并尝试解析协议头
+ * @param {[]byte} data
+ * @return {*} 协议头之后剩余的数据(属于上层协议)
+ */
+func (p *proxyState) feed(data []byte) ([]byte, error) {
+	p.buf = append(p.buf, data...)
+	header, n, errs := parseProxyHeader(p.buf)
+	if errs != nil || header == nil {
+		return nil, errs
+	}
+	p.header = header
+	rest := p.buf[n:]
+	p.buf = nil
+	return rest, nil
+}
+
+func proxyError(msg string) error {
+	return &err.PROXY_PROTOCOL_ERR{Msg: msg}
+}
+
+/**
+ * @description:解析PROXY协议头,数据不完整时返回nil且不报错
+ * @param {[]byte} buf
+ * @return {*} 协议头,协议头占用的字节数
+ */
+func parseProxyHeader(buf []byte) (*ProxyHeader, int, error) {
+	sigLen := len(buf)
+	if sigLen > len(proxyV2Sig) {
+		sigLen = len(proxyV2Sig)
+	}
+	if bytes.Equal(buf[:sigLen], proxyV2Sig[:sigLen]) {
+		return parseProxyV2(buf)
+	}
+	v1Prefix := []byte("PROXY ")
+	prefixLen := len(buf)
+	if prefixLen > len(v1Prefix) {
+		prefixLen = len(v1Prefix)
+	}
+	if bytes.Equal(buf[:prefixLen], v1Prefix[:prefixLen]) {
+		return parseProxyV1(buf)
+	}
+	return nil, 0, proxyError("missing signature")
+}
+
+/**
+ * @description:v1格式:"PROXY TCP4 源地址 目的地址 源端口 目的端口\r\n"或者"PROXY UNKNOWN ...\r\n"
+ * @param {[]byte} buf
+ * @return {*}
+ */
+func parseProxyV1(buf []byte) (*ProxyHeader, int, error) {
+	end := bytes.Index(buf, []byte("\r\n"))
+	if end < 0 {
+		if len(buf) >= proxyV1MaxLen {
+			return nil, 0, proxyError("v1 header too long")
+		}
+		return nil, 0, nil
+	}
+	if end+2 > proxyV1MaxLen {
+		return nil, 0, proxyError("v1 header too long")
+	}
+	fields := strings.Split(string(buf[:end]), " ")
+	h := &ProxyHeader{Version: 1}
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		h.Local = true
+		return h, end + 2, nil
+	}
+	if len(fields) != 6 {
+		return nil, 0, proxyError("v1 wrong number of fields")
+	}
+	switch fields[1] {
+	case "TCP4":
+		h.Network = "tcp4"
+	case "TCP6":
+		h.Network = "tcp6"
+	default:
+		return nil, 0, proxyError("v1 unknown protocol " + fields[1])
+	}
+	for i, addr := range fields[2:4] {
+		ip := net.ParseIP(addr)
+		if ip == nil || (h.Network == "tcp4") != (ip.To4() != nil) {
+			return nil, 0, proxyError("v1 invalid address " + addr)
+		}
+		if i == 0 {
+			h.SrcAddr = ip.String()
+		} else {
+			h.DstAddr = ip.String()
+		}
+	}
+	ports := [2]int{}
+	for i, portStr := range fields[4:6] {
+		port, errs := strconv.Atoi(portStr)
+		if errs != nil || port < 0 || port > 65535 {
+			return nil, 0, proxyError("v1 invalid port " + portStr)
+		}
+		ports[i] = port
+	}
+	h.SrcPort, h.DstPort = ports[0], ports[1]
+	return h, end + 2, nil
+}
+
+/**
+ * @description:v2格式:12字节签名 + 版本/命令 + 地址族/协议 + 2字节长度 + 地址 + TLV
+ * @param {[]byte} buf
+ * @return {*}
+ */
+func parseProxyV2(buf []byte) (*ProxyHeader, int, error) {
+	if len(buf) < 16 {
+		return nil, 0, nil
+	}
+	if buf[12]>>4 != 2 {
+		return nil, 0, proxyError("v2 unsupported version")
+	}
+	length := int(binary.BigEndian.Uint16(buf[14:16]))
+	if len(buf) < 16+length {
+		return nil, 0, nil
+	}
+	h := &ProxyHeader{Version: 2}
+	switch buf[12] & 0x0F {
+	case 0x0:
+		h.Local = true
+	case 0x1:
+	default:
+		return nil, 0, proxyError("v2 unknown command")
+	}
+	payload := buf[16 : 16+length]
+	var addrLen int
+	switch buf[13] >> 4 {
+	case 0x1: //AF_INET
+		addrLen = 12
+		if len(payload) < addrLen {
+			return nil, 0, proxyError("v2 address too short")
+		}
+		h.Network = "tcp4"
+		h.SrcAddr = net.IP(payload[0:4]).String()
+		h.DstAddr = net.IP(payload[4:8]).String()
+		h.SrcPort = int(binary.BigEndian.Uint16(payload[8:10]))
+		h.DstPort = int(binary.BigEndian.Uint16(payload[10:12]))
+	case 0x2: //AF_INET6
+		addrLen = 36
+		if len(payload) < addrLen {
+			return nil, 0, proxyError("v2 address too short")
+		}
+		h.Network = "tcp6"
+		h.SrcAddr = net.IP(payload[0:16]).String()
+		h.DstAddr = net.IP(payload[16:32]).String()
+		h.SrcPort = int(binary.BigEndian.Uint16(payload[32:34]))
+		h.DstPort = int(binary.BigEndian.Uint16(payload[34:36]))
+	case 0x3: //AF_UNIX
+		addrLen = 216
+		if len(payload) < addrLen {
+			return nil, 0, proxyError("v2 address too short")
+		}
+		h.Network = "unix"
+		h.SrcAddr = string(bytes.TrimRight(payload[0:108], "\x00"))
+		h.DstAddr = string(bytes.TrimRight(payload[108:216], "\x00"))
+	default: //AF_UNSPEC
+		h.Local = true
+	}
+	// UDP等非流式协议不替换地址
+	if buf[13]&0x0F != 0x1 {
+		h.Network = ""
+	}
+	tlvs := payload[addrLen:]
+	for len(tlvs) > 0 {
+		if len(tlvs) < 3 {
+			return nil, 0, proxyError("v2 truncated TLV")
+		}
+		n := int(binary.BigEndian.Uint16(tlvs[1:3]))
+		if len(tlvs) < 3+n {
+			return nil, 0, proxyError("v2 truncated TLV")
+		}
+		h.TLVs = append(h.TLVs, ProxyTLV{Type: tlvs[0], Value: append([]byte{}, tlvs[3:3+n]...)})
+		tlvs = tlvs[3+n:]
+	}
+	return h, 16 + length, nil
+}
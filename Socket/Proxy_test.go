@@ -0,0 +1,122 @@
+/*
+ * @Description: PROXY协议头解析测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-07-31 15:20:02
+ * @LastEditTime: 2021-07-31 16:40:18
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import (
+	"Reactloop/EventLoop"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestProxyV1(t *testing.T) {
+	p := &proxyState{}
+	rest, err := p.feed([]byte("PROXY TCP4 192.168.0.1 10.0.0.1 56324 443\r"))
+	if err != nil || p.header != nil {
+		t.Fatal("header should be incomplete", err)
+	}
+	rest, err = p.feed([]byte("\nGET /"))
+	if err != nil || p.header == nil {
+		t.Fatal(err)
+	}
+	h := p.header
+	if h.Version != 1 || h.Network != "tcp4" || h.SrcAddr != "192.168.0.1" || h.SrcPort != 56324 || h.DstPort != 443 {
+		t.Fatalf("unexpected header %+v", h)
+	}
+	if string(rest) != "GET /" {
+		t.Fatalf("rest %q", rest)
+	}
+	if _, err := (&proxyState{}).feed([]byte("GET / HTTP/1.1\r\n")); err == nil {
+		t.Fatal("expected error without signature")
+	}
+}
+
+func TestProxyV2(t *testing.T) {
+	buf := append([]byte{}, proxyV2Sig...)
+	buf = append(buf, 0x21, 0x21) //v2 PROXY, AF_INET6 STREAM
+	payload := make([]byte, 36)
+	payload[15] = 1 //::1
+	payload[31] = 2 //::2
+	binary.BigEndian.PutUint16(payload[32:], 40000)
+	binary.BigEndian.PutUint16(payload[34:], 8443)
+	payload = append(payload, PP2_TYPE_AUTHORITY, 0, 11)
+	payload = append(payload, "example.com"...)
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(payload)))
+	buf = append(buf, length...)
+	buf = append(buf, payload...)
+	buf = append(buf, "hello"...)
+
+	h, n, err := parseProxyHeader(buf[:20])
+	if h != nil || err != nil {
+		t.Fatal("header should be incomplete", err)
+	}
+	h, n, err = parseProxyHeader(buf)
+	if err != nil || h == nil {
+		t.Fatal(err)
+	}
+	if h.Network != "tcp6" || h.SrcAddr != "::1" || h.SrcPort != 40000 || h.DstAddr != "::2" {
+		t.Fatalf("unexpected header %+v", h)
+	}
+	if authority, ok := h.TLV(PP2_TYPE_AUTHORITY); !ok || string(authority) != "example.com" {
+		t.Fatalf("authority %q", authority)
+	}
+	if string(buf[n:]) != "hello" {
+		t.Fatalf("rest %q", buf[n:])
+	}
+}
+
+func TestProxyOpenClosesConn(t *testing.T) {
+	for _, mode := range []string{"close", "panic"} {
+		l, errs := NewListener("tcp4", "127.0.0.1:0")
+		if errs != nil {
+			t.Fatal(errs)
+		}
+		l.SetProxyProtocol(time.Second)
+		if errs := l.BindAndListen(); errs != nil {
+			t.Fatal(errs)
+		}
+		el := EventLoop.New()
+		trace := []string{}
+		rejected := errors.New("rejected in Open")
+		el.AddSystemEvent(&EventLoop.Event{
+			Open: func(el *EventLoop.EventLoop, _ *interface{}) {
+				trace = append(trace, "open")
+				if mode == "panic" {
+					panic("open failed")
+				}
+				el.Source().(*Conn).CloseWithError(rejected)
+			},
+			Data:  func(el *EventLoop.EventLoop, _ *interface{}) { trace = append(trace, "data") },
+			Close: func(el *EventLoop.EventLoop, _ *interface{}) { trace = append(trace, "close") },
+		})
+		l.RegisterAccept(el)
+		sa, _ := syscall.Getsockname(l.fd)
+		client, errs := net.Dial("tcp4", netAddr(sa).String())
+		if errs != nil {
+			t.Fatal(errs)
+		}
+		// PROXY协议头与数据一起到达,Open在解析完协议头后补发
+		client.Write([]byte("PROXY TCP4 1.2.3.4 5.6.7.8 1000 2000\r\nhello"))
+		for i := 0; i < 20 && len(trace) < 2; i++ {
+			el.TikTok()
+		}
+		el.TikTok()
+		if got := strings.Join(trace, " "); got != "open close" {
+			t.Fatalf("%s: trace %q, Data must not run after Open closed the conn", mode, got)
+		}
+		client.Close()
+		l.Close()
+	}
+}
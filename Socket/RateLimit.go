@@ -0,0 +1,307 @@
+/*
+ * @Description: 基于令牌桶的限速(每秒字节数/每秒消息数),可以挂在单个连接上,也可以按对端ip共享;
+ *  令牌不足时暂停监听读事件,由事件循环的定时器在令牌恢复后重新开启,而不是无限制地缓存输入
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-07 15:02:44
+ * @LastEditTime: 2021-08-07 22:38:19
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import (
+	"Reactloop/EventLoop"
+	"time"
+)
+
+/**
+ * @description:令牌桶,允许透支:一次读到的数据可能超过剩余令牌,透支部分需要等待补齐后才能继续读
+ * @param {*}
+ * @return {*}
+ */
+type TokenBucket struct {
+	rate   float64 //每秒补充的令牌数
+	burst  float64 //桶的容量
+	tokens float64
+	last   time.Time
+}
+
+/**
+ * @description: TokenBucket构造函数,初始时桶是满的
+ * @param {float64} rate 每秒补充的令牌数
+ * @param {float64} burst 桶的容量,小于rate时取rate
+ * @return {*}
+ */
+func NewTokenBucket(rate, burst float64) *TokenBucket {
+	if burst < rate {
+		burst = rate
+	}
+	return &TokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+func (b *TokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+/**
+ * @description:消耗n个令牌
+ * @param {float64} n
+ * @param {time.Time} now
+ * @return {*} 需要等待多久才能把透支的令牌补齐,不需要等待时为0
+ */
+func (b *TokenBucket) Take(n float64, now time.Time) time.Duration {
+	b.refill(now)
+	b.tokens -= n
+	return b.Delay(now)
+}
+
+/**
+ * @description:令牌补齐(不再透支)还需要等待的时间
+ * @param {time.Time} now
+ * @return {*}
+ */
+func (b *TokenBucket) Delay(now time.Time) time.Duration {
+	b.refill(now)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+/**
+ * @description:限速设置,速率为0表示不限制;Burst为0时等于对应的速率
+ * @param {*}
+ * @return {*}
+ */
+type RateLimit struct {
+	BytesPerSec, BytesBurst float64
+	MsgsPerSec, MsgsBurst   float64 //一次Data事件算作一条消息
+}
+
+// 一组令牌桶
+type rateBuckets struct {
+	bytes, msgs *TokenBucket
+	refs        int //按ip共享时引用该组令牌桶的连接数
+}
+
+func newRateBuckets(limit RateLimit) *rateBuckets {
+	b := &rateBuckets{}
+	if limit.BytesPerSec > 0 {
+		b.bytes = NewTokenBucket(limit.BytesPerSec, limit.BytesBurst)
+	}
+	if limit.MsgsPerSec > 0 {
+		b.msgs = NewTokenBucket(limit.MsgsPerSec, limit.MsgsBurst)
+	}
+	return b
+}
+
+/**
+ * @description:消耗令牌并返回需要暂停读的时间
+ * @param {int} n 读到的字节数
+ * @param {bool} msg 是否产生了一条消息
+ * @param {time.Time} now
+ * @return {*}
+ */
+func (b *rateBuckets) take(n int, msg bool, now time.Time) time.Duration {
+	var delay time.Duration
+	if b.bytes != nil {
+		delay = b.bytes.Take(float64(n), now)
+	}
+	if b.msgs != nil && msg {
+		if d := b.msgs.Take(1, now); d > delay {
+			delay = d
+		}
+	}
+	return delay
+}
+
+/**
+ * @description:令牌桶是否已经补满(没有连接引用的令牌桶补满后才能丢弃,否则断开重连就能拿到一个满的令牌桶)
+ * @param {time.Time} now
+ * @return {*}
+ */
+func (b *rateBuckets) full(now time.Time) bool {
+	for _, tb := range []*TokenBucket{b.bytes, b.msgs} {
+		if tb == nil {
+			continue
+		}
+		tb.refill(now)
+		if tb.tokens < tb.burst {
+			return false
+		}
+	}
+	return true
+}
+
+// 令牌桶数量达到该值时才开始清理
+const minRateSweep = 64
+
+// 连接上的限速状态
+type connRate struct {
+	own     *rateBuckets   //连接自己的令牌桶
+	shared  *rateBuckets   //按ip共享的令牌桶
+	limiter *IPRateLimiter //shared所属的IPRateLimiter
+	timer   *EventLoop.UserEvent
+}
+
+// IPRateLimiter 同一个ip的所有连接共享一组令牌桶
+type IPRateLimiter struct {
+	limit   RateLimit
+	buckets map[string]*rateBuckets
+	sweepAt int //令牌桶数量达到该值时清理已经补满且没有连接引用的令牌桶
+}
+
+/**
+ * @description: IPRateLimiter构造函数,可以被多个Listener共用(需要在同一个事件循环中)
+ * @param {RateLimit} limit
+ * @return {*}
+ */
+func NewIPRateLimiter(limit RateLimit) *IPRateLimiter {
+	return &IPRateLimiter{limit: limit, buckets: map[string]*rateBuckets{}, sweepAt: minRateSweep}
+}
+
+func (r *IPRateLimiter) acquire(ip string) *rateBuckets {
+	b, ok := r.buckets[ip]
+	if !ok {
+		if len(r.buckets) >= r.sweepAt {
+			r.sweep(time.Now())
+		}
+		b = newRateBuckets(r.limit)
+		r.buckets[ip] = b
+	}
+	b.refs++
+	return b
+}
+
+/**
+ * @description:最后一个连接关闭时,令牌桶已经补满才丢弃,否则保留到补满后由sweep清理
+ * @param {string} ip
+ * @return {*}
+ */
+func (r *IPRateLimiter) release(ip string) {
+	if b, ok := r.buckets[ip]; ok {
+		b.refs--
+		if b.refs <= 0 && b.full(time.Now()) {
+			delete(r.buckets, ip)
+		}
+	}
+}
+
+/**
+ * @description:清理已经补满且没有连接引用的令牌桶;下一次清理的阈值为剩余数量的两倍,清理的开销均摊到每次acquire
+ * @param {time.Time} now
+ * @return {*}
+ */
+func (r *IPRateLimiter) sweep(now time.Time) {
+	for ip, b := range r.buckets {
+		if b.refs <= 0 && b.full(now) {
+			delete(r.buckets, ip)
+		}
+	}
+	r.sweepAt = 2 * len(r.buckets)
+	if r.sweepAt < minRateSweep {
+		r.sweepAt = minRateSweep
+	}
+}
+
+/**
+ * @description:为Listener之后accept的连接按对端ip限速
+ * @param {*IPRateLimiter} r nil表示不限制
+ * @return {*}
+ */
+func (l *Listener) SetIPRateLimiter(r *IPRateLimiter) {
+	l.ipRate = r
+}
+
+/**
+ * @description:为单个连接设置限速,与按ip的限速同时生效
+ * @param {RateLimit} limit 零值表示取消
+ * @return {*}
+ */
+func (c *Conn) SetRateLimit(limit RateLimit) {
+	if limit == (RateLimit{}) {
+		c.rate.own = nil
+		return
+	}
+	c.rate.own = newRateBuckets(limit)
+}
+
+/**
+ * @description:读到数据后消耗令牌,令牌透支时暂停读,等待补齐后由定时器恢复
+ * @param {int} n 读到的字节数
+ * @param {bool} msg 是否触发了Data事件
+ * @return {*}
+ */
+func (c *Conn) consumeRate(n int, msg bool) {
+	if (c.rate.own == nil && c.rate.shared == nil) || c.closedCount >= 2 {
+		return
+	}
+	now := time.Now()
+	var delay time.Duration
+	for _, b := range []*rateBuckets{c.rate.own, c.rate.shared} {
+		if b == nil {
+			continue
+		}
+		if d := b.take(n, msg, now); d > delay {
+			delay = d
+		}
+	}
+	if delay > 0 {
+		c.pauseRead(pauseRate)
+		c.scheduleRateResume(delay)
+	}
+}
+
+func (c *Conn) scheduleRateResume(delay time.Duration) {
+	if c.rate.timer != nil || c.loop == nil {
+		return
+	}
+	c.rate.timer = c.loop.AddTimer(delay, func(el *EventLoop.EventLoop, _ *interface{}) {
+		c.rate.timer = nil
+		if c.closedCount >= 2 {
+			return
+		}
+		// 按ip共享的令牌可能又被同ip的其他连接消耗,需要重新检查
+		now := time.Now()
+		var wait time.Duration
+		for _, b := range []*rateBuckets{c.rate.own, c.rate.shared} {
+			if b == nil {
+				continue
+			}
+			for _, tb := range []*TokenBucket{b.bytes, b.msgs} {
+				if tb == nil {
+					continue
+				}
+				if d := tb.Delay(now); d > wait {
+					wait = d
+				}
+			}
+		}
+		if wait > 0 {
+			c.scheduleRateResume(wait)
+			return
+		}
+		c.resumeRead(pauseRate)
+	})
+}
+
+/**
+ * @description:连接关闭时取消恢复读的定时器,并归还按ip共享的令牌桶
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) releaseRate() {
+	if c.rate.timer != nil {
+		c.loop.RemoveUserEvent(c.rate.timer)
+		c.rate.timer = nil
+	}
+	if c.rate.limiter != nil {
+		c.rate.limiter.release(c.peerIP)
+		c.rate.limiter, c.rate.shared = nil, nil
+	}
+}
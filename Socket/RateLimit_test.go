@@ -0,0 +1,68 @@
+/*
+ * @Description: 令牌桶限速测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-07 21:50:17
+ * @LastEditTime: 2021-08-07 22:30:41
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := NewTokenBucket(100, 200)
+	b.last = now
+	if d := b.Take(150, now); d != 0 {
+		t.Fatalf("within burst, delay %v", d)
+	}
+	// 透支100个令牌,需要等待1s
+	if d := b.Take(150, now); d != time.Second {
+		t.Fatalf("overdraft delay %v", d)
+	}
+	if d := b.Delay(now.Add(500 * time.Millisecond)); d != 500*time.Millisecond {
+		t.Fatalf("half refilled, delay %v", d)
+	}
+	if d := b.Delay(now.Add(10 * time.Second)); d != 0 || b.tokens != 200 {
+		t.Fatalf("refill should be capped at burst, delay %v tokens %v", d, b.tokens)
+	}
+}
+
+func TestIPRateLimiterShared(t *testing.T) {
+	r := NewIPRateLimiter(RateLimit{MsgsPerSec: 1})
+	a, b := r.acquire("10.0.0.1"), r.acquire("10.0.0.1")
+	if a != b {
+		t.Fatal("connections from one ip should share buckets")
+	}
+	now := time.Now()
+	if a.take(10, true, now) != 0 || b.take(10, true, now) == 0 {
+		t.Fatal("second message should exceed the shared bucket")
+	}
+	r.release("10.0.0.1")
+	r.release("10.0.0.1")
+	// 令牌没有补满时保留令牌桶,断开重连不能拿到满的令牌桶
+	if c := r.acquire("10.0.0.1"); c != a || c.take(10, true, time.Now()) == 0 {
+		t.Fatal("reconnecting should not reset an overdrawn bucket")
+	}
+	r.release("10.0.0.1")
+	r.sweep(now.Add(time.Second))
+	if len(r.buckets) != 1 {
+		t.Fatal("bucket dropped before it refilled")
+	}
+	r.sweep(now.Add(10 * time.Second))
+	if len(r.buckets) != 0 {
+		t.Fatal("refilled idle bucket should be swept")
+	}
+	// 没有透支的令牌桶在最后一个连接关闭时直接丢弃
+	r = NewIPRateLimiter(RateLimit{MsgsPerSec: 1, MsgsBurst: 5})
+	r.acquire("10.0.0.2")
+	r.release("10.0.0.2")
+	if len(r.buckets) != 0 {
+		t.Fatal("full bucket should be dropped with the last connection")
+	}
+}
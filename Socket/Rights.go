@@ -0,0 +1,154 @@
+/*
+ * @Description: 通过Unix域套接字的辅助数据(SCM_RIGHTS)传递文件描述符
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-10 19:33:08
+ * @LastEditTime: 2021-08-10 22:15:46
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import (
+	err "Reactloop/Utils/Error"
+	"syscall"
+	"unsafe"
+)
+
+const maxPassedFds = 253 //内核SCM_MAX_FD的限制
+
+// 一次接收的辅助数据最大长度:最多maxPassedFds个fd加上一份凭证
+var oobSize = syscall.CmsgSpace(maxPassedFds*4) + syscall.CmsgSpace(syscall.SizeofUcred)
+
+/**
+ * @description:在Unix域套接字上发送数据并附带文件描述符,对端收到的是指向同一个打开文件的新fd
+ * @param {int} sock Unix域套接字
+ * @param {[]byte} data 至少需要1个字节,辅助数据不能单独发送
+ * @param {...int} fds
+ * @return {*}
+ */
+func SendFds(sock int, data []byte, fds ...int) error {
+	if len(data) == 0 {
+		data = []byte{0}
+	}
+	return syscall.Sendmsg(sock, data, syscall.UnixRights(fds...), nil, 0)
+}
+
+/**
+ * @description:从Unix域套接字上接收数据以及附带的文件描述符,收到的fd都设置了CLOEXEC
+ * @param {int} sock
+ * @param {int} bufSize 普通数据的缓冲区大小
+ * @return {*}
+ */
+func RecvFds(sock int, bufSize int) ([]byte, []int, error) {
+	buf := make([]byte, bufSize)
+	oob := make([]byte, oobSize)
+	n, oobn, flags, _, errs := syscall.Recvmsg(sock, buf, oob, syscall.MSG_CMSG_CLOEXEC)
+	if errs != nil {
+		return nil, nil, errs
+	}
+	fds, _, errs := readControl(oob[:oobn], flags)
+	if errs != nil {
+		return nil, nil, errs
+	}
+	return buf[:n], fds, nil
+}
+
+/**
+ * @description:处理recvmsg收到的辅助数据,辅助数据被截断(MSG_CTRUNC)时丢失了一部分fd或凭证,
+ *  关闭已经收到的fd并返回错误
+ * @param {[]byte} oob
+ * @param {int} flags recvmsg返回的标志
+ * @return {*}
+ */
+func readControl(oob []byte, flags int) ([]int, *syscall.Ucred, error) {
+	fds, cred, errs := parseControl(oob)
+	if errs != nil {
+		return nil, nil, errs
+	}
+	if flags&syscall.MSG_CTRUNC != 0 {
+		closeFds(fds)
+		return nil, nil, &err.CONTROL_MSG_ERR{Msg: "truncated (MSG_CTRUNC)"}
+	}
+	return fds, cred, nil
+}
+
+/**
+ * @description:解析辅助数据中的文件描述符(SCM_RIGHTS)与进程凭证(SCM_CREDENTIALS),
+ *  任何一条消息解析失败时关闭其中所有的fd,不论它们出现在出错的消息之前还是之后
+ * @param {[]byte} oob
+ * @return {*} 没有凭证时cred为nil
+ */
+func parseControl(oob []byte) ([]int, *syscall.Ucred, error) {
+	msgs, errs := syscall.ParseSocketControlMessage(oob)
+	if errs != nil {
+		closeFds(scanRights(oob))
+		return nil, nil, &err.CONTROL_MSG_ERR{Msg: "malformed", Err: errs}
+	}
+	var (
+		fds    []int
+		cred   *syscall.Ucred
+		failed error
+	)
+	for i := range msgs {
+		msg := &msgs[i]
+		if msg.Header.Level != syscall.SOL_SOCKET {
+			continue
+		}
+		switch msg.Header.Type {
+		case syscall.SCM_RIGHTS:
+			rights, errs := syscall.ParseUnixRights(msg)
+			if errs != nil && failed == nil {
+				failed = errs
+			}
+			fds = append(fds, rights...)
+		case syscall.SCM_CREDENTIALS:
+			c, errs := syscall.ParseUnixCredentials(msg)
+			if errs != nil && failed == nil {
+				failed = errs
+			}
+			if c != nil {
+				cred = c
+			}
+		}
+	}
+	if failed != nil {
+		closeFds(fds)
+		return nil, nil, &err.CONTROL_MSG_ERR{Msg: "malformed", Err: failed}
+	}
+	return fds, cred, nil
+}
+
+/**
+ * @description:辅助数据无法完整解析时,按消息头逐条找出格式正确的SCM_RIGHTS中的fd
+ * @param {[]byte} oob
+ * @return {*}
+ */
+func scanRights(oob []byte) []int {
+	var fds []int
+	hdrLen := syscall.CmsgLen(0)
+	for len(oob) >= hdrLen {
+		h := (*syscall.Cmsghdr)(unsafe.Pointer(&oob[0]))
+		size := int(h.Len)
+		if size < hdrLen || size > len(oob) {
+			break
+		}
+		if h.Level == syscall.SOL_SOCKET && h.Type == syscall.SCM_RIGHTS {
+			for i := hdrLen; i+4 <= size; i += 4 {
+				fds = append(fds, int(*(*int32)(unsafe.Pointer(&oob[i]))))
+			}
+		}
+		next := syscall.CmsgSpace(size - hdrLen)
+		if next > len(oob) {
+			break
+		}
+		oob = oob[next:]
+	}
+	return fds
+}
+
+func closeFds(fds []int) {
+	for _, fd := range fds {
+		syscall.Close(fd)
+	}
+}
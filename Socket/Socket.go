@@ -13,9 +13,12 @@ import (
 	"Reactloop/EventLoop"
 	enum "Reactloop/Utils/Enum"
 	err "Reactloop/Utils/Error"
+	logger "Reactloop/Utils/Log"
 	"net"
 	"strconv"
+	"strings"
 	"syscall"
+	"time"
 )
 
 /**
@@ -56,6 +59,44 @@ func parseIpv4Addr(addr string) (net.IP, int, error) {
 	return ip, port, nil
 }
 
+/**
+ * @description:解析格式形如([host]:port)的IPv6地址,host可以带"%网卡名"或者"%网卡序号"形式的zone(链路本地地址需要)
+ * @param {string} addr
+ * @return {*}
+ */
+func parseIpv6Addr(addr string) (net.IP, int, uint32, error) {
+	ipStr, portStr, errs := net.SplitHostPort(addr)
+	if errs != nil {
+		return nil, -1, 0, errs
+	}
+	zone := ""
+	if i := strings.LastIndexByte(ipStr, '%'); i >= 0 {
+		ipStr, zone = ipStr[:i], ipStr[i+1:]
+	}
+	// 不带冒号的是IPv4地址,IPv4-mapped地址(::ffff:a.b.c.d)可以使用
+	ip := net.ParseIP(ipStr)
+	if ip == nil || !strings.Contains(ipStr, ":") {
+		return nil, -1, 0, &err.IP_FORMAT_ERR{
+			IP: ipStr,
+		}
+	}
+	var zoneId uint32
+	if zone != "" {
+		if n, errs := strconv.Atoi(zone); errs == nil {
+			zoneId = uint32(n)
+		} else if ifi, errs := net.InterfaceByName(zone); errs == nil {
+			zoneId = uint32(ifi.Index)
+		} else {
+			return nil, -1, 0, errs
+		}
+	}
+	port, errs := strconv.Atoi(portStr)
+	if errs != nil {
+		return nil, -1, 0, errs
+	}
+	return ip, port, zoneId, nil
+}
+
 /**
  * @description:根据sockaddr反向解析出socket的ip和地址
  * @param {syscall.Sockaddr} sa
@@ -65,6 +106,10 @@ func resolveSockaddrInfo(sa syscall.Sockaddr) (string, string, int, error) {
 	switch v := sa.(type) {
 	case *syscall.SockaddrInet4:
 		return "tcp4", net.IP(v.Addr[:]).String(), v.Port, nil
+	case *syscall.SockaddrInet6:
+		return "tcp6", net.IP(v.Addr[:]).String(), v.Port, nil
+	case *syscall.SockaddrUnix:
+		return "unix", v.Name, 0, nil
 	}
 	return "", "", -1, &err.UNKNOW_NETWORK_ERR{
 		Network: "unknown",
@@ -88,6 +133,16 @@ func getSockAddr(network, addr string) (syscall.Sockaddr, error) {
 		sa := &syscall.SockaddrInet4{Port: port}
 		copy(sa.Addr[:], ip[:4])
 		return sa, nil
+	case "tcp6":
+		ip, port, zoneId, errs := parseIpv6Addr(addr)
+		if errs != nil {
+			return nil, errs
+		}
+		sa := &syscall.SockaddrInet6{Port: port, ZoneId: zoneId}
+		copy(sa.Addr[:], ip.To16())
+		return sa, nil
+	case "unix":
+		return &syscall.SockaddrUnix{Name: addr}, nil
 	}
 	return nil, &err.UNKNOW_NETWORK_ERR{
 		Network: network,
@@ -99,31 +154,51 @@ func getSockAddr(network, addr string) (syscall.Sockaddr, error) {
  * @param  {*}
  * @return {*}
  * @param {*} network
- * @param {string} addr(format:ip:port)
+ * @param {string} addr(format:ip:port,tcp6时为[ip]:port,unix时为套接字文件路径)
  * @param {int} port
  */
 func NewSocket(network, addr string) (*Socket, error) {
-	// AF_INET Socket地址族;proto设置为0，选择系统默认协议族
-	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM|syscall.SOCK_NONBLOCK, 0)
+	sa, err := getSockAddr(network, addr)
 	if err != nil {
 		return nil, err
 	}
-	if err := syscall.SetNonblock(fd, true); err != nil {
-		return nil, err
+	port := 0
+	family := syscall.AF_UNIX
+	if network != "unix" {
+		// AF_INET/AF_INET6 Socket地址族;proto设置为0，选择系统默认协议族
+		family = syscall.AF_INET
+		if network == "tcp6" {
+			family = syscall.AF_INET6
+		}
+		var portStr string
+		addr, portStr, err = net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		port, err = strconv.Atoi(portStr)
+		if err != nil {
+			return nil, err
+		}
 	}
-	sa, err := getSockAddr(network, addr)
-	if err != nil {
-		return nil, err
+	if sa6, ok := sa.(*syscall.SockaddrInet6); ok {
+		// 与resolveSockaddrInfo得到的地址保持一致(去掉zone),继承监听fd时按地址匹配
+		addr = net.IP(sa6.Addr[:]).String()
 	}
-	var portStr string
-	addr, portStr, err = net.SplitHostPort(addr)
+	fd, err := syscall.Socket(family, syscall.SOCK_STREAM|syscall.SOCK_NONBLOCK, 0)
 	if err != nil {
 		return nil, err
 	}
-	port, err := strconv.Atoi(portStr)
-	if err != nil {
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
 		return nil, err
 	}
+	if family == syscall.AF_INET6 {
+		// tcp6只接受IPv6连接,同一端口上的IPv4由tcp4的Listener负责
+		if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_V6ONLY, 1); err != nil {
+			syscall.Close(fd)
+			return nil, err
+		}
+	}
 	return &Socket{
 		network:     network,
 		address:     addr,
@@ -162,6 +237,19 @@ func (s *Socket) Shutdown(how int) error {
 // Listener是Socket的一个装饰器m主要负责连接创立过程的响应处理(监听套接字)
 type Listener struct {
 	*Socket
+	codec        CodecFactory         //为accept得到的连接创建Codec,为nil时直接读写原始字节
+	proxy        bool                 //是否要求连接以PROXY协议头开始
+	proxyTimeout time.Duration        //等待PROXY协议头的超时时间,0表示不限制
+	timeouts     Timeouts             //accept得到的连接默认使用的超时设置
+	limiter      acceptLimiter        //连接数限制与accept限流
+	acl          *ACL                 //ip访问控制列表,nil表示不限制
+	ipRate       *IPRateLimiter       //按对端ip限速,nil表示不限制
+	maxPending   int                  //accept得到的连接默认的未消费输入上限
+	listening    bool                 //是否已经处于listen状态(继承得到的fd)
+	events       []*EventLoop.Event   //该Listener上的连接使用的回调集合,为nil时使用事件循环的系统事件
+	metrics      *listenerMetrics     //指标,没有开启时为nil
+	loop         *EventLoop.EventLoop //注册accept的事件循环,没有注册时为nil
+	sockOpts     SockOpts             //监听套接字与accept得到的连接的套接字选项
 }
 
 /**
@@ -176,7 +264,44 @@ func NewListener(network, addr string) (*Listener, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Listener{sock}, nil
+	return &Listener{Socket: sock, limiter: newAcceptLimiter()}, nil
+}
+
+/**
+ * @description:为该Listener上的连接添加回调,添加过回调的Listener上的连接只触发自己的回调,不再触发事件循环的系统事件;
+ *  其中的Serving只有通过ReactLoop.Server使用时才会被调用
+ * @param {*EventLoop.Event} event
+ * @return {*}
+ */
+func (l *Listener) AddEvent(event *EventLoop.Event) {
+	l.events = append(l.events, event)
+}
+
+/**
+ * @description:替换该Listener上的连接使用的回调集合,nil表示使用事件循环的系统事件
+ * @param {[]*EventLoop.Event} events
+ * @return {*}
+ */
+func (l *Listener) SetEvents(events []*EventLoop.Event) {
+	l.events = events
+}
+
+/**
+ * @description:该Listener上的连接使用的回调集合
+ * @param {*}
+ * @return {*}
+ */
+func (l *Listener) Events() []*EventLoop.Event {
+	return l.events
+}
+
+/**
+ * @description: 为该监听套接字之后accept的所有连接设置Codec(如TLS)
+ * @param {CodecFactory} factory
+ * @return {*}
+ */
+func (l *Listener) SetCodec(factory CodecFactory) {
+	l.codec = factory
 }
 
 /**
@@ -185,17 +310,27 @@ func NewListener(network, addr string) (*Listener, error) {
  * @return {*}
  */
 func (l *Listener) BindAndListen() error {
+	if l.listening {
+		l.reserveFd()
+		return applySockOpts(l.fd, l.network, l.sockOpts, true)
+	}
+	if err := applySockOpts(l.fd, l.network, l.sockOpts, true); err != nil {
+		l.Close()
+		return err
+	}
 	err := syscall.Bind(l.fd, l.sa)
 	if err != nil {
 		_ = l.Close()
 		return err
 	}
 	// 第二个参数(backlog)为max(未完成连接队列容量，已完成连接队列容量)
-	err = syscall.Listen(l.fd, 1024)
+	err = syscall.Listen(l.fd, l.limiter.backlog)
 	if err != nil {
 		l.Close()
 		return err
 	}
+	l.listening = true
+	l.reserveFd()
 	return nil
 }
 
@@ -208,21 +343,72 @@ func (l *Listener) BindAndListen() error {
  */
 func (l *Listener) acceptEvent(el *EventLoop.EventLoop, data interface{}) enum.Action {
 	// l.fd为socket的监听套接字，整个服务器socket运行时只有一份,nfd为已连接套接字，即每次accept取出一个可用连接后都会返回一个nfdnfd对应的是
-	confd, sa, err := syscall.Accept(l.fd)
-	if err != nil {
+	confd, sa, errs := syscall.Accept(l.fd)
+	if errs == syscall.EMFILE || errs == syscall.ENFILE || errs == syscall.ENOBUFS || errs == syscall.ENOMEM {
+		l.handleFdExhausted(el, err.Syscall("accept", errs))
+		return enum.CONTINUE
+	}
+	if errs != nil {
+		if errs != syscall.EAGAIN && errs != syscall.EINTR && errs != syscall.ECONNABORTED {
+			el.ReportError(err.Syscall("accept", errs), logger.Fd(l.fd), logger.F("listener", l.Key()))
+		}
 		return enum.CONTINUE
 	}
-	if err = syscall.SetNonblock(confd, true); err != nil {
+	if errs = syscall.SetNonblock(confd, true); errs != nil {
 		syscall.Close(confd)
 		return enum.CONTINUE
 	}
-	c, err := NewConn(confd, sa)
-	if err != nil {
+	c, errs := NewConn(confd, sa)
+	if errs != nil {
+		syscall.Close(confd)
+		return enum.CONTINUE
+	}
+	if l.acl != nil && !l.acl.check(c.address) {
+		syscall.Close(confd)
+		l.reject(el, sa, aclDenied(c.address))
+		return enum.CONTINUE
+	}
+	if errs = l.admit(c.address); errs != nil {
+		syscall.Close(confd)
+		l.reject(el, sa, errs)
+		return enum.CONTINUE
+	}
+	c.listener, c.peerIP = l, c.address
+	if errs = applySockOpts(confd, c.network, l.sockOpts, false); errs != nil {
+		el.ReportError(errs, c.LogFields()...)
+	} else {
+		c.lingering = l.sockOpts.Linger > 0
+	}
+	if errs = c.setInterest(el, enum.EVENT_READABLE); errs != nil {
+		// fd超出了Selector的容量
+		l.leave(c.peerIP)
+		syscall.Close(confd)
+		l.reject(el, sa, errs)
 		return enum.CONTINUE
 	}
-	el.RegisterEvent(c.fd, enum.EVENT_READABLE, c.readEvent, nil)
+	c.loop = el
+	if l.ipRate != nil {
+		c.rate.limiter = l.ipRate
+		c.rate.shared = l.ipRate.acquire(c.peerIP)
+	}
+	if l.codec != nil {
+		c.codec = l.codec(c)
+	}
+	c.applyTimeouts(l.timeouts)
+	c.maxPending = l.maxPending
+	if l.proxy {
+		c.expectProxyHeader(el, l.proxyTimeout)
+		// 需要先拿到真实的客户端地址才能触发Open
+		return enum.CONTINUE
+	}
+	// 有Codec的连接需要等握手等前置步骤完成后才触发Open
+	if c.codec != nil && !c.codec.Ready() {
+		return enum.CONTINUE
+	}
+	c.opened = true
 	// accept的时候通过修改trigerPtr输出对应信息
-	el.SetTrigerDataPtr([]string{c.network, c.address, strconv.Itoa(c.port)})
+	el.SetTrigerDataPtr(c.openInfo())
+	el.SetEventSource(c)
 	return enum.TRIGGER_OPEN_EVENT
 }
 
@@ -232,12 +418,31 @@ func (l *Listener) acceptEvent(el *EventLoop.EventLoop, data interface{}) enum.A
  * @return {*}
  */
 func (l *Listener) RegisterAccept(event_loop *EventLoop.EventLoop) error {
+	l.loop = event_loop
 	return event_loop.RegisterEvent(l.fd, enum.EVENT_READABLE, l.acceptEvent, nil)
 }
 
 // socket的装饰器,主要负责数据读写的工作(此为连接套接字,即其中维护的是连接描述符,每与一个客户端建立连接就会创建一个连接套接字)
 type Conn struct {
 	*Socket
+	context    interface{}          //上层协议绑定在连接上的自定义数据(如协议解析器的状态)
+	codec      Codec                //字节变换层,为nil时直接读写原始字节
+	opened     bool                 //是否已经触发过Open
+	proxy      *proxyState          //PROXY协议头的解析状态,Listener未开启时为nil
+	loop       *EventLoop.EventLoop //连接所在的事件循环
+	timeout    connTimeout          //空闲/读/写超时状态
+	closeErr   error                //连接关闭的原因
+	listener   *Listener            //accept得到该连接的Listener,用于归还连接计数
+	peerIP     string               //accept时的对端ip(PROXY协议替换地址之前),连接计数的key
+	interest   uint32               //fd当前在epoll中关注的事件
+	readPaused uint8                //暂停读的原因(位掩码),不为0时不监听读事件
+	rate       connRate
+	maxPending int                //未消费输入的上限,超过后自动暂停读
+	unix       *unixState         //Unix域连接上的辅助数据(fd/凭证)状态,其他连接为nil
+	closeFlush bool               //待发送数据全部写完后关闭连接
+	events     []*EventLoop.Event //连接单独使用的回调集合,为nil时使用Listener的回调集合
+	onDrain    []func()           //待发送数据全部写完后调用一次
+	lingering  bool               //设置了SO_LINGER超时,close会阻塞
 }
 
 /**
@@ -253,7 +458,7 @@ func NewConn(confd int, sa syscall.Sockaddr) (*Conn, error) {
 	if err != nil {
 		return nil, err
 	}
-	conn := &Conn{&Socket{
+	conn := &Conn{Socket: &Socket{
 		network:     network,
 		address:     addr,
 		port:        port,
@@ -263,9 +468,110 @@ func NewConn(confd int, sa syscall.Sockaddr) (*Conn, error) {
 		closedCount: 0,
 		fd:          confd,
 	}}
+	if network == "unix" {
+		conn.unix = &unixState{}
+	}
 	return conn, nil
 }
 
+/**
+ * @description:Open回调收到的连接信息:network,address,port
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) openInfo() []string {
+	return []string{c.network, c.address, strconv.Itoa(c.port)}
+}
+
+/**
+ * @description:获取连接上的Codec,没有设置时返回nil
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) Codec() Codec {
+	return c.codec
+}
+
+/**
+ * @description:连接关闭的原因,对端正常关闭时为nil,超时为CONN_TIMEOUT_ERR
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) Err() error {
+	return c.closeErr
+}
+
+/**
+ * @description:连接触发的事件优先使用连接单独的回调集合(如NewNetConn),否则使用accept它的Listener的回调集合(实现EventLoop.EventRouter)
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) Events() []*EventLoop.Event {
+	if c.events != nil {
+		return c.events
+	}
+	if c.listener == nil {
+		return nil
+	}
+	return c.listener.events
+}
+
+/**
+ * @description:日志中标识连接的字段:fd和对端地址
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) LogFields() []logger.Field {
+	return []logger.Field{logger.Fd(c.fd), logger.Remote(c.address + ":" + strconv.Itoa(c.port))}
+}
+
+/**
+ * @description:以reason为原因关闭连接,已经触发过Open的连接会触发Close;需要在事件循环中调用
+ * @param {error} reason 通过Conn.Err()获取
+ * @return {*}
+ */
+func (c *Conn) CloseWithError(reason error) {
+	if c.loop == nil {
+		c.Socket.Close()
+		return
+	}
+	c.release(c.loop, reason)
+}
+
+/**
+ * @description:关闭连接:从事件循环中注销读写事件、取消定时器并关闭fd,已经触发过Open的连接会触发Close
+ * @param {*EventLoop.EventLoop} el
+ * @param {error} reason 关闭原因,通过Conn.Err()获取
+ * @return {*}
+ */
+func (c *Conn) release(el *EventLoop.EventLoop, reason error) {
+	if c.closedCount >= 2 {
+		return
+	}
+	c.setInterest(el, enum.EVENT_NONE)
+	c.stopTimer()
+	c.releaseRate()
+	c.releaseUnix()
+	if c.proxy != nil && c.proxy.timer != nil {
+		el.RemoveUserEvent(c.proxy.timer)
+		c.proxy.timer = nil
+	}
+	if c.codec != nil {
+		c.codec.Close()
+	}
+	if reason != nil && el.Logger().Enabled(logger.DEBUG) {
+		el.Logger().Log(logger.DEBUG, "Socket-release:连接异常关闭", append(c.LogFields(), logger.Err(reason))...)
+	}
+	c.closeFd()
+	c.closeErr = reason
+	if c.listener != nil {
+		c.listener.leave(c.peerIP)
+	}
+	if c.opened {
+		el.Trigger(enum.TRIGGER_CLOSE_EVENT, c)
+	}
+}
+
 /**
  * @description:提供给上层调用的api;通过readEvent将数据读到Conn.in后,从Conn.in中读出去
  * @param {*}
@@ -274,16 +580,106 @@ func NewConn(confd int, sa syscall.Sockaddr) (*Conn, error) {
 func (c *Conn) Read() []byte {
 	res := c.in
 	c.in = []byte{}
+	c.checkPending()
 	return res
 }
 
+/**
+ * @description:为连接绑定上层自定义数据,连接的整个生命周期内有效
+ * @param {interface{}} ctx
+ * @return {*}
+ */
+func (c *Conn) SetContext(ctx interface{}) {
+	c.context = ctx
+}
+
+/**
+ * @description:获取连接上绑定的自定义数据,未绑定时返回nil
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) Context() interface{} {
+	return c.context
+}
+
 /**
  * @description:将数据写入到c.out，供socket发出
  * @param {[]byte} data
  * @return {*}
  */
 func (c *Conn) Write(data []byte) {
+	if c.codec != nil {
+		encoded, err := c.codec.Encode(data)
+		if err != nil {
+			// 编码失败后Codec的状态不可预知(如TLS记录层出错),关闭连接并通过Err()报告原因
+			c.CloseWithError(err)
+			return
+		}
+		data = encoded
+	}
+	idle := len(c.out) == 0
 	c.out = append(c.out, data...)
+	// 需要在数据进入输出队列之后开始计算写超时,否则armTimer看不到待发送数据
+	if idle && len(data) > 0 {
+		c.startWrite()
+	}
+	c.updateInterest()
+}
+
+/**
+ * @description:待发送数据全部写出后关闭连接(如回复完HTTP/1.0请求),没有待发送数据时立即关闭;需要在事件循环中调用
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) CloseAfterFlush() {
+	if len(c.out) == 0 {
+		c.CloseWithError(nil)
+		return
+	}
+	c.closeFlush = true
+}
+
+/**
+ * @description:在epoll中把fd关注的事件切换为mask(读写二选一,或者EVENT_NONE表示不关注)
+ * @param {*EventLoop.EventLoop} el
+ * @param {uint32} mask
+ * @return {*}
+ */
+func (c *Conn) setInterest(el *EventLoop.EventLoop, mask uint32) error {
+	if mask == c.interest {
+		return nil
+	}
+	var errs error
+	switch mask {
+	case enum.EVENT_NONE:
+		el.UnRegisterEvent(c.fd, c.interest)
+	case enum.EVENT_WRITABLE:
+		errs = el.RegisterEvent(c.fd, mask, c.writeEvent, nil)
+	default:
+		errs = el.RegisterEvent(c.fd, mask, c.readEvent, nil)
+	}
+	if errs == nil {
+		c.interest = mask
+	}
+	return errs
+}
+
+/**
+ * @description:根据连接状态更新关注的事件:有待发送数据时优先写,否则在没有暂停读的情况下读
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) updateInterest() {
+	if c.loop == nil || c.closedCount >= 2 {
+		return
+	}
+	mask := enum.EVENT_NONE
+	if len(c.out) > 0 {
+		mask = enum.EVENT_WRITABLE
+	} else if c.readPaused == 0 {
+		mask = enum.EVENT_READABLE
+	}
+	c.setInterest(c.loop, mask)
 }
 
 /**
@@ -297,28 +693,77 @@ func (c *Conn) readEvent(el *EventLoop.EventLoop, _ interface{}) enum.Action {
 		action enum.Action
 		inBuf  = [1024]byte{}
 	)
-	n, err := syscall.Read(c.fd, inBuf[:])
+	n, err := c.recv(inBuf[:])
 	//以下报错都是非阻塞操作中可以忽略的错误,参考:https://www.cnblogs.com/bastard/archive/2013/04/10/3012724.html
 	if err == syscall.EINTR || err == syscall.EAGAIN || err == syscall.EWOULDBLOCK {
 		action = enum.CONTINUE
 	} else if n <= 0 {
-		// n小于0,说明此时收到对端发来的关闭信号
-		c.Shutdown(syscall.SHUT_RD)
-		action = enum.SHUTDOWN_RD
+		// n等于0说明对端关闭;小于0时为读错误(如连接被重置、辅助数据被截断),作为关闭原因
+		c.release(el, err)
+		return enum.CONTINUE
 	} else {
-		// inBuf切片被打散传入
-		c.in = append(c.in, inBuf[:n]...)
-		// 将连接socket的指针存入eventloop,则可以通过这个指针访问conn(委托模式)
-		el.SetTrigerDataPtr(c)
-		action = enum.TRIGGER_DATA_EVENT
-	}
-	// 读时间注册完后注册监听写事件
-	if c.closedCount == 0 {
-		el.RegisterEvent(c.fd, enum.EVENT_WRITABLE, c.writeEvent, nil)
+		c.touchRead()
+		c.countIn(n)
+		action = c.deliver(el, inBuf[:n])
+		c.consumeRate(n, action == enum.TRIGGER_DATA_EVENT)
+		c.checkPending()
 	}
+	// 有待发送数据(如握手回复)时切换为监听写事件,Data回调中Write的数据由Write自己切换
+	c.updateInterest()
 	return action
 }
 
+/**
+ * @description:处理读到的原始字节:依次经过PROXY协议头解析、Codec解码,
+ *  连接的前置步骤全部完成时补发Open,有数据时触发Data
+ * @param {*EventLoop.EventLoop} el
+ * @param {[]byte} data
+ * @return {*}
+ */
+func (c *Conn) deliver(el *EventLoop.EventLoop, data []byte) enum.Action {
+	if c.proxy != nil && c.proxy.header == nil {
+		rest, err := c.proxy.feed(data)
+		if err != nil {
+			c.release(el, err)
+			return enum.CONTINUE
+		}
+		if c.proxy.header == nil {
+			return enum.CONTINUE
+		}
+		c.applyProxyHeader(el)
+		data = rest
+	}
+	if c.codec != nil {
+		plain, reply, err := c.codec.Decode(data)
+		c.out = append(c.out, reply...)
+		if err != nil {
+			// 握手失败或者数据损坏,回复(如alert)尽力发送后关闭连接
+			if len(c.out) > 0 {
+				syscall.Write(c.fd, c.out)
+			}
+			c.release(el, err)
+			return enum.CONTINUE
+		}
+		data = plain
+	}
+	if !c.opened && (c.codec == nil || c.codec.Ready()) {
+		c.opened = true
+		el.TriggerFrom(c, enum.TRIGGER_OPEN_EVENT, c.openInfo())
+		// Open回调中可能关闭了连接(主动关闭或者panic)
+		if c.closedCount >= 2 {
+			return enum.CONTINUE
+		}
+	}
+	if len(data) == 0 {
+		return enum.CONTINUE
+	}
+	// inBuf切片被打散传入
+	c.in = append(c.in, data...)
+	// 将连接socket的指针存入eventloop,则可以通过这个指针访问conn(委托模式)
+	el.SetTrigerDataPtr(c)
+	return enum.TRIGGER_DATA_EVENT
+}
+
 /**
  * @description:执行一次socket写事件
  * @param {*EventLoop.EventLoop} el
@@ -327,20 +772,33 @@ func (c *Conn) readEvent(el *EventLoop.EventLoop, _ interface{}) enum.Action {
  */
 func (c *Conn) writeEvent(el *EventLoop.EventLoop, _ interface{}) enum.Action {
 	var action enum.Action
-	if len(c.out) == 0 {
-		return enum.CONTINUE
-	}
-	n, err := syscall.Write(c.fd, c.out)
-	if err != nil || n <= 0 {
-		c.Shutdown(syscall.SHUT_WR)
-		action = enum.SHUTDOWN_WR
-	} else {
+	if len(c.out) > 0 {
+		n, err := c.send()
+		if err == syscall.EINTR || err == syscall.EAGAIN {
+			return enum.CONTINUE
+		}
+		if err != nil || n <= 0 {
+			c.release(el, err)
+			return enum.CONTINUE
+		}
 		//读了前面部分数据,剩下的数据从n开始读
 		c.out = c.out[n:]
+		c.sent(n)
+		c.touchWrite()
+		c.countOut(n)
 	}
-	// 需要再用读事件覆盖写事件
-	if c.closedCount == 0 {
-		el.RegisterEvent(c.fd, enum.EVENT_READABLE, c.readEvent, nil)
+	if len(c.out) == 0 && len(c.onDrain) > 0 {
+		drained := c.onDrain
+		c.onDrain = nil
+		for _, fn := range drained {
+			fn()
+		}
+	}
+	if len(c.out) == 0 && c.closeFlush {
+		c.release(el, nil)
+		return enum.CONTINUE
 	}
+	// 数据全部写完后需要再用读事件覆盖写事件,没写完则继续监听写事件
+	c.updateInterest()
 	return action
 }
@@ -0,0 +1,227 @@
+/*
+ * @Description: 连接的空闲/读/写超时,基于EventLoop的定时器实现;每个连接只有一个定时器,
+ *  读写时只更新时间戳,定时器触发时再检查是否真正超时,没有超时则按最近的截止时间重新设置
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-01 14:35:50
+ * @LastEditTime: 2021-08-01 21:12:36
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import (
+	"Reactloop/EventLoop"
+	err "Reactloop/Utils/Error"
+	"time"
+)
+
+/**
+ * @description:超时设置,0表示不限制
+ *  Idle:连接上没有任何读写的最长时间
+ *  Read:两次收到数据之间的最长间隔
+ *  Write:待发送数据没有任何进展的最长时间
+ * @param {*}
+ * @return {*}
+ */
+type Timeouts struct {
+	Idle, Read, Write time.Duration
+}
+
+// 连接上的超时状态
+type connTimeout struct {
+	Timeouts
+	readDeadline  time.Time //SetReadDeadline设置的绝对时间,收到数据后失效
+	writeDeadline time.Time //SetWriteDeadline设置的绝对时间,待发送数据写完后失效
+	lastActive    time.Time
+	lastRead      time.Time
+	lastWrite     time.Time //最近一次写出进展(或者开始有待发送数据)的时间
+	timer         *EventLoop.UserEvent
+}
+
+/**
+ * @description:为Listener之后accept的连接设置默认超时,单个连接可以再通过Conn.SetXXX覆盖
+ * @param {Timeouts} t
+ * @return {*}
+ */
+func (l *Listener) SetTimeouts(t Timeouts) {
+	l.timeouts = t
+}
+
+/**
+ * @description:获取Listener的默认超时设置
+ * @param {*}
+ * @return {*}
+ */
+func (l *Listener) Timeouts() Timeouts {
+	return l.timeouts
+}
+
+/**
+ * @description:连接建立时应用默认超时设置
+ * @param {Timeouts} t
+ * @return {*}
+ */
+func (c *Conn) applyTimeouts(t Timeouts) {
+	now := time.Now()
+	c.timeout.Timeouts = t
+	c.timeout.lastActive, c.timeout.lastRead, c.timeout.lastWrite = now, now, now
+	c.armTimer()
+}
+
+/**
+ * @description:设置空闲超时,超过d没有任何读写则关闭连接
+ * @param {time.Duration} d 0表示不限制
+ * @return {*}
+ */
+func (c *Conn) SetIdleTimeout(d time.Duration) {
+	c.timeout.Idle = d
+	c.armTimer()
+}
+
+/**
+ * @description:设置读超时,超过d没有收到新数据则关闭连接
+ * @param {time.Duration} d 0表示不限制
+ * @return {*}
+ */
+func (c *Conn) SetReadTimeout(d time.Duration) {
+	c.timeout.Read = d
+	c.armTimer()
+}
+
+/**
+ * @description:设置写超时,待发送的数据超过d没有写出任何字节则关闭连接
+ * @param {time.Duration} d 0表示不限制
+ * @return {*}
+ */
+func (c *Conn) SetWriteTimeout(d time.Duration) {
+	c.timeout.Write = d
+	c.armTimer()
+}
+
+/**
+ * @description:设置读截止时间,到t为止还没有收到数据则关闭连接;收到数据后失效
+ * @param {time.Time} t 零值表示取消
+ * @return {*}
+ */
+func (c *Conn) SetReadDeadline(t time.Time) {
+	c.timeout.readDeadline = t
+	c.armTimer()
+}
+
+/**
+ * @description:设置写截止时间,到t为止待发送数据还没有全部写出则关闭连接;全部写出后失效
+ * @param {time.Time} t 零值表示取消
+ * @return {*}
+ */
+func (c *Conn) SetWriteDeadline(t time.Time) {
+	c.timeout.writeDeadline = t
+	c.armTimer()
+}
+
+// 收到数据
+func (c *Conn) touchRead() {
+	now := time.Now()
+	c.timeout.lastActive, c.timeout.lastRead = now, now
+	c.timeout.readDeadline = time.Time{}
+}
+
+// 写出了数据
+func (c *Conn) touchWrite() {
+	now := time.Now()
+	c.timeout.lastActive, c.timeout.lastWrite = now, now
+	if len(c.out) == 0 {
+		c.timeout.writeDeadline = time.Time{}
+	}
+}
+
+// 输出队列从空变为非空,写超时从现在开始计算
+func (c *Conn) startWrite() {
+	c.timeout.lastWrite = time.Now()
+	if c.timeout.Write > 0 || !c.timeout.writeDeadline.IsZero() {
+		c.armTimer()
+	}
+}
+
+/**
+ * @description:计算最近的截止时间以及对应的超时类型
+ * @param {*}
+ * @return {*} 没有任何超时设置时返回零值
+ */
+func (c *Conn) nextDeadline() (time.Time, string) {
+	var (
+		at   time.Time
+		kind string
+	)
+	earlier := func(t time.Time, k string) {
+		if !t.IsZero() && (at.IsZero() || t.Before(at)) {
+			at, kind = t, k
+		}
+	}
+	t := &c.timeout
+	if t.Idle > 0 {
+		earlier(t.lastActive.Add(t.Idle), "idle")
+	}
+	if t.Read > 0 {
+		earlier(t.lastRead.Add(t.Read), "read")
+	}
+	earlier(t.readDeadline, "read")
+	// 写超时只在有待发送数据时生效
+	if len(c.out) > 0 {
+		if t.Write > 0 {
+			earlier(t.lastWrite.Add(t.Write), "write")
+		}
+		earlier(t.writeDeadline, "write")
+	}
+	return at, kind
+}
+
+/**
+ * @description:按最近的截止时间设置定时器;已有定时器更早触发时保留它,触发后再重新计算
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) armTimer() {
+	if c.loop == nil || c.closedCount >= 2 {
+		return
+	}
+	at, _ := c.nextDeadline()
+	if at.IsZero() {
+		c.stopTimer()
+		return
+	}
+	t := &c.timeout
+	if t.timer != nil {
+		if !t.timer.NexttriggerTime.After(at) {
+			return
+		}
+		c.stopTimer()
+	}
+	t.timer = c.loop.AddTimer(time.Until(at), c.onTimer)
+}
+
+func (c *Conn) stopTimer() {
+	if c.timeout.timer != nil {
+		c.loop.RemoveUserEvent(c.timeout.timer)
+		c.timeout.timer = nil
+	}
+}
+
+/**
+ * @description:定时器触发:真正超时则以超时错误关闭连接并触发Close,否则重新设置定时器
+ * @param {*EventLoop.EventLoop} el
+ * @param {*interface{}} _
+ * @return {*}
+ */
+func (c *Conn) onTimer(el *EventLoop.EventLoop, _ *interface{}) {
+	c.timeout.timer = nil
+	at, kind := c.nextDeadline()
+	if at.IsZero() {
+		return
+	}
+	if !at.After(time.Now()) {
+		c.release(el, &err.CONN_TIMEOUT_ERR{Kind: kind})
+		return
+	}
+	c.armTimer()
+}
@@ -0,0 +1,98 @@
+/*
+ * @Description: 连接超时截止时间计算与事件循环中的超时关闭测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-01 20:40:33
+ * @LastEditTime: 2021-08-01 21:05:10
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import (
+	"Reactloop/EventLoop"
+	err "Reactloop/Utils/Error"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestNextDeadline(t *testing.T) {
+	c := &Conn{Socket: &Socket{}}
+	if at, _ := c.nextDeadline(); !at.IsZero() {
+		t.Fatal("no timeout configured")
+	}
+	c.applyTimeouts(Timeouts{Idle: time.Minute, Read: time.Second, Write: time.Millisecond})
+	// 没有待发送数据时写超时不生效
+	if _, kind := c.nextDeadline(); kind != "read" {
+		t.Fatalf("expected read timeout first, got %s", kind)
+	}
+	c.Write([]byte("pending"))
+	if _, kind := c.nextDeadline(); kind != "write" {
+		t.Fatalf("expected write timeout first, got %s", kind)
+	}
+	c.out = c.out[:0]
+	c.touchWrite()
+	c.SetReadTimeout(0)
+	if _, kind := c.nextDeadline(); kind != "idle" {
+		t.Fatalf("expected idle timeout, got %s", kind)
+	}
+	deadline := time.Now().Add(time.Millisecond)
+	c.SetReadDeadline(deadline)
+	if at, kind := c.nextDeadline(); kind != "read" || !at.Equal(deadline) {
+		t.Fatalf("expected read deadline, got %s %v", kind, at)
+	}
+	c.touchRead()
+	if _, kind := c.nextDeadline(); kind != "idle" {
+		t.Fatalf("read deadline should be cleared, got %s", kind)
+	}
+}
+
+func TestTimeoutClosesConn(t *testing.T) {
+	for _, tc := range []struct {
+		kind     string
+		timeouts Timeouts
+		pending  bool //是否留有对端不读的待发送数据
+	}{
+		{"idle", Timeouts{Idle: 50 * time.Millisecond}, false},
+		{"read", Timeouts{Idle: time.Minute, Read: 50 * time.Millisecond}, false},
+		{"write", Timeouts{Read: time.Minute, Write: 50 * time.Millisecond}, true},
+	} {
+		pair, errs := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+		if errs != nil {
+			t.Fatal(errs)
+		}
+		el := EventLoop.New()
+		var closed *Conn
+		el.AddSystemEvent(&EventLoop.Event{Close: func(el *EventLoop.EventLoop, p *interface{}) {
+			closed = (*p).(*Conn)
+		}})
+		c, errs := AdoptConn(el, pair[1])
+		if errs != nil {
+			t.Fatal(errs)
+		}
+		start := time.Now()
+		c.applyTimeouts(tc.timeouts)
+		if tc.pending {
+			c.Write(make([]byte, 8<<20))
+		}
+		for time.Since(start) < 2*time.Second && closed == nil {
+			el.TikTok()
+		}
+		if closed != c {
+			t.Fatalf("%s timeout did not close the conn", tc.kind)
+		}
+		var timeout *err.CONN_TIMEOUT_ERR
+		if !errors.As(c.Err(), &timeout) || timeout.Kind != tc.kind || !errors.Is(c.Err(), err.ErrTimeout) {
+			t.Fatalf("%s timeout closed with %v", tc.kind, c.Err())
+		}
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Fatalf("%s timeout fired early after %v", tc.kind, elapsed)
+		}
+		if el.FindNearestTask() != nil {
+			t.Fatalf("%s timeout left its timer on the loop", tc.kind)
+		}
+		syscall.Close(pair[0])
+	}
+}
@@ -0,0 +1,257 @@
+/*
+ * @Description: Unix域连接:通过辅助数据收发文件描述符(SCM_RIGHTS)与进程凭证(SCM_CREDENTIALS),
+ *  收到的套接字fd可以通过AdoptConn作为新的连接加入事件循环
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-11 10:06:32
+ * @LastEditTime: 2021-08-11 17:45:09
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import (
+	"Reactloop/EventLoop"
+	enum "Reactloop/Utils/Enum"
+	err "Reactloop/Utils/Error"
+	"syscall"
+)
+
+// 排队等待发送的一条带辅助数据的消息,数据本身和普通数据一起放在Conn.out中
+type ctrlMsg struct {
+	at   int    //消息数据在Conn.out中的起始位置
+	size int    //消息数据的长度
+	oob  []byte //辅助数据
+	fds  []int  //oob中引用的fd(发送前复制的一份,发送后关闭)
+}
+
+// Unix域连接上的辅助数据状态
+type unixState struct {
+	ctrl []ctrlMsg      //按顺序等待发送的带辅助数据的消息
+	fds  []int          //已经收到、还没有被取走的fd
+	cred *syscall.Ucred //最近一次收到的凭证
+	oob  []byte         //接收辅助数据的缓冲区
+}
+
+/**
+ * @description:把一个已连接的套接字fd(如从其他进程收到的客户端连接)作为连接加入事件循环,
+ *  与accept得到的连接一样触发Open/Data/Close;成功后fd归Conn所有
+ * @param {*EventLoop.EventLoop} el
+ * @param {int} fd
+ * @return {*}
+ */
+func AdoptConn(el *EventLoop.EventLoop, fd int) (*Conn, error) {
+	sa, errs := syscall.Getpeername(fd)
+	if errs != nil {
+		return nil, errs
+	}
+	if errs := syscall.SetNonblock(fd, true); errs != nil {
+		return nil, errs
+	}
+	syscall.CloseOnExec(fd)
+	c, errs := NewConn(fd, sa)
+	if errs != nil {
+		return nil, errs
+	}
+	if errs := c.setInterest(el, enum.EVENT_READABLE); errs != nil {
+		return nil, errs
+	}
+	c.loop = el
+	c.opened = true
+	el.TriggerFrom(c, enum.TRIGGER_OPEN_EVENT, c.openInfo())
+	return c, nil
+}
+
+/**
+ * @description:连接path上的Unix域套接字,连接作为Conn加入事件循环
+ * @param {*EventLoop.EventLoop} el
+ * @param {string} path
+ * @return {*}
+ */
+func DialUnix(el *EventLoop.EventLoop, path string) (*Conn, error) {
+	fd, errs := syscall.Socket(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if errs != nil {
+		return nil, errs
+	}
+	if errs := syscall.Connect(fd, &syscall.SockaddrUnix{Name: path}); errs != nil {
+		syscall.Close(fd)
+		return nil, errs
+	}
+	c, errs := AdoptConn(el, fd)
+	if errs != nil {
+		syscall.Close(fd)
+		return nil, errs
+	}
+	return c, nil
+}
+
+/**
+ * @description:发送一条消息并附带文件描述符和/或进程凭证,与Write写入的数据保持先后顺序;
+ *  fds在调用时被复制,调用方可以立即关闭自己的fd
+ * @param {[]byte} data 为空时发送1个0字节(辅助数据不能单独发送)
+ * @param {[]int} fds
+ * @param {*syscall.Ucred} cred 为nil时不发送凭证;非root进程只能发送自己的pid/uid/gid
+ * @return {*}
+ */
+func (c *Conn) WriteMsg(data []byte, fds []int, cred *syscall.Ucred) error {
+	if c.unix == nil || c.codec != nil {
+		return &err.UNKNOW_NETWORK_ERR{Network: c.network}
+	}
+	if c.closedCount >= 2 {
+		return syscall.EPIPE
+	}
+	if len(data) == 0 {
+		data = []byte{0}
+	}
+	dups := make([]int, 0, len(fds))
+	for _, fd := range fds {
+		dup, errs := syscall.Dup(fd)
+		if errs != nil {
+			closeFds(dups)
+			return errs
+		}
+		syscall.CloseOnExec(dup)
+		dups = append(dups, dup)
+	}
+	var oob []byte
+	if len(dups) > 0 {
+		oob = append(oob, syscall.UnixRights(dups...)...)
+	}
+	if cred != nil {
+		oob = append(oob, syscall.UnixCredentials(cred)...)
+	}
+	idle := len(c.out) == 0
+	c.unix.ctrl = append(c.unix.ctrl, ctrlMsg{at: len(c.out), size: len(data), oob: oob, fds: dups})
+	c.out = append(c.out, data...)
+	if idle && len(data) > 0 {
+		c.startWrite()
+	}
+	c.updateInterest()
+	return nil
+}
+
+/**
+ * @description:取走已经收到的文件描述符,之后由调用方负责关闭;没有取走的fd在连接关闭时关闭
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) ReadFds() []int {
+	if c.unix == nil {
+		return nil
+	}
+	fds := c.unix.fds
+	c.unix.fds = nil
+	return fds
+}
+
+/**
+ * @description:最近一次随消息收到的进程凭证,需要先SetPassCred(true)
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) ReadCred() *syscall.Ucred {
+	if c.unix == nil {
+		return nil
+	}
+	return c.unix.cred
+}
+
+/**
+ * @description:开启后每条消息都会附带发送方的凭证(由内核填写),通过ReadCred获取
+ * @param {bool} on
+ * @return {*}
+ */
+func (c *Conn) SetPassCred(on bool) error {
+	value := 0
+	if on {
+		value = 1
+	}
+	return syscall.SetsockoptInt(c.fd, syscall.SOL_SOCKET, syscall.SO_PASSCRED, value)
+}
+
+/**
+ * @description:对端进程在建立连接时的凭证(SO_PEERCRED)
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) PeerCred() (*syscall.Ucred, error) {
+	if c.unix == nil {
+		return nil, &err.UNKNOW_NETWORK_ERR{Network: c.network}
+	}
+	return syscall.GetsockoptUcred(c.fd, syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+}
+
+/**
+ * @description:读一次数据,Unix域连接同时接收辅助数据
+ * @param {[]byte} buf
+ * @return {*}
+ */
+func (c *Conn) recv(buf []byte) (int, error) {
+	if c.unix == nil {
+		return syscall.Read(c.fd, buf)
+	}
+	if c.unix.oob == nil {
+		c.unix.oob = make([]byte, oobSize)
+	}
+	n, oobn, flags, _, errs := syscall.Recvmsg(c.fd, buf, c.unix.oob, syscall.MSG_CMSG_CLOEXEC)
+	if errs != nil {
+		return n, errs
+	}
+	if oobn > 0 || flags&syscall.MSG_CTRUNC != 0 {
+		fds, cred, errs := readControl(c.unix.oob[:oobn], flags)
+		if errs != nil {
+			// 无法确定丢失的fd属于哪条消息,连接上后续的数据也不再可信
+			return -1, errs
+		}
+		c.unix.fds = append(c.unix.fds, fds...)
+		if cred != nil {
+			c.unix.cred = cred
+		}
+	}
+	return n, nil
+}
+
+/**
+ * @description:写一次数据:带辅助数据的消息之前的普通数据用write发送,轮到消息时用sendmsg附带辅助数据
+ * @param {*}
+ * @return {*}
+ */
+func (c *Conn) send() (int, error) {
+	if c.unix == nil || len(c.unix.ctrl) == 0 {
+		return syscall.Write(c.fd, c.out)
+	}
+	m := &c.unix.ctrl[0]
+	if m.at > 0 {
+		return syscall.Write(c.fd, c.out[:m.at])
+	}
+	n, errs := syscall.SendmsgN(c.fd, c.out[:m.size], m.oob, nil, 0)
+	if errs != nil {
+		return n, errs
+	}
+	// 辅助数据随第一个字节发出,消息没有写完的部分作为普通数据继续发送
+	closeFds(m.fds)
+	c.unix.ctrl = c.unix.ctrl[1:]
+	return n, nil
+}
+
+// 写出n个字节后更新排队消息的位置
+func (c *Conn) sent(n int) {
+	if c.unix == nil {
+		return
+	}
+	for i := range c.unix.ctrl {
+		c.unix.ctrl[i].at -= n
+	}
+}
+
+// 连接关闭时关闭没有发出和没有被取走的fd
+func (c *Conn) releaseUnix() {
+	if c.unix == nil {
+		return
+	}
+	for _, m := range c.unix.ctrl {
+		closeFds(m.fds)
+	}
+	closeFds(c.unix.fds)
+	c.unix.ctrl, c.unix.fds = nil, nil
+}
@@ -0,0 +1,223 @@
+/*
+ * @Description: Unix域连接收发fd与凭证的测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-11 15:20:44
+ * @LastEditTime: 2021-08-11 17:40:12
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package Socket
+
+import (
+	"Reactloop/EventLoop"
+	err "Reactloop/Utils/Error"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+func TestUnixConnPassFds(t *testing.T) {
+	pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	el := EventLoop.New()
+	received := []byte{}
+	var (
+		fds  []int
+		cred *syscall.Ucred
+	)
+	el.AddSystemEvent(&EventLoop.Event{Data: func(el *EventLoop.EventLoop, p *interface{}) {
+		c := (*p).(*Conn)
+		received = append(received, c.Read()...)
+		fds = append(fds, c.ReadFds()...)
+		if cr := c.ReadCred(); cr != nil {
+			cred = cr
+		}
+	}})
+	sender, err := AdoptConn(el, pair[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver, err := AdoptConn(el, pair[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := receiver.SetPassCred(true); err != nil {
+		t.Fatal(err)
+	}
+	if pc, err := receiver.PeerCred(); err != nil || int(pc.Pid) != os.Getpid() {
+		t.Fatal("peer cred", pc, err)
+	}
+
+	pipe := make([]int, 2)
+	if err := syscall.Pipe(pipe); err != nil {
+		t.Fatal(err)
+	}
+	sender.Write([]byte("head:"))
+	self := &syscall.Ucred{Pid: int32(os.Getpid()), Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid())}
+	if err := sender.WriteMsg([]byte("fd"), []int{pipe[1]}, self); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Close(pipe[1])
+	sender.Write([]byte(":tail"))
+	for i := 0; i < 10 && len(received) < len("head:fd:tail"); i++ {
+		el.TikTok()
+	}
+	if string(received) != "head:fd:tail" || len(fds) != 1 {
+		t.Fatalf("received %q fds %v", received, fds)
+	}
+	if cred == nil || cred.Pid != self.Pid {
+		t.Fatal("missing credentials", cred)
+	}
+	syscall.Write(fds[0], []byte("x"))
+	syscall.Close(fds[0])
+	buf := make([]byte, 4)
+	if n, _ := syscall.Read(pipe[0], buf); n != 1 || buf[0] != 'x' {
+		t.Fatal("passed fd does not refer to the pipe")
+	}
+	syscall.Close(pipe[0])
+
+	// 收到的套接字fd作为新的连接加入事件循环
+	inner, _ := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	sender.WriteMsg(nil, []int{inner[1]}, nil)
+	syscall.Close(inner[1])
+	fds = nil
+	for i := 0; i < 10 && len(fds) == 0; i++ {
+		el.TikTok()
+	}
+	if len(fds) != 1 {
+		t.Fatal("socket fd not received")
+	}
+	adopted, err := AdoptConn(el, fds[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	received = nil
+	syscall.Write(inner[0], []byte("ping"))
+	for i := 0; i < 10 && len(received) == 0; i++ {
+		el.TikTok()
+	}
+	if string(received) != "ping" {
+		t.Fatalf("adopted conn received %q", received)
+	}
+	syscall.Close(inner[0])
+	adopted.release(el, nil)
+	sender.release(el, nil)
+	receiver.release(el, nil)
+}
+
+func TestUnixListener(t *testing.T) {
+	path := t.TempDir() + "/reactloop.sock"
+	l, err := NewListener("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.BindAndListen(); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	el := EventLoop.New()
+	var accepted *Conn
+	el.AddSystemEvent(&EventLoop.Event{Data: func(el *EventLoop.EventLoop, p *interface{}) {
+		accepted = (*p).(*Conn)
+		accepted.Read()
+	}})
+	l.RegisterAccept(el)
+	client, err := DialUnix(el, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Write([]byte("hi"))
+	for i := 0; i < 10 && accepted == nil; i++ {
+		el.TikTok()
+	}
+	if accepted == nil || accepted.network != "unix" || accepted.unix == nil {
+		t.Fatal("unix connection not accepted", accepted)
+	}
+	if l.Key() != "unix:"+path+":0" {
+		t.Fatal(l.Key())
+	}
+	client.release(el, nil)
+	accepted.release(el, nil)
+}
+
+// pipe的写端是否已经全部关闭(没有泄漏的fd时读端读到EOF)
+func writerClosed(t *testing.T, r int) bool {
+	syscall.SetNonblock(r, true)
+	n, errs := syscall.Read(r, make([]byte, 1))
+	if errs == syscall.EAGAIN {
+		return false
+	}
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	return n == 0
+}
+
+func TestUnixTruncatedRights(t *testing.T) {
+	pair, errs := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	defer syscall.Close(pair[0])
+	el := EventLoop.New()
+	receiver, errs := AdoptConn(el, pair[1])
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	// 辅助数据缓冲区只够放一个fd,发送三个时内核设置MSG_CTRUNC
+	receiver.unix.oob = make([]byte, syscall.CmsgSpace(4))
+	pipe := make([]int, 2)
+	if errs := syscall.Pipe(pipe); errs != nil {
+		t.Fatal(errs)
+	}
+	defer syscall.Close(pipe[0])
+	if errs := SendFds(pair[0], []byte("x"), pipe[1], pipe[1], pipe[1]); errs != nil {
+		t.Fatal(errs)
+	}
+	syscall.Close(pipe[1])
+	for i := 0; i < 10 && receiver.Err() == nil; i++ {
+		el.TikTok()
+	}
+	var ctrl *err.CONTROL_MSG_ERR
+	if !errors.As(receiver.Err(), &ctrl) {
+		t.Fatalf("conn should be closed with a control message error, got %v", receiver.Err())
+	}
+	if !writerClosed(t, pipe[0]) {
+		t.Fatal("fds received with a truncated control message leaked")
+	}
+}
+
+func TestParseControlClosesFds(t *testing.T) {
+	pipe := make([]int, 2)
+	if errs := syscall.Pipe(pipe); errs != nil {
+		t.Fatal(errs)
+	}
+	defer syscall.Close(pipe[0])
+	fd, _ := syscall.Dup(pipe[1])
+	// 凭证消息在前且长度错误,后面的SCM_RIGHTS中的fd同样需要关闭
+	badCred := syscall.UnixRights(0)
+	(*syscall.Cmsghdr)(unsafe.Pointer(&badCred[0])).Type = syscall.SCM_CREDENTIALS
+	if _, _, errs := parseControl(append(badCred, syscall.UnixRights(fd)...)); errs == nil {
+		t.Fatal("expected error for malformed credentials")
+	}
+	if _, errs := syscall.Dup(fd); errs != syscall.EBADF {
+		t.Fatal("fd after the malformed message was not closed")
+	}
+
+	// 消息头本身格式错误时按消息头找出前面的fd
+	fd, _ = syscall.Dup(pipe[1])
+	syscall.Close(pipe[1])
+	oob := append(syscall.UnixRights(fd), make([]byte, syscall.CmsgSpace(0))...)
+	(*syscall.Cmsghdr)(unsafe.Pointer(&oob[syscall.CmsgSpace(4)])).Len = 1
+	if _, _, errs := parseControl(oob); errs == nil {
+		t.Fatal("expected error for malformed header")
+	}
+	if !writerClosed(t, pipe[0]) {
+		t.Fatal("fd in a malformed control message leaked")
+	}
+}
@@ -0,0 +1,262 @@
+/*
+ * @Description: 在事件循环的连接上终止TLS:握手与记录层处理都基于Conn缓冲的字节完成,握手完成后才触发Open
+ * @Author: Rocky Hoo
+ * @Date: 2021-07-29 20:40:55
+ * @LastEditTime: 2021-07-29 23:12:08
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package TLS
+
+import (
+	"Reactloop/Socket"
+	"crypto/tls"
+	"io"
+	"strings"
+)
+
+/**
+ * @description:TLS配置:默认证书、按SNI选择的证书以及ALPN协议列表
+ * @param {*}
+ * @return {*}
+ */
+type Config struct {
+	Base       *tls.Config //可选,MinVersion/ClientAuth等其余设置从这里复制
+	NextProtos []string    //ALPN协议列表,按优先级排列
+	def        *tls.Certificate
+	sni        map[string]*tls.Certificate
+}
+
+/**
+ * @description: Config构造函数
+ * @param {tls.Certificate} cert 客户端没有发送SNI或者没有匹配的证书时使用的默认证书
+ * @return {*}
+ */
+func NewConfig(cert tls.Certificate) *Config {
+	return &Config{
+		def: &cert,
+		sni: map[string]*tls.Certificate{},
+	}
+}
+
+/**
+ * @description: 从PEM文件加载默认证书
+ * @param {string} certFile
+ * @param {string} keyFile
+ * @return {*}
+ */
+func LoadConfig(certFile, keyFile string) (*Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return NewConfig(cert), nil
+}
+
+/**
+ * @description:为指定的服务器名添加证书,支持"*.example.com"形式的通配符
+ * @param {string} serverName
+ * @param {tls.Certificate} cert
+ * @return {*}
+ */
+func (c *Config) AddCertificate(serverName string, cert tls.Certificate) {
+	c.sni[strings.ToLower(serverName)] = &cert
+}
+
+/**
+ * @description:根据ClientHello中的SNI选择证书:精确匹配 > 通配符匹配 > 默认证书
+ * @param {*tls.ClientHelloInfo} hello
+ * @return {*}
+ */
+func (c *Config) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if cert, ok := c.sni[name]; ok {
+		return cert, nil
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		if cert, ok := c.sni["*"+name[i:]]; ok {
+			return cert, nil
+		}
+	}
+	return c.def, nil
+}
+
+/**
+ * @description:生成crypto/tls使用的配置
+ * @param {*}
+ * @return {*}
+ */
+func (c *Config) build() *tls.Config {
+	var cfg *tls.Config
+	if c.Base != nil {
+		cfg = c.Base.Clone()
+	} else {
+		cfg = &tls.Config{}
+	}
+	cfg.GetCertificate = c.getCertificate
+	if len(c.NextProtos) > 0 {
+		cfg.NextProtos = c.NextProtos
+	}
+	return cfg
+}
+
+/**
+ * @description:为Listener开启TLS,之后accept的连接都会先完成握手再触发Open,Data回调中读写的都是明文;
+ *  握手在单独的goroutine中进行,不阻塞事件循环,握手迟迟不完成的客户端由Listener的超时设置(SetTimeouts)关闭
+ * @param {*Socket.Listener} l
+ * @param {*Config} cfg
+ * @return {*}
+ */
+func Listen(l *Socket.Listener, cfg *Config) {
+	tlsConfig := cfg.build()
+	l.SetCodec(func(c *Socket.Conn) Socket.Codec {
+		return newCodec(tlsConfig, c.WakeCodec)
+	})
+}
+
+/**
+ * @description:获取连接的TLS状态(协商的版本、SNI、ALPN等),非TLS连接或握手未完成时返回false
+ * @param {*Socket.Conn} conn
+ * @return {*}
+ */
+func ConnectionState(conn *Socket.Conn) (tls.ConnectionState, bool) {
+	c, ok := conn.Codec().(*codec)
+	// 握手过程中tls.Conn被握手goroutine占用,此时不能读取状态
+	if !ok || !c.Ready() {
+		return tls.ConnectionState{}, false
+	}
+	return c.conn.ConnectionState(), true
+}
+
+// codec 实现Socket.Codec,每个连接一个
+type codec struct {
+	transport *transport
+	conn      *tls.Conn
+	pending   []byte //握手完成之前用户写入的明文
+	ready     bool   //事件循环已经看到握手成功,只在事件循环中访问
+	done      bool   //握手goroutine已经退出
+	err       error
+}
+
+/**
+ * @description: codec构造函数
+ * @param {*tls.Config} cfg
+ * @param {func()} wake 握手goroutine有输出或者握手结束时调用,需要让事件循环随后以空输入调用Decode
+ * @return {*}
+ */
+func newCodec(cfg *tls.Config, wake func()) *codec {
+	t := newTransport(wake)
+	c := &codec{
+		transport: t,
+		conn:      tls.Server(t, cfg),
+	}
+	go c.run()
+	return c
+}
+
+/**
+ * @description:驱动握手的goroutine,握手结束(成功或失败)后通知事件循环并退出,之后tls.Conn只在事件循环中使用
+ * @param {*}
+ * @return {*}
+ */
+func (c *codec) run() {
+	err := c.conn.Handshake()
+	c.transport.mu.Lock()
+	defer c.transport.mu.Unlock()
+	c.transport.nonblock = true
+	c.err = err
+	c.done = true
+	if !c.transport.closed {
+		c.transport.notify()
+	}
+}
+
+/**
+ * @description:喂入密文并取走当前已经就绪的明文和回复,不等待握手goroutine;
+ *  握手期间回复由goroutine通过wake通知后,在下一次Decode中取走
+ * @param {[]byte} raw
+ * @return {*}
+ */
+func (c *codec) Decode(raw []byte) ([]byte, []byte, error) {
+	t := c.transport
+	t.mu.Lock()
+	t.in = append(t.in, raw...)
+	t.cond.Broadcast()
+	done, errs := c.done, c.err
+	t.mu.Unlock()
+
+	var plain []byte
+	if done && errs == nil {
+		if !c.ready {
+			c.ready = true
+			// 握手刚完成时把之前缓存的明文加密发送
+			if len(c.pending) > 0 {
+				pending := c.pending
+				c.pending = nil
+				if _, errs = c.conn.Write(pending); errs != nil {
+					c.err = errs
+				}
+			}
+		}
+		if errs == nil {
+			plain, errs = c.read()
+		}
+	}
+	t.mu.Lock()
+	reply := t.out
+	t.out = []byte{}
+	t.mu.Unlock()
+	// 对端发送close_notify属于正常关闭,先把已经解密的数据交出去
+	if errs == io.EOF && len(plain) > 0 {
+		errs = nil
+	}
+	return plain, reply, errs
+}
+
+/**
+ * @description:在事件循环中同步解密传输层中已有的完整记录,数据不足一个记录时tls.Conn保留已读部分,等待下一次Decode
+ * @param {*}
+ * @return {*}
+ */
+func (c *codec) read() ([]byte, error) {
+	plain := []byte{}
+	buf := make([]byte, 16*1024)
+	for {
+		n, err := c.conn.Read(buf)
+		plain = append(plain, buf[:n]...)
+		if _, ok := err.(wouldBlock); ok {
+			return plain, nil
+		}
+		if err != nil {
+			c.err = err
+			return plain, err
+		}
+	}
+}
+
+func (c *codec) Encode(plain []byte) ([]byte, error) {
+	if c.ready && c.err != nil {
+		return nil, c.err
+	}
+	if !c.ready {
+		c.pending = append(c.pending, plain...)
+		return nil, nil
+	}
+	if _, err := c.conn.Write(plain); err != nil {
+		return nil, err
+	}
+	c.transport.mu.Lock()
+	defer c.transport.mu.Unlock()
+	encoded := c.transport.out
+	c.transport.out = []byte{}
+	return encoded, nil
+}
+
+func (c *codec) Ready() bool {
+	return c.ready
+}
+
+func (c *codec) Close() {
+	c.transport.Close()
+}
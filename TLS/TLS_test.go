@@ -0,0 +1,316 @@
+/*
+ * @Description: TLS Codec测试(使用内存管道模拟socket)
+ * @Author: Rocky Hoo
+ * @Date: 2021-07-29 22:40:12
+ * @LastEditTime: 2021-07-29 23:20:45
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package TLS
+
+import (
+	"Reactloop/EventLoop"
+	"Reactloop/Socket"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func selfSigned(t *testing.T, name string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// driver 模拟事件循环:把客户端发来的密文交给codec,codec通过wake通知时以空输入再次Decode,回复按顺序写回客户端
+type driver struct {
+	t    *testing.T
+	c    *codec
+	wake chan struct{}
+	in   chan []byte
+	out  chan []byte
+}
+
+func newWake() (chan struct{}, func()) {
+	wake := make(chan struct{}, 64)
+	return wake, func() {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func drive(t *testing.T, cfg *tls.Config, server net.Conn) *driver {
+	wake, notify := newWake()
+	d := &driver{t: t, c: newCodec(cfg, notify), wake: wake, in: make(chan []byte, 64), out: make(chan []byte, 64)}
+	go func() {
+		buf := make([]byte, 64*1024)
+		for {
+			n, err := server.Read(buf)
+			if err != nil {
+				return
+			}
+			d.in <- append([]byte{}, buf[:n]...)
+		}
+	}()
+	go func() {
+		for b := range d.out {
+			server.Write(b)
+		}
+	}()
+	return d
+}
+
+// 处理一次输入或者唤醒,返回解密出的明文
+func (d *driver) step() []byte {
+	var data []byte
+	select {
+	case data = <-d.in:
+	case <-d.wake:
+	case <-time.After(2 * time.Second):
+		d.t.Fatal("codec stalled")
+	}
+	plain, reply, err := d.c.Decode(data)
+	if err != nil {
+		d.t.Fatal(err)
+	}
+	if len(reply) > 0 {
+		d.out <- reply
+	}
+	return plain
+}
+
+func (d *driver) Close() {
+	d.c.Close()
+	close(d.out)
+}
+
+func TestCodecHandshakeSNIAndALPN(t *testing.T) {
+	cfg := NewConfig(selfSigned(t, "default.test"))
+	cfg.AddCertificate("*.example.test", selfSigned(t, "api.example.test"))
+	cfg.NextProtos = []string{"h2", "http/1.1"}
+	clientSide, serverSide := net.Pipe()
+	d := drive(t, cfg.build(), serverSide)
+	defer d.Close()
+
+	client := tls.Client(clientSide, &tls.Config{
+		ServerName:         "api.example.test",
+		NextProtos:         []string{"http/1.1"},
+		InsecureSkipVerify: true,
+	})
+	done := make(chan error, 1)
+	go func() { done <- client.Handshake() }()
+	for !d.c.Ready() {
+		d.step()
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	state := client.ConnectionState()
+	if state.NegotiatedProtocol != "http/1.1" {
+		t.Fatalf("alpn: %q", state.NegotiatedProtocol)
+	}
+	if cn := state.PeerCertificates[0].Subject.CommonName; cn != "api.example.test" {
+		t.Fatalf("sni picked %q", cn)
+	}
+
+	go client.Write([]byte("ping"))
+	var got []byte
+	for len(got) < 4 {
+		got = append(got, d.step()...)
+	}
+	if string(got) != "ping" {
+		t.Fatalf("plain: %q", got)
+	}
+
+	encoded, err := d.c.Encode([]byte("pong"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.out <- encoded
+	buf := make([]byte, 16)
+	n, err := client.Read(buf)
+	if err != nil || string(buf[:n]) != "pong" {
+		t.Fatalf("client read %q %v", buf[:n], err)
+	}
+}
+
+func TestCodecBadHandshake(t *testing.T) {
+	wake, notify := newWake()
+	c := newCodec(NewConfig(selfSigned(t, "default.test")).build(), notify)
+	defer c.Close()
+	if _, _, err := c.Decode([]byte("GET / HTTP/1.1\r\n\r\n")); err != nil {
+		t.Fatal("Decode must not wait for the handshake goroutine", err)
+	}
+	select {
+	case <-wake:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no wake after a failed handshake")
+	}
+	if _, _, err := c.Decode(nil); err == nil {
+		t.Fatal("expected handshake error")
+	}
+	if c.Ready() {
+		t.Fatal("codec should not be ready")
+	}
+}
+
+// clientHello 从一个真实的客户端取得第一条握手消息
+func clientHello(t *testing.T) []byte {
+	clientSide, serverSide := net.Pipe()
+	defer serverSide.Close()
+	client := tls.Client(clientSide, &tls.Config{ServerName: "default.test", InsecureSkipVerify: true})
+	go client.Handshake()
+	buf := make([]byte, 64*1024)
+	serverSide.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := serverSide.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf[:n]
+}
+
+func TestCodecHandshakeDoesNotBlock(t *testing.T) {
+	cfg := NewConfig(selfSigned(t, "default.test"))
+	release := make(chan struct{})
+	cfg.Base = &tls.Config{GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		<-release
+		return nil, nil
+	}}
+	wake, notify := newWake()
+	c := newCodec(cfg.build(), notify)
+	defer c.Close()
+
+	// 握手goroutine被回调卡住时Decode立即返回
+	start := time.Now()
+	_, reply, err := c.Decode(clientHello(t))
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond || err != nil || len(reply) != 0 {
+		t.Fatalf("Decode took %v, reply %d bytes, err %v", elapsed, len(reply), err)
+	}
+	// 回调返回后goroutine通过wake通知,回复在下一次Decode中取走
+	close(release)
+	select {
+	case <-wake:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no wake after the server flight was written")
+	}
+	if _, reply, err := c.Decode(nil); err != nil || len(reply) == 0 {
+		t.Fatalf("expected server hello, got %d bytes, err %v", len(reply), err)
+	}
+}
+
+func TestCodecPartialRecord(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	d := drive(t, NewConfig(selfSigned(t, "default.test")).build(), serverSide)
+	defer d.Close()
+	client := tls.Client(clientSide, &tls.Config{InsecureSkipVerify: true})
+	done := make(chan error, 1)
+	go func() { done <- client.Handshake() }()
+	for !d.c.Ready() {
+		d.step()
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// 握手完成后记录按字节逐个喂入,不完整的记录留在tls.Conn中等待后续数据
+	go client.Write([]byte("hello"))
+	var record []byte
+	select {
+	case record = <-d.in:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no record from client")
+	}
+	var got []byte
+	for i := range record {
+		plain, _, err := d.c.Decode(record[i : i+1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(plain) > 0 && i != len(record)-1 {
+			t.Fatalf("plaintext before the record was complete at byte %d/%d", i, len(record))
+		}
+		got = append(got, plain...)
+	}
+	if string(got) != "hello" {
+		t.Fatalf("plain: %q", got)
+	}
+}
+
+// 在真实的事件循环上完成握手:握手goroutine通过WakeCodec让事件循环发送回复并补发Open
+func serveTLS(t *testing.T, events *EventLoop.Event) (*EventLoop.EventLoop, string, func()) {
+	l, err := Socket.NewListener("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.BindAndListen(); err != nil {
+		t.Fatal(err)
+	}
+	Listen(l, NewConfig(selfSigned(t, "default.test")))
+	el := EventLoop.New()
+	el.AddSystemEvent(events)
+	l.RegisterAccept(el)
+	sa, _ := syscall.Getsockname(l.Fd())
+	addr := fmt.Sprintf("127.0.0.1:%d", sa.(*syscall.SockaddrInet4).Port)
+	return el, addr, func() { l.Close() }
+}
+
+func TestListenOnLoop(t *testing.T) {
+	el, addr, stop := serveTLS(t, &EventLoop.Event{
+		Data: func(el *EventLoop.EventLoop, p *interface{}) {
+			c := (*p).(*Socket.Conn)
+			c.Write(append([]byte("echo:"), c.Read()...))
+		},
+	})
+	defer stop()
+	result := make(chan string, 1)
+	go func() {
+		conn, err := tls.Dial("tcp4", addr, &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			result <- err.Error()
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("hi"))
+		buf := make([]byte, 16)
+		n, _ := conn.Read(buf)
+		result <- string(buf[:n])
+	}()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		select {
+		case got := <-result:
+			if got != "echo:hi" {
+				t.Fatalf("client got %q", got)
+			}
+			return
+		default:
+			el.TikTok()
+		}
+	}
+	t.Fatal("handshake did not complete on the loop")
+}
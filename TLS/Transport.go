@@ -0,0 +1,99 @@
+/*
+ * @Description: 基于内存的net.Conn,作为crypto/tls的底层传输;事件循环负责把socket上的密文喂进来、把要发送的密文取走
+ * @Author: Rocky Hoo
+ * @Date: 2021-07-29 20:02:17
+ * @LastEditTime: 2021-07-29 22:31:40
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package TLS
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// 内存传输层对外报告的地址
+type memAddr struct{}
+
+func (memAddr) Network() string { return "memory" }
+func (memAddr) String() string  { return "memory" }
+
+// 非阻塞模式下没有可读数据时返回的错误,Temporary为true,tls.Conn会保留已读到的半个记录,之后可以重试
+type wouldBlock struct{}
+
+func (wouldBlock) Error() string   { return "tls transport would block" }
+func (wouldBlock) Timeout() bool   { return true }
+func (wouldBlock) Temporary() bool { return true }
+
+/**
+ * @description:crypto/tls的握手状态机不能中断后恢复,所以握手期间由一个专门的goroutine驱动tls.Conn:
+ *  事件循环喂入数据后立即返回,goroutine处理完输入、重新阻塞在Read上之前如果产生了要发送的密文,
+ *  通过notify通知事件循环来取,事件循环从不等待该goroutine;
+ *  握手完成后切换为非阻塞模式,没有数据时Read直接返回wouldBlock,记录层的读写都在事件循环中同步完成
+ * @param {*}
+ * @return {*}
+ */
+type transport struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	in       []byte //socket上读到,等待tls.Conn读取的密文
+	out      []byte //tls.Conn写出,等待写入socket的密文
+	notify   func() //握手goroutine产生了输出或者握手结束时调用,可以在任意goroutine中调用
+	nonblock bool   //握手完成后为true,Read不再等待
+	closed   bool
+}
+
+func newTransport(notify func()) *transport {
+	t := &transport{in: []byte{}, out: []byte{}, notify: notify}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+func (t *transport) Read(b []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.in) == 0 && t.nonblock && !t.closed {
+		return 0, wouldBlock{}
+	}
+	if len(t.in) == 0 && len(t.out) > 0 && !t.closed {
+		// 等待对端回复之前先让事件循环把这一轮握手消息发出去
+		t.notify()
+	}
+	for len(t.in) == 0 && !t.closed {
+		t.cond.Wait()
+	}
+	if len(t.in) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, t.in)
+	t.in = t.in[n:]
+	return n, nil
+}
+
+func (t *transport) Write(b []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return 0, io.ErrClosedPipe
+	}
+	t.out = append(t.out, b...)
+	return len(b), nil
+}
+
+func (t *transport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	t.cond.Broadcast()
+	return nil
+}
+
+func (t *transport) LocalAddr() net.Addr                { return memAddr{} }
+func (t *transport) RemoteAddr() net.Addr               { return memAddr{} }
+func (t *transport) SetDeadline(_ time.Time) error      { return nil }
+func (t *transport) SetReadDeadline(_ time.Time) error  { return nil }
+func (t *transport) SetWriteDeadline(_ time.Time) error { return nil }
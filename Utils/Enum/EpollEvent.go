@@ -5,3 +5,9 @@ const (
 	EVENT_READABLE
 	EVENT_WRITABLE
 )
+
+// 只会出现在就绪事件中的标志,不需要(也不能)注册
+const (
+	EVENT_HANGUP uint32 = 1 << (iota + 2) //对端关闭(如管道的写端全部关闭)
+	EVENT_ERROR                           //fd上发生错误
+)
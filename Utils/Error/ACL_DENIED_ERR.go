@@ -0,0 +1,19 @@
+/*
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-05 20:11:36
+ * @LastEditTime: 2021-08-05 20:11:36
+ * @LastEditors: Please set LastEditors
+ * @Description: 对端ip被访问控制列表拒绝
+ * @FilePath: /ReactLoop/Utils/Error/ACL_DENIED_ERR.go
+ */
+package err
+
+import "fmt"
+
+type ACL_DENIED_ERR struct {
+	IP string
+}
+
+func (e *ACL_DENIED_ERR) Error() string {
+	return fmt.Sprintf("ip %s denied by access control list", e.IP)
+}
@@ -0,0 +1,19 @@
+/*
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-17 11:02:19
+ * @LastEditTime: 2021-08-17 11:02:19
+ * @LastEditors: Please set LastEditors
+ * @Description: 用户回调发生panic,触发回调的连接因此被关闭
+ * @FilePath: /ReactLoop/Utils/Error/CALLBACK_PANIC_ERR.go
+ */
+package err
+
+import "fmt"
+
+type CALLBACK_PANIC_ERR struct {
+	Value interface{}
+}
+
+func (e *CALLBACK_PANIC_ERR) Error() string {
+	return fmt.Sprintf("callback panic: %v", e.Value)
+}
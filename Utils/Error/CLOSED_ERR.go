@@ -0,0 +1,27 @@
+/*
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-24 09:41:08
+ * @LastEditTime: 2021-08-24 10:12:47
+ * @LastEditors: Please set LastEditors
+ * @Description: 在已经关闭的Selector/事件循环上执行操作,匹配ErrClosed,底层为EBADF
+ * @FilePath: /ReactLoop/Utils/Error/CLOSED_ERR.go
+ */
+package err
+
+import "syscall"
+
+type CLOSED_ERR struct {
+	Op string
+}
+
+func (e *CLOSED_ERR) Error() string {
+	return e.Op + ": use of closed event loop"
+}
+
+func (e *CLOSED_ERR) Unwrap() error {
+	return syscall.EBADF
+}
+
+func (e *CLOSED_ERR) Is(target error) bool {
+	return target == ErrClosed
+}
@@ -0,0 +1,23 @@
+/*
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-03 09:42:18
+ * @LastEditTime: 2021-08-03 09:42:18
+ * @LastEditors: Please set LastEditors
+ * @Description: 连接数超出限制
+ * @FilePath: /ReactLoop/Utils/Error/CONN_LIMIT_ERR.go
+ */
+package err
+
+import "fmt"
+
+type CONN_LIMIT_ERR struct {
+	Limit int
+	PerIP bool //是否为单个ip的连接数限制
+}
+
+func (e *CONN_LIMIT_ERR) Error() string {
+	if e.PerIP {
+		return fmt.Sprintf("too many connections from one ip (limit %d)", e.Limit)
+	}
+	return fmt.Sprintf("too many connections (limit %d)", e.Limit)
+}
@@ -0,0 +1,38 @@
+/*
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-01 14:30:12
+ * @LastEditTime: 2021-08-01 14:30:12
+ * @LastEditors: Please set LastEditors
+ * @Description: 连接超时(空闲/读/写),满足net.Error接口
+ * @FilePath: /ReactLoop/Utils/Error/CONN_TIMEOUT_ERR.go
+ */
+package err
+
+import (
+	"fmt"
+	"syscall"
+)
+
+type CONN_TIMEOUT_ERR struct {
+	Kind string //idle/read/write/proxy header
+}
+
+func (e *CONN_TIMEOUT_ERR) Error() string {
+	return fmt.Sprintf("connection %s timeout", e.Kind)
+}
+
+func (e *CONN_TIMEOUT_ERR) Timeout() bool {
+	return true
+}
+
+func (e *CONN_TIMEOUT_ERR) Temporary() bool {
+	return true
+}
+
+func (e *CONN_TIMEOUT_ERR) Unwrap() error {
+	return syscall.ETIMEDOUT
+}
+
+func (e *CONN_TIMEOUT_ERR) Is(target error) bool {
+	return target == ErrTimeout
+}
@@ -0,0 +1,27 @@
+/*
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-28 10:20:36
+ * @LastEditTime: 2021-08-28 10:20:36
+ * @LastEditors: Please set LastEditors
+ * @Description: Unix域套接字的辅助数据无法使用(格式错误或者被截断),其中收到的fd已经全部关闭
+ * @FilePath: /ReactLoop/Utils/Error/CONTROL_MSG_ERR.go
+ */
+package err
+
+import "fmt"
+
+type CONTROL_MSG_ERR struct {
+	Msg string
+	Err error //解析失败时的底层错误,截断时为nil
+}
+
+func (e *CONTROL_MSG_ERR) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("invalid control message: %s: %v", e.Msg, e.Err)
+	}
+	return fmt.Sprintf("invalid control message: %s", e.Msg)
+}
+
+func (e *CONTROL_MSG_ERR) Unwrap() error {
+	return e.Err
+}
@@ -9,7 +9,10 @@
  */
 package err
 
-import "fmt"
+import (
+	"fmt"
+	"syscall"
+)
 
 type FD_EXEC_LIMIT_ERROR struct {
 	FD int
@@ -18,3 +21,12 @@ type FD_EXEC_LIMIT_ERROR struct {
 func (e *FD_EXEC_LIMIT_ERROR) Error() string {
 	return fmt.Sprintf("fd %d exceed the limit", e.FD)
 }
+
+// fd超出了Selector的容量,相当于进程的fd数达到上限
+func (e *FD_EXEC_LIMIT_ERROR) Unwrap() error {
+	return syscall.EMFILE
+}
+
+func (e *FD_EXEC_LIMIT_ERROR) Is(target error) bool {
+	return target == ErrFDLimit
+}
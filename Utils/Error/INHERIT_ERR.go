@@ -0,0 +1,20 @@
+/*
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-29 14:12:05
+ * @LastEditTime: 2021-08-29 14:12:05
+ * @LastEditors: Please set LastEditors
+ * @Description: 继承得到的监听fd不可用(没有在监听,或者绑定的地址与Listener不一致)
+ * @FilePath: /ReactLoop/Utils/Error/INHERIT_ERR.go
+ */
+package err
+
+import "fmt"
+
+type INHERIT_ERR struct {
+	Fd     int
+	Reason string
+}
+
+func (e *INHERIT_ERR) Error() string {
+	return fmt.Sprintf("inherited fd %d: %s", e.Fd, e.Reason)
+}
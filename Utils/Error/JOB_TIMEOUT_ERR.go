@@ -0,0 +1,42 @@
+/*
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-18 10:43:02
+ * @LastEditTime: 2021-08-18 10:43:02
+ * @LastEditors: Please set LastEditors
+ * @Description: 工作池中的任务超时,满足net.Error接口
+ * @FilePath: /ReactLoop/Utils/Error/JOB_TIMEOUT_ERR.go
+ */
+package err
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+)
+
+type JOB_TIMEOUT_ERR struct {
+	After time.Duration //任务的超时时间,任务自己报告超时时为0
+}
+
+func (e *JOB_TIMEOUT_ERR) Error() string {
+	if e.After == 0 {
+		return "job timeout"
+	}
+	return fmt.Sprintf("job timeout after %v", e.After)
+}
+
+func (e *JOB_TIMEOUT_ERR) Timeout() bool {
+	return true
+}
+
+func (e *JOB_TIMEOUT_ERR) Temporary() bool {
+	return true
+}
+
+func (e *JOB_TIMEOUT_ERR) Unwrap() error {
+	return syscall.ETIMEDOUT
+}
+
+func (e *JOB_TIMEOUT_ERR) Is(target error) bool {
+	return target == ErrTimeout
+}
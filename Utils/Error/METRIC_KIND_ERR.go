@@ -0,0 +1,21 @@
+/*
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-29 11:02:17
+ * @LastEditTime: 2021-08-29 11:02:17
+ * @LastEditors: Please set LastEditors
+ * @Description: 同名指标已经以另一种类型注册
+ * @FilePath: /ReactLoop/Utils/Error/METRIC_KIND_ERR.go
+ */
+package err
+
+import "fmt"
+
+type METRIC_KIND_ERR struct {
+	Name       string
+	Registered string //已经注册的类型
+	Requested  string //本次请求的类型
+}
+
+func (e *METRIC_KIND_ERR) Error() string {
+	return fmt.Sprintf("metric %s registered as %s, not %s", e.Name, e.Registered, e.Requested)
+}
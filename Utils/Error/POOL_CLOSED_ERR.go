@@ -0,0 +1,19 @@
+/*
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-18 10:41:37
+ * @LastEditTime: 2021-08-18 10:41:37
+ * @LastEditors: Please set LastEditors
+ * @Description: 工作池已经关闭
+ * @FilePath: /ReactLoop/Utils/Error/POOL_CLOSED_ERR.go
+ */
+package err
+
+type POOL_CLOSED_ERR struct{}
+
+func (e *POOL_CLOSED_ERR) Error() string {
+	return "worker pool is closed"
+}
+
+func (e *POOL_CLOSED_ERR) Is(target error) bool {
+	return target == ErrClosed
+}
@@ -0,0 +1,19 @@
+/*
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-18 10:40:55
+ * @LastEditTime: 2021-08-18 10:40:55
+ * @LastEditors: Please set LastEditors
+ * @Description: 工作池的等待队列已满
+ * @FilePath: /ReactLoop/Utils/Error/POOL_FULL_ERR.go
+ */
+package err
+
+import "fmt"
+
+type POOL_FULL_ERR struct {
+	Size int
+}
+
+func (e *POOL_FULL_ERR) Error() string {
+	return fmt.Sprintf("worker pool queue is full (%d)", e.Size)
+}
@@ -0,0 +1,19 @@
+/*
+ * @Author: Rocky Hoo
+ * @Date: 2021-07-31 10:05:27
+ * @LastEditTime: 2021-07-31 10:05:27
+ * @LastEditors: Please set LastEditors
+ * @Description: PROXY协议头格式错误
+ * @FilePath: /ReactLoop/Utils/Error/PROXY_PROTOCOL_ERR.go
+ */
+package err
+
+import "fmt"
+
+type PROXY_PROTOCOL_ERR struct {
+	Msg string
+}
+
+func (e *PROXY_PROTOCOL_ERR) Error() string {
+	return fmt.Sprintf("invalid PROXY protocol header: %s", e.Msg)
+}
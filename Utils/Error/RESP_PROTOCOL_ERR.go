@@ -0,0 +1,19 @@
+/*
+ * @Author: Rocky Hoo
+ * @Date: 2021-07-27 20:14:05
+ * @LastEditTime: 2021-07-27 20:14:05
+ * @LastEditors: Please set LastEditors
+ * @Description: RESP协议格式错误
+ * @FilePath: /ReactLoop/Utils/Error/RESP_PROTOCOL_ERR.go
+ */
+package err
+
+import "fmt"
+
+type RESP_PROTOCOL_ERR struct {
+	Msg string
+}
+
+func (e *RESP_PROTOCOL_ERR) Error() string {
+	return fmt.Sprintf("Protocol error: %s", e.Msg)
+}
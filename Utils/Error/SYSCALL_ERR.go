@@ -0,0 +1,57 @@
+/*
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-24 09:30:12
+ * @LastEditTime: 2021-08-24 11:05:31
+ * @LastEditors: Please set LastEditors
+ * @Description: 系统调用失败,按errno匹配哨兵错误:EMFILE/ENFILE为ErrFDLimit,ETIMEDOUT为ErrTimeout,EBADF为ErrClosed
+ * @FilePath: /ReactLoop/Utils/Error/SYSCALL_ERR.go
+ */
+package err
+
+import "syscall"
+
+type SYSCALL_ERR struct {
+	Op  string //系统调用名,如epoll_ctl
+	Err syscall.Errno
+}
+
+func (e *SYSCALL_ERR) Error() string {
+	return e.Op + ": " + e.Err.Error()
+}
+
+func (e *SYSCALL_ERR) Unwrap() error {
+	return e.Err
+}
+
+func (e *SYSCALL_ERR) Is(target error) bool {
+	switch e.Err {
+	case syscall.EMFILE, syscall.ENFILE:
+		return target == ErrFDLimit
+	case syscall.ETIMEDOUT:
+		return target == ErrTimeout
+	case syscall.EBADF:
+		return target == ErrClosed
+	}
+	return false
+}
+
+func (e *SYSCALL_ERR) Timeout() bool {
+	return e.Err.Timeout()
+}
+
+func (e *SYSCALL_ERR) Temporary() bool {
+	return e.Err.Temporary()
+}
+
+/**
+ * @description:把系统调用返回的错误包装为SYSCALL_ERR,nil和非Errno的错误原样返回
+ * @param {string} op
+ * @param {error} e
+ * @return {*}
+ */
+func Syscall(op string, e error) error {
+	if errno, ok := e.(syscall.Errno); ok {
+		return &SYSCALL_ERR{Op: op, Err: errno}
+	}
+	return e
+}
@@ -0,0 +1,19 @@
+/*
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-24 09:16:40
+ * @LastEditTime: 2021-08-24 11:02:55
+ * @LastEditors: Please set LastEditors
+ * @Description: 哨兵错误,各个错误类型通过Is与之匹配,通过Unwrap得到底层的syscall.Errno,
+ *  调用方可以用errors.Is(err, ErrFDLimit)或者errors.Is(err, syscall.EMFILE)判断
+ * @FilePath: /ReactLoop/Utils/Error/Sentinel.go
+ */
+package err
+
+import "errors"
+
+var (
+	ErrFDLimit        = errors.New("file descriptor limit reached")
+	ErrUnknownNetwork = errors.New("unknown network")
+	ErrClosed         = errors.New("use of closed resource")
+	ErrTimeout        = errors.New("timeout")
+)
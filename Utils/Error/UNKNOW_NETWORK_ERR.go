@@ -8,7 +8,10 @@
  */
 package err
 
-import "fmt"
+import (
+	"fmt"
+	"syscall"
+)
 
 type UNKNOW_NETWORK_ERR struct {
 	Network string
@@ -17,3 +20,11 @@ type UNKNOW_NETWORK_ERR struct {
 func (e *UNKNOW_NETWORK_ERR) Error() string {
 	return fmt.Sprintf("Network %s is unknown\n", e.Network)
 }
+
+func (e *UNKNOW_NETWORK_ERR) Unwrap() error {
+	return syscall.EAFNOSUPPORT
+}
+
+func (e *UNKNOW_NETWORK_ERR) Is(target error) bool {
+	return target == ErrUnknownNetwork
+}
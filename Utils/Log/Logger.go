@@ -0,0 +1,177 @@
+/*
+ * @Description: 分级的结构化日志接口,默认不输出;通过NewStd适配标准库的log.Logger
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-23 09:42:18
+ * @LastEditTime: 2021-08-23 14:36:50
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package logger
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Level 日志级别
+type Level int8
+
+const (
+	DEBUG Level = iota
+	INFO
+	WARN
+	ERROR
+)
+
+func (l Level) String() string {
+	switch l {
+	case DEBUG:
+		return "DEBUG"
+	case INFO:
+		return "INFO"
+	case WARN:
+		return "WARN"
+	case ERROR:
+		return "ERROR"
+	}
+	return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+}
+
+// Field 日志中的一个键值对
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// 常用字段
+func Loop(id int) Field {
+	return Field{Key: "loop", Value: id}
+}
+
+func Fd(fd int) Field {
+	return Field{Key: "fd", Value: fd}
+}
+
+func Remote(addr string) Field {
+	return Field{Key: "remote", Value: addr}
+}
+
+func Err(e error) Field {
+	return Field{Key: "error", Value: e}
+}
+
+/**
+ * @description:日志接口,实现需要能在多个goroutine中同时调用
+ * @param {*}
+ * @return {*}
+ */
+type Logger interface {
+	// Enabled 该级别的日志是否会被输出,用于跳过构造字段的开销
+	Enabled(level Level) bool
+	Log(level Level, msg string, fields ...Field)
+}
+
+/**
+ * @description:可以为日志提供字段的对象(如连接提供fd和对端地址)
+ * @param {*}
+ * @return {*}
+ */
+type Fielder interface {
+	LogFields() []Field
+}
+
+type nop struct{}
+
+func (nop) Enabled(Level) bool          { return false }
+func (nop) Log(Level, string, ...Field) {}
+
+// Nop 不输出任何日志,为默认的Logger
+var Nop Logger = nop{}
+
+/**
+ * @description:为logger输出的每条日志附加fields
+ * @param {Logger} l
+ * @param {...Field} fields
+ * @return {*}
+ */
+func With(l Logger, fields ...Field) Logger {
+	if len(fields) == 0 {
+		return l
+	}
+	if w, ok := l.(*with); ok {
+		return &with{next: w.next, fields: append(append([]Field{}, w.fields...), fields...)}
+	}
+	return &with{next: l, fields: fields}
+}
+
+type with struct {
+	next   Logger
+	fields []Field
+}
+
+func (w *with) Enabled(level Level) bool {
+	return w.next.Enabled(level)
+}
+
+func (w *with) Log(level Level, msg string, fields ...Field) {
+	w.next.Log(level, msg, append(append([]Field{}, w.fields...), fields...)...)
+}
+
+type std struct {
+	out *log.Logger
+	min Level
+}
+
+/**
+ * @description:适配标准库的log.Logger:单行字段以key=value输出,多行字段(如调用栈)依次附加在该行之后
+ * @param {*log.Logger} out 为nil时使用标准库默认logger的输出、前缀和格式
+ * @param {Level} min 低于该级别的日志不输出
+ * @return {*}
+ */
+func NewStd(out *log.Logger, min Level) Logger {
+	if out == nil {
+		out = log.New(log.Writer(), log.Prefix(), log.Flags())
+	}
+	return &std{out: out, min: min}
+}
+
+func (s *std) Enabled(level Level) bool {
+	return level >= s.min
+}
+
+func (s *std) Log(level Level, msg string, fields ...Field) {
+	if level < s.min {
+		return
+	}
+	b := &strings.Builder{}
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	var multiline []Field
+	for _, f := range fields {
+		v := fmt.Sprint(f.Value)
+		if strings.Contains(v, "\n") {
+			multiline = append(multiline, Field{Key: f.Key, Value: v})
+			continue
+		}
+		b.WriteByte(' ')
+		b.WriteString(f.Key)
+		b.WriteByte('=')
+		if v == "" || strings.ContainsAny(v, " \"=") {
+			v = strconv.Quote(v)
+		}
+		b.WriteString(v)
+	}
+	for _, f := range multiline {
+		b.WriteString("\n" + f.Key + ":\n")
+		b.WriteString(strings.TrimRight(f.Value.(string), "\n"))
+	}
+	s.out.Output(2, b.String())
+}
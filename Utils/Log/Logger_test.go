@@ -0,0 +1,33 @@
+/*
+ * @Description: 日志接口与标准库适配测试
+ * @Author: Rocky Hoo
+ * @Date: 2021-08-23 11:20:43
+ * @LastEditTime: 2021-08-23 14:02:19
+ * @LastEditors: Please set LastEditors
+ * @CopyRight: XiaoPeng Studio
+ * Copyright (c) 2021 XiaoPeng Studio
+ */
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"testing"
+)
+
+func TestStd(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := With(NewStd(log.New(buf, "", 0), INFO), Loop(3))
+	l = With(l, Fd(7))
+	if l.Enabled(DEBUG) || !l.Enabled(WARN) {
+		t.Fatal("levels below INFO should be disabled")
+	}
+	l.Log(DEBUG, "hidden")
+	l.Log(WARN, "closed", Remote("1.2.3.4:80"), Err(errors.New("reset by peer")), F("stack", "a\nb\n"))
+	want := "WARN closed loop=3 fd=7 remote=1.2.3.4:80 error=\"reset by peer\"\nstack:\na\nb\n"
+	if buf.String() != want {
+		t.Fatalf("got %q", buf.String())
+	}
+	Nop.Log(ERROR, "nothing")
+}
@@ -0,0 +1,153 @@
+/*
+ * @Author: RockyHoo
+ * @Date: 2021-07-27 22:30:08
+ * @LastEditTime: 2021-07-27 23:55:41
+ * @LastEditors: Please set LastEditors
+ * @Description: 基于Resp包实现的内存缓存(GET/SET/DEL/EXPIRE),过期通过EventLoop定时器实现
+ * @FilePath: /ReactLoop/examples/redis/main.go
+ */
+package main
+
+import (
+	"Reactloop"
+	"Reactloop/EventLoop"
+	"Reactloop/Resp"
+	"Reactloop/Socket"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type entry struct {
+	value []byte
+	timer *EventLoop.UserEvent //过期定时器,没有设置过期时间时为nil
+}
+
+// 所有命令都在事件循环中执行,不需要加锁
+var store = map[string]*entry{}
+
+/**
+ * @description:删除key,同时取消它的过期定时器
+ * @param {*EventLoop.EventLoop} el
+ * @param {string} key
+ * @return {*}
+ */
+func del(el *EventLoop.EventLoop, key string) bool {
+	e, ok := store[key]
+	if !ok {
+		return false
+	}
+	if e.timer != nil {
+		el.RemoveUserEvent(e.timer)
+	}
+	delete(store, key)
+	return true
+}
+
+/**
+ * @description:为key设置过期定时器,覆盖之前的定时器
+ * @param {*EventLoop.EventLoop} el
+ * @param {string} key
+ * @param {time.Duration} ttl
+ * @return {*}
+ */
+func expire(el *EventLoop.EventLoop, key string, ttl time.Duration) {
+	e := store[key]
+	if e.timer != nil {
+		el.RemoveUserEvent(e.timer)
+	}
+	e.timer = el.AddTimer(ttl, func(el *EventLoop.EventLoop, _ *interface{}) {
+		delete(store, key)
+	})
+}
+
+func ping(w *Resp.Writer, cmd *Resp.Command) {
+	if len(cmd.Args) > 0 {
+		w.WriteBulk(cmd.Args[0])
+		return
+	}
+	w.WriteSimpleString("PONG")
+}
+
+func get(w *Resp.Writer, cmd *Resp.Command) {
+	e, ok := store[string(cmd.Args[0])]
+	if !ok {
+		w.WriteNull()
+		return
+	}
+	w.WriteBulk(e.value)
+}
+
+// SET key value [EX seconds]
+func set(w *Resp.Writer, cmd *Resp.Command) {
+	key := string(cmd.Args[0])
+	var ttl time.Duration
+	if len(cmd.Args) == 4 && strings.ToLower(string(cmd.Args[2])) == "ex" {
+		seconds, err := strconv.Atoi(string(cmd.Args[3]))
+		if err != nil || seconds <= 0 {
+			w.WriteError("ERR invalid expire time in 'set' command")
+			return
+		}
+		ttl = time.Duration(seconds) * time.Second
+	} else if len(cmd.Args) != 2 {
+		w.WriteError("ERR syntax error")
+		return
+	}
+	del(cmd.Loop, key)
+	store[key] = &entry{value: cmd.Args[1]}
+	if ttl > 0 {
+		expire(cmd.Loop, key, ttl)
+	}
+	w.WriteSimpleString("OK")
+}
+
+func delCmd(w *Resp.Writer, cmd *Resp.Command) {
+	var n int64
+	for _, key := range cmd.Args {
+		if del(cmd.Loop, string(key)) {
+			n++
+		}
+	}
+	w.WriteInteger(n)
+}
+
+func expireCmd(w *Resp.Writer, cmd *Resp.Command) {
+	key := string(cmd.Args[0])
+	seconds, err := strconv.Atoi(string(cmd.Args[1]))
+	if err != nil {
+		w.WriteError("ERR value is not an integer or out of range")
+		return
+	}
+	if _, ok := store[key]; !ok {
+		w.WriteInteger(0)
+		return
+	}
+	if seconds <= 0 {
+		del(cmd.Loop, key)
+	} else {
+		expire(cmd.Loop, key, time.Duration(seconds)*time.Second)
+	}
+	w.WriteInteger(1)
+}
+
+func main() {
+	mux := Resp.NewMux()
+	mux.Handle("ping", -1, ping)
+	mux.Handle("get", 2, get)
+	mux.Handle("set", -3, set)
+	mux.Handle("del", -2, delCmd)
+	mux.Handle("expire", 3, expireCmd)
+
+	listener, err := Socket.NewListener("tcp4", "127.0.0.1:6380")
+	if err != nil {
+		panic(err)
+	}
+	server := Reactloop.NewServer()
+	server.AddListener(listener)
+	server.AddSystemEvent(mux.Event())
+	fmt.Println("redis example listening on 127.0.0.1:6380")
+	if err := server.StartServe(); err != nil {
+		panic(err)
+	}
+}